@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"strings"
+)
+
+// countriesCSV is a table of ISO 3166-1 alpha-2 codes and English names of countries. A country can have more
+// names than one, e.g. a former or a common one, and then every name is in a separate row.
+//
+//go:embed countries.csv
+var countriesCSV []byte
+
+// countries contains codes of countries by their names and codes in lower case.
+var countries = parseCountries(countriesCSV)
+
+// parseCountries parses a table of countries. It panics when the table is not valid, because it is embedded.
+func parseCountries(table []byte) map[string]string {
+	records, err := csv.NewReader(bytes.NewReader(table)).ReadAll()
+	if err != nil {
+		panic("invalid table of countries: " + err.Error())
+	}
+
+	byName := make(map[string]string, 2*len(records))
+	// The first record is a header.
+	for _, record := range records[1:] {
+		byName[strings.ToLower(record[0])] = record[0]
+		byName[strings.ToLower(record[1])] = record[0]
+	}
+
+	return byName
+}
+
+// CountryCode returns an ISO 3166-1 alpha-2 code of a country, which is given by its English name or its code.
+// A case of letters does not matter.
+func CountryCode(country string) (string, bool) {
+	code, ok := countries[strings.ToLower(country)]
+	return code, ok
+}
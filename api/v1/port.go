@@ -1,13 +1,40 @@
 package v1
 
 import (
-	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// Time zone database is embedded, so time zones can be validated even when the host does not provide it.
+	_ "time/tzdata"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// ProblemContentType is a content type of error responses (RFC 7807).
+	ProblemContentType = "application/problem+json"
+	// BlankProblemType is a type of problems which are described by their status codes alone.
+	BlankProblemType = "about:blank"
+	// ValidationProblemType is a type of problems whose fields of a request are not valid.
+	ValidationProblemType = "urn:ports:problem:validation"
 )
 
+// unlocRegexp describes UN/LOCODE format: 2 letters of a country code and 3 characters of a location code.
+var unlocRegexp = regexp.MustCompile(`^[A-Z]{2}[A-Z2-9]{3}$`)
+
 // Port describes port's properties.
 type Port struct {
+	// Alias is a list of alternative names of a port.
+	Alias []string `json:"alias,omitempty"`
 	// City is a city of a port.
 	City string `json:"city,omitempty"`
+	// Code is a code of a port.
+	Code string `json:"code,omitempty"`
 	// Coordinates is a coordinates of a port.
 	Coordinates []float64 `json:"coordinates,omitempty"`
 	// Country is a country of a port.
@@ -16,25 +43,308 @@ type Port struct {
 	Name string `json:"name,omitempty"`
 	// Province is a province of a port.
 	Province string `json:"province,omitempty"`
+	// Regions is a list of regions of a port.
+	Regions []string `json:"regions,omitempty"`
+	// Timezone is an IANA time zone name of a port.
+	Timezone string `json:"timezone,omitempty"`
+	// Unlocs is a list of UN/LOCODEs of a port.
+	Unlocs []string `json:"unlocs,omitempty"`
+}
+
+// FieldError describes why a field of a request is not valid.
+type FieldError struct {
+	// Field is a JSON path of a field, e.g. `$.unlocs[1]`.
+	Field string `json:"field"`
+	// Message describes a problem.
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors contains every invalid field of a request.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// add appends an invalid field.
+func (e *ValidationErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Normalize returns a copy of a port whose texts are in Unicode NFC without leading and trailing white spaces,
+// so the same names are stored the same way. It should be called before Validate.
+func (p Port) Normalize() Port {
+	p.Alias = normalizeTexts(p.Alias)
+	p.City = normalizeText(p.City)
+	p.Country = normalizeText(p.Country)
+	p.Name = normalizeText(p.Name)
+	p.Province = normalizeText(p.Province)
+	p.Regions = normalizeTexts(p.Regions)
+
+	return p
 }
 
-// Validate validates port input data.
+// normalizeText returns a text in Unicode NFC without leading and trailing white spaces.
+func normalizeText(text string) string {
+	return strings.TrimSpace(norm.NFC.String(text))
+}
+
+// normalizeTexts returns a copy of texts in Unicode NFC without leading and trailing white spaces.
+func normalizeTexts(texts []string) []string {
+	if texts == nil {
+		return nil
+	}
+
+	normalized := make([]string, len(texts))
+	for i, text := range texts {
+		normalized[i] = normalizeText(text)
+	}
+
+	return normalized
+}
+
+// Validate validates port input data. Every invalid field is returned in ValidationErrors.
 func (p Port) Validate() error {
+	var errs ValidationErrors
+
 	if len(p.Name) == 0 {
-		return errors.New("port's name can not be empty")
+		errs.add("$.name", "port's name can not be empty")
+	} else {
+		validateText(&errs, "$.name", "name", p.Name)
 	}
 
 	if len(p.Coordinates) == 0 {
-		return errors.New("port's coordinates can not be empty")
+		errs.add("$.coordinates", "port's coordinates can not be empty")
 	} else if len(p.Coordinates) != 2 {
-		return errors.New("port's coordinates should have only 2 values")
+		errs.add("$.coordinates", "port's coordinates should have only 2 values")
+	} else {
+		// Coordinates are in GeoJSON order: a longitude and a latitude.
+		if lon := p.Coordinates[0]; math.IsNaN(lon) || lon < -180 || lon > 180 {
+			errs.add("$.coordinates[0]", "port's longitude %v is not between -180 and 180", lon)
+		}
+		if lat := p.Coordinates[1]; math.IsNaN(lat) || lat < -90 || lat > 90 {
+			errs.add("$.coordinates[1]", "port's latitude %v is not between -90 and 90", lat)
+		}
 	}
 
 	if len(p.Country) == 0 {
-		return errors.New("port's country can not be empty")
+		errs.add("$.country", "port's country can not be empty")
+	} else if _, ok := CountryCode(p.Country); !ok {
+		errs.add("$.country", "port's country \"%s\" is not an ISO 3166 country name or code", p.Country)
 	}
 
 	// Let's assume that city and province can be empty.
+	validateText(&errs, "$.city", "city", p.City)
+	validateText(&errs, "$.province", "province", p.Province)
+	for i, alias := range p.Alias {
+		validateText(&errs, fmt.Sprintf("$.alias[%d]", i), "alias", alias)
+	}
+	for i, region := range p.Regions {
+		validateText(&errs, fmt.Sprintf("$.regions[%d]", i), "region", region)
+	}
+
+	if len(p.Timezone) > 0 {
+		// Local is accepted by the time package, but it is not an IANA time zone name.
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			errs.add("$.timezone", "port's timezone \"%s\" is not a valid IANA time zone name", p.Timezone)
+		}
+	}
+
+	for i, unloc := range p.Unlocs {
+		if !unlocRegexp.MatchString(unloc) {
+			errs.add(fmt.Sprintf("$.unlocs[%d]", i), "port's unloc \"%s\" is not a valid UN/LOCODE", unloc)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
 
 	return nil
 }
+
+// validateText checks that a text is valid UTF-8 in Unicode NFC without control characters, e.g. a name
+// which has been copied with a line break.
+func validateText(errs *ValidationErrors, field, name, text string) {
+	switch {
+	case !utf8.ValidString(text):
+		errs.add(field, "port's %s is not valid UTF-8", name)
+	case strings.IndexFunc(text, unicode.IsControl) >= 0:
+		errs.add(field, "port's %s %s can not contain control characters", name, strconv.Quote(text))
+	case !norm.NFC.IsNormalString(text):
+		errs.add(field, "port's %s \"%s\" is not normalized to Unicode NFC", name, text)
+	}
+}
+
+// PortWithID extends Port structure with ID field.
+type PortWithID struct {
+	// ID is an ID of a port.
+	ID string `json:"id"`
+	Port
+}
+
+// PortList is a single page of ports.
+type PortList struct {
+	// Ports on a page.
+	Ports []PortWithID `json:"ports"`
+	// NextCursor should be sent to get a next page. It is empty for the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// PortWithDistance extends PortWithID with a distance from a searched point.
+type PortWithDistance struct {
+	PortWithID
+	// Distance is a great-circle distance in kilometers.
+	Distance float64 `json:"distance"`
+}
+
+// NearbyPorts is a list of ports sorted by distance from a searched point.
+type NearbyPorts struct {
+	// Ports sorted by distance.
+	Ports []PortWithDistance `json:"ports"`
+}
+
+// ImportFailure describes why a port has not been imported.
+type ImportFailure struct {
+	// ID is an ID of a port.
+	ID string `json:"id"`
+	// Error is a reason of a failure.
+	Error string `json:"error"`
+}
+
+// ImportReport describes what has happened with every imported port.
+type ImportReport struct {
+	// Created contains IDs of created ports.
+	Created []string `json:"created"`
+	// Updated contains IDs of updated ports.
+	Updated []string `json:"updated"`
+	// Skipped contains IDs of ports which have not been changed.
+	Skipped []string `json:"skipped"`
+	// Deleted contains IDs of ports which have been deleted, because they are not in imported data.
+	Deleted []string `json:"deleted"`
+	// Failed contains ports which could not be imported.
+	Failed []ImportFailure `json:"failed"`
+	// Error is a reason why an import has been stopped. Ports which are reported so far have been imported.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditChange describes a single changed property of a port.
+type AuditChange struct {
+	// Field is a name of a property.
+	Field string `json:"field"`
+	// Before is a value before a change, or null when it has been empty.
+	Before interface{} `json:"before"`
+	// After is a value after a change, or null when it is empty.
+	After interface{} `json:"after"`
+}
+
+// AuditEvent describes who has changed a port, when and how.
+type AuditEvent struct {
+	// Sequence is a number of an event, which grows across all ports.
+	Sequence uint64 `json:"sequence"`
+	// PortID is an ID of a changed port.
+	PortID string `json:"portId"`
+	// Action is create, update or delete.
+	Action string `json:"action"`
+	// Actor is who has changed a port.
+	Actor string `json:"actor"`
+	// Time is when a port has been changed.
+	Time time.Time `json:"time"`
+	// Before is a port before a change. It is omitted for a created port.
+	Before *Port `json:"before,omitempty"`
+	// After is a port after a change. It is omitted for a deleted port.
+	After *Port `json:"after,omitempty"`
+	// Changes contains properties which have been changed.
+	Changes []AuditChange `json:"changes"`
+}
+
+// AuditEventList is a single page of audit events.
+type AuditEventList struct {
+	// Events on a page, from the oldest one.
+	Events []AuditEvent `json:"events"`
+	// NextCursor should be sent to get a next page. It is empty for the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// RevertRequest describes which revision of a port is restored.
+type RevertRequest struct {
+	// Revision is a previous revision of a port.
+	Revision uint64 `json:"revision"`
+}
+
+// WatchEvent describes a change of a port which is streamed to watchers.
+type WatchEvent struct {
+	// ID is an ID of a changed port.
+	ID string `json:"id"`
+	// Action is create, update or delete.
+	Action string `json:"action"`
+	// Revision is a revision of a change.
+	Revision uint64 `json:"revision"`
+	// Port is a port after a change, or a deleted port.
+	Port *Port `json:"port"`
+}
+
+// Webhook describes a subscription which gets changes of ports.
+type Webhook struct {
+	// ID is set by the server.
+	ID string `json:"id,omitempty"`
+	// URL receives POST requests with WatchEvent bodies.
+	URL string `json:"url"`
+	// Secret signs deliveries. It is generated when it is not provided, and it is returned only once.
+	Secret string `json:"secret,omitempty"`
+	// Country limits changes to ports from a country.
+	Country string `json:"country,omitempty"`
+	// IDPrefix limits changes to ports whose IDs start with it.
+	IDPrefix string `json:"idPrefix,omitempty"`
+	// CreatedAt is set by the server.
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookList is a list of webhooks.
+type WebhookList struct {
+	// Webhooks from the oldest one.
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// DeadLetter is a change of a port which has not been delivered to a webhook.
+type DeadLetter struct {
+	// Event is a change of a port.
+	Event WatchEvent `json:"event"`
+	// Attempts is a number of failed attempts.
+	Attempts int `json:"attempts"`
+	// Error is a reason of the last failure.
+	Error string `json:"error"`
+	// FailedAt is time of the last failure.
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// DeadLetterList is a list of dead letters of a webhook.
+type DeadLetterList struct {
+	// DeadLetters from the oldest one.
+	DeadLetters []DeadLetter `json:"deadLetters"`
+}
+
+// Problem describes why a request has failed (RFC 7807). It is sent with ProblemContentType.
+type Problem struct {
+	// Type is a URI which identifies a kind of a problem, e.g. BlankProblemType or ValidationProblemType.
+	Type string `json:"type"`
+	// Title is a short summary of a kind of a problem.
+	Title string `json:"title"`
+	// Status is an HTTP status code.
+	Status int `json:"status"`
+	// Detail explains this occurrence of a problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a path of a failed request.
+	Instance string `json:"instance,omitempty"`
+	// Errors contains invalid fields of a request.
+	Errors []FieldError `json:"errors,omitempty"`
+}
@@ -1,66 +1,185 @@
 package v1
 
 import (
-	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 // TestPort_Validate tests port validation.
-func TestPort_Validate(t *testing.T) {
+func TestPort_Validate(t *testing.T) { // nolint: funlen
 	type fields struct {
+		Alias       []string
 		City        string
 		Coordinates []float64
 		Country     string
 		Name        string
 		Province    string
+		Regions     []string
+		Timezone    string
+		Unlocs      []string
 	}
 	tests := map[string]struct {
 		fields  fields
 		wantErr error
 	}{
-		"empty name": {
-			wantErr: errors.New("port's name can not be empty"),
-		},
-		"empty coordinates": {
-			fields: fields{
-				Name: "test",
+		"empty port": {
+			wantErr: ValidationErrors{
+				{Field: "$.name", Message: "port's name can not be empty"},
+				{Field: "$.coordinates", Message: "port's coordinates can not be empty"},
+				{Field: "$.country", Message: "port's country can not be empty"},
 			},
-			wantErr: errors.New("port's coordinates can not be empty"),
 		},
 		"invalid coordinates": {
 			fields: fields{
 				Name:        "test",
 				Coordinates: []float64{1, 1, 1},
+				Country:     "PL",
+			},
+			wantErr: ValidationErrors{{Field: "$.coordinates", Message: "port's coordinates should have only 2 values"}},
+		},
+		"coordinates out of range": {
+			fields: fields{
+				Name:        "test",
+				Coordinates: []float64{500, -90.5},
+				Country:     "Poland",
+			},
+			wantErr: ValidationErrors{
+				{Field: "$.coordinates[0]", Message: "port's longitude 500 is not between -180 and 180"},
+				{Field: "$.coordinates[1]", Message: "port's latitude -90.5 is not between -90 and 90"},
+			},
+		},
+		"unknown country": {
+			fields: fields{
+				Name:        "test",
+				Coordinates: []float64{1, 1},
+				Country:     "Narnia",
+			},
+			wantErr: ValidationErrors{
+				{Field: "$.country", Message: "port's country \"Narnia\" is not an ISO 3166 country name or code"},
+			},
+		},
+		"control characters and decomposed letters": {
+			fields: fields{
+				Name:        "Gdańsk\n",
+				Coordinates: []float64{1, 1},
+				Country:     "Poland",
+				City:        "Gdańsk",
+				Alias:       []string{"Danzig", "Gdan\u0301sk"},
+				Regions:     []string{"Pomerania\x00"},
+			},
+			wantErr: ValidationErrors{
+				{Field: "$.name", Message: `port's name "Gdańsk\n" can not contain control characters`},
+				{Field: "$.alias[1]", Message: "port's alias \"Gdan\u0301sk\" is not normalized to Unicode NFC"},
+				{Field: "$.regions[0]", Message: `port's region "Pomerania\x00" can not contain control characters`},
+			},
+		},
+		"invalid timezone": {
+			fields: fields{
+				Name:        "test",
+				Coordinates: []float64{1, 1},
+				Country:     "pl",
+				Timezone:    "Europe/Nowhere",
+			},
+			wantErr: ValidationErrors{{
+				Field:   "$.timezone",
+				Message: "port's timezone \"Europe/Nowhere\" is not a valid IANA time zone name",
+			}},
+		},
+		"local timezone": {
+			fields: fields{
+				Name:        "test",
+				Coordinates: []float64{1, 1},
+				Country:     "Poland",
+				Timezone:    "Local",
 			},
-			wantErr: errors.New("port's coordinates should have only 2 values"),
+			wantErr: ValidationErrors{{
+				Field:   "$.timezone",
+				Message: "port's timezone \"Local\" is not a valid IANA time zone name",
+			}},
 		},
-		"empty city": {
+		"invalid unloc": {
 			fields: fields{
 				Name:        "test",
 				Coordinates: []float64{1, 1},
+				Country:     "United Arab Emirates",
+				Unlocs:      []string{"AEAJM", "ae10"},
+			},
+			wantErr: ValidationErrors{{Field: "$.unlocs[1]", Message: "port's unloc \"ae10\" is not a valid UN/LOCODE"}},
+		},
+		"valid port": {
+			fields: fields{
+				Name:        "Ajman",
+				Coordinates: []float64{55.5136433, 25.4052165},
+				Country:     "united arab emirates",
+				Timezone:    "Asia/Dubai",
+				Unlocs:      []string{"AEAJM"},
 			},
-			wantErr: errors.New("port's country can not be empty"),
 		},
 	}
 
 	for testName, test := range tests {
 		t.Run(testName, func(t *testing.T) {
 			p := Port{
+				Alias:       test.fields.Alias,
 				City:        test.fields.City,
 				Coordinates: test.fields.Coordinates,
 				Country:     test.fields.Country,
 				Name:        test.fields.Name,
 				Province:    test.fields.Province,
+				Regions:     test.fields.Regions,
+				Timezone:    test.fields.Timezone,
+				Unlocs:      test.fields.Unlocs,
 			}
 
 			err := p.Validate()
 			if test.wantErr != nil {
-				require.EqualError(t, err, test.wantErr.Error())
+				require.Equal(t, test.wantErr, err)
 			} else {
 				require.NoError(t, err)
 			}
 		})
 	}
 }
+
+// TestPort_Normalize tests normalization of port's texts.
+func TestPort_Normalize(t *testing.T) {
+	p := Port{
+		Alias:       []string{" Gdan\u0301sk "},
+		Name:        "Gdańsk\t",
+		Coordinates: []float64{18.6466, 54.352},
+		Country:     " Poland",
+	}
+
+	normalized := p.Normalize()
+	require.Equal(t, Port{
+		Alias:       []string{"Gdańsk"},
+		Name:        "Gdańsk",
+		Coordinates: []float64{18.6466, 54.352},
+		Country:     "Poland",
+	}, normalized)
+	require.NoError(t, normalized.Validate())
+	require.Equal(t, " Gdan\u0301sk ", p.Alias[0], "port must not be changed")
+}
+
+// TestCountryCode tests ISO 3166 codes of countries.
+func TestCountryCode(t *testing.T) {
+	for country, code := range map[string]string{
+		"PL":                                     "PL",
+		"pl":                                     "PL",
+		"Poland":                                 "PL",
+		"CÔTE D'IVOIRE":                          "CI",
+		"Korea, Democratic People's Republic of": "KP",
+		"South Korea":                            "KR",
+		"Netherlands Antilles":                   "AN",
+	} {
+		actual, ok := CountryCode(country)
+		require.True(t, ok, country)
+		require.Equal(t, code, actual, country)
+	}
+
+	for _, country := range []string{"", "XX", "Narnia", "Poland "} {
+		_, ok := CountryCode(country)
+		require.False(t, ok, country)
+	}
+}
@@ -2,64 +2,321 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/config"
+	"github.com/informalict/ports/pkg/health"
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/metrics"
+	"github.com/informalict/ports/pkg/ratelimit"
 	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/audit"
+	"github.com/informalict/ports/pkg/services/ports/file"
 	"github.com/informalict/ports/pkg/services/ports/memory"
 	"github.com/informalict/ports/pkg/services/ports/router"
-)
-
-// The below const params should be provided from processes' arguments.
-const (
-	// portsInMemory describes how many ports can be kept in memory simultaneously.
-	portsInMemory = 10
-	// initialInputFileName is a file with a initial input data.
-	initialInputFileName = "./assets/ports.json"
-	// addressApp for the server to listen on.
-	addressApp = ":8080"
+	"github.com/informalict/ports/pkg/services/ports/seed"
+	portsql "github.com/informalict/ports/pkg/services/ports/sql"
+	"github.com/informalict/ports/pkg/services/ports/webhook"
+	// Drivers for the SQL storage backend.
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	portService := memory.NewPortMemory()
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv, os.Stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fatal(slog.Default(), "invalid configuration", err)
+	}
+	// A level has been already validated with configuration.
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stderr, cfg.Log.Format, level)
+	slog.SetDefault(logger)
 	ctx := createSignalContext()
 
-	if err := readInitFile(ctx, portService); err != nil {
-		log.Fatal(err.Error())
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	httpMetrics, err := metrics.NewHTTP(registry)
+	if err != nil {
+		fatal(logger, "failed to register HTTP metrics", err)
+	}
+
+	storage, err := newPortService(ctx, cfg.Storage, logger)
+	if err != nil {
+		fatal(logger, "failed to create port's service", err)
+	}
+	portService, err := metrics.NewPortService(storage, registry)
+	if err != nil {
+		fatal(logger, "failed to register metrics of port's service", err)
+	}
+	auditSink, err := newAuditSink(cfg.Audit)
+	if err != nil {
+		fatal(logger, "failed to open audit sink", err)
+	}
+	if len(cfg.Audit.File) == 0 && cfg.Storage.Backend != config.StorageMemory {
+		// Previous revisions of ports which have been stored before are rejected with 409 as missing in history.
+		logger.Warn("audit events are kept in memory, so history of stored ports is lost on restart",
+			"backend", cfg.Storage.Backend)
+	}
+	// Changes are recorded outside of metrics, and updates are recorded through Modify, so they are observed
+	// as modify operations.
+	portService = audit.NewPortService(portService, auditSink, logger)
+
+	// The server listens before a seed file is loaded, and probes tell orchestrators when it is ready.
+	probes := health.New()
+	seedLoaded := health.NewGate("seed file is loading")
+	probes.AddStartup("seed", seedLoaded.Check)
+	if pinger, ok := portService.(ports.Pinger); ok {
+		probes.AddReadiness("storage", pinger.Ping)
+	}
+
+	routerOptions := router.Options{
+		MaxBodyBytes: cfg.Requests.MaxBodyBytes,
+		StrictJSON:   cfg.Requests.StrictJSON,
+	}
+	portRouter := router.NewPortRouter(portService, routerOptions, logger)
+	// Streams of changes never finish on their own, so they are closed when the server is shutting down.
+	watchesStopped, stopWatches := context.WithCancel(context.Background())
+	handler := http.NewServeMux()
+	handler.Handle("/", portRouter)
+	handler.Handle("/api/v1/ports:watch", closeOnShutdown(watchesStopped, portRouter))
+
+	// Webhooks get changes from the same watcher as streams, so they are sent only by storage backends
+	// which support watching. Decorators of a storage always implement ports.Watcher, so the storage is checked.
+	// Otherwise, the webhook router rejects subscriptions with 501.
+	var webhooks router.Webhooks
+	watcher, watchable := portService.(ports.Watcher)
+	if _, ok := storage.(ports.Watcher); ok && watchable {
+		dispatcher := webhook.NewDispatcher(watcher, webhook.DefaultOptions(router.EncodeWatchEvent), logger)
+		webhooks = dispatcher
+		go func() {
+			if err := dispatcher.Run(ctx); err != nil {
+				logger.Warn("webhooks are not sent", "error", err)
+			}
+		}()
+	} else {
+		logger.Info("webhooks are disabled, because storage backend does not support watching",
+			"backend", cfg.Storage.Backend)
+	}
+	webhookRouter := router.NewWebhookRouter(webhooks, routerOptions, logger)
+	handler.Handle("/api/v1/webhooks", webhookRouter)
+	handler.Handle("/api/v1/webhooks/", webhookRouter)
+	handler.Handle("/metrics", metrics.Route("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	handler.Handle("/healthz", metrics.Route("/healthz", probes.Liveness()))
+	handler.Handle("/readyz", metrics.Route("/readyz", probes.Readiness()))
+	handler.Handle("/startupz", metrics.Route("/startupz", probes.Startup()))
+
+	var portSeed *observedSeed
+	if len(cfg.Seed.File) > 0 {
+		seedMetrics, err := metrics.NewSeed(registry)
+		if err != nil {
+			fatal(logger, "failed to register seed metrics", err)
+		}
+
+		portSeed = &observedSeed{
+			Seed: seed.New(portService, seed.Options{
+				File:      cfg.Seed.File,
+				LoadMode:  cfg.Seed.LoadMode,
+				Normalize: router.NormalizePort,
+				Validate:  router.ValidatePort,
+				Removed:   cfg.Seed.Removed,
+				OnPort:    seedMetrics.ObservePort,
+			}),
+			metrics: seedMetrics,
+		}
+		// A reload waits until the first load is finished.
+		handler.Handle("/admin/", router.NewAdminRouter(portSeed, logger))
+	}
+
+	// Rate limits can be changed in configuration, and they are applied with SIGHUP, together with a seed file.
+	limiter := ratelimit.New(cfg.RateLimit)
+	reloadOnSignal(ctx, func() {
+		reloadRateLimits(logger, limiter)
+		if portSeed != nil {
+			reloadSeed(logger, portSeed)
+		}
+	})
+
+	// Authentication runs before audit.Middleware, so an authenticated caller is recorded as an actor of its changes
+	// instead of X-Actor header. Rate limiting runs after authentication, so clients are identified by subjects,
+	// and failed authentications are limited by IP addresses before authentication.
+	// X-Actor header is trusted only without authentication, so it can not forge actors of anonymous changes.
+	apiHandler := limiter.Middleware(router.RateLimitBudget, audit.Middleware(!cfg.Auth.Enabled(), handler))
+	if cfg.Auth.Enabled() {
+		authenticator, err := newAuthenticator(cfg.Auth, cfg.Requests.MaxBodyBytes)
+		if err != nil {
+			fatal(logger, "invalid authentication configuration", err)
+		}
+
+		apiHandler = auth.Middleware(auth.Options{
+			Authenticator: authenticator,
+			Required:      router.RequiredRole,
+			Anonymous:     cfg.Auth.AnonymousRole,
+			WithActor:     audit.WithActor,
+			Logger:        logger,
+		}, apiHandler)
+		apiHandler = limiter.FailedAuthMiddleware(apiHandler)
+	} else {
+		logger.Warn("authentication is disabled, so anyone can change ports")
 	}
 
 	// Start HTTP server.
 	srv := &http.Server{
-		Addr:              addressApp,
-		Handler:           router.NewPortRouter(portService),
-		ReadHeaderTimeout: 10 * time.Second,
+		Handler:           logging.Middleware(logger, httpMetrics.Middleware(apiHandler)),
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		ReadTimeout:       cfg.Timeouts.Read,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+	}
+	srv.RegisterOnShutdown(stopWatches)
+	listener, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		fatal(logger, "failed to listen", err)
 	}
 	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("failed to start server: %s", err)
+		if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "failed to serve", err)
 		}
 	}()
+	logger.Info("server is listening", "address", listener.Addr().String())
+
+	if portSeed != nil {
+		if err := readInitFile(ctx, logger, portSeed); err != nil {
+			fatal(logger, "failed to load initial input file", err)
+		}
+	} else {
+		logger.Info("no seed file is configured")
+	}
+	if ctx.Err() == nil {
+		seedLoaded.Open()
+		logger.Info("server is ready")
+	}
 
-	log.Println("server is ready")
 	// Wait until process gets signal SIGTERM.
 	select {
 	case <-ctx.Done():
 		// Perform actions for graceful shutdown.
-		timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
 		defer cancel()
 
 		if err := srv.Shutdown(timeoutCtx); err != nil {
-			log.Fatalf("failed to shutdown server: %s", err)
+			fatal(logger, "failed to shutdown server", err)
+		}
+
+		// Changes which have not been delivered yet are dropped.
+		if closer, ok := webhooks.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				fatal(logger, "failed to stop webhooks", err)
+			}
+		}
+
+		if closer, ok := portService.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				fatal(logger, "failed to close port's service", err)
+			}
 		}
 	}
 
 	return
 }
 
+// fatal logs an error which stops the server, and exits.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newPortService creates port's service for a given storage backend.
+func newPortService(ctx context.Context, storage config.Storage, logger *slog.Logger) (ports.PortService, error) {
+	switch storage.Backend {
+	case config.StorageMemory:
+		return memory.NewPortMemory(), nil
+	case config.StorageFile:
+		return file.NewPortFile(storage.DataDir, logger)
+	case config.StorageSQL:
+		return portsql.NewPortSQL(ctx, storage.SQL.Driver, storage.SQL.DSN)
+	default:
+		return nil, fmt.Errorf("unknown storage backend \"%s\"", storage.Backend)
+	}
+}
+
+// closeOnShutdown cancels requests which are in progress when a given context is canceled.
+func closeOnShutdown(shutdown context.Context, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stop := context.AfterFunc(shutdown, cancel)
+		defer stop()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newAuditSink creates a sink for audit events of port changes.
+func newAuditSink(cfg config.Audit) (audit.Sink, error) {
+	if len(cfg.File) == 0 {
+		return audit.NewMemorySink(), nil
+	}
+
+	return audit.NewFileSink(cfg.File)
+}
+
+// newAuthenticator creates an authenticator of all configured methods. Signed bodies, other than imports,
+// can not be larger than maxBodyBytes.
+func newAuthenticator(cfg config.Auth, maxBodyBytes int64) (auth.Authenticator, error) {
+	var chain auth.Chain
+	if len(cfg.APIKeys) > 0 {
+		apiKeys, err := auth.NewAPIKeys(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, apiKeys)
+	}
+
+	if len(cfg.HMACKeys) > 0 {
+		hmacKeys, err := auth.NewHMAC(cfg.HMACKeys, auth.HMACOptions{
+			MaxBodyBytes: maxBodyBytes,
+			Streamed:     router.StreamedBody,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, hmacKeys)
+	}
+
+	if len(cfg.JWT.JWKSFile) > 0 {
+		jwt, err := auth.NewJWT(auth.JWTOptions{
+			JWKSFile:  cfg.JWT.JWKSFile,
+			Issuer:    cfg.JWT.Issuer,
+			Audience:  cfg.JWT.Audience,
+			RoleClaim: cfg.JWT.RoleClaim,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jwt)
+	}
+
+	return chain, nil
+}
+
 // createSignalContext creates context which is canceled when SIGTERM occurs.
 func createSignalContext() context.Context {
 	sigChannel := make(chan os.Signal, 1)
@@ -79,45 +336,111 @@ func createSignalContext() context.Context {
 	return ctxCancel
 }
 
-// readInitFile reads data from fixed input file and populate them into port's service.
-func readInitFile(ctx context.Context, svc ports.PortService) error {
-	channel := make(chan ports.PortWithID, portsInMemory)
-
-	file, err := os.Open(initialInputFileName)
+// readInitFile reads data from a seed file and populate them into port's service.
+// Ports which already exist are skipped, because a persistent storage may have them changed through API.
+// Invalid ports are skipped in lenient load mode, and they stop loading in strict load mode.
+func readInitFile(ctx context.Context, logger *slog.Logger, portSeed *observedSeed) error {
+	report, err := portSeed.Load(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Initial file is not fully loaded, because of graceful shutdown.
+			return nil
+		}
+
 		return err
 	}
 
+	logFailures(logger, "initial input file", report)
+	if len(report.Failed) > 0 {
+		logger.Warn("invalid ports of initial input file are not served", "skipped", len(report.Failed))
+	}
+	logger.Info("initial input file is loaded",
+		"created", len(report.Created), "existing", len(report.Skipped), "skipped", len(report.Failed))
+
+	return nil
+}
+
+// reloadOnSignal calls reload every time when process gets signal SIGHUP, until a context is canceled.
+func reloadOnSignal(ctx context.Context, reload func()) {
+	sigChannel := make(chan os.Signal, 1)
+	signal.Notify(sigChannel, syscall.SIGHUP)
+
 	go func() {
+		defer signal.Stop(sigChannel)
+
 		for {
 			select {
 			case <-ctx.Done():
-				// Perform actions for graceful shutdown when initial file is not fully loaded.
 				return
-			case port, ok := <-channel:
-				if !ok {
-					// No data and channel is closed, so all data is fetched.
-					return
-				}
-
-				if err := svc.Create(ctx, port.ID, port.Port); err != nil {
-					if ctx.Err() != nil {
-						continue
-					}
-
-					// In real life scenario this case should be handled, and it should not end this process.
-					log.Fatalf("failed to add port \"%s\"", port.ID)
-				}
+			case <-sigChannel:
+				reload()
 			}
 		}
 	}()
+}
 
-	if err := ports.ReadPorts(ctx, file, channel); err != nil {
-		log.Fatal(err)
+// reloadRateLimits loads configuration again, and applies its rate limits. Other settings require a restart.
+func reloadRateLimits(logger *slog.Logger, limiter *ratelimit.Limiter) {
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv, io.Discard)
+	if err != nil {
+		logger.Error("failed to reload configuration", "error", err)
+		return
 	}
 
-	// All data is fetched from JSON file, so channel can be closed.
-	close(channel)
+	limiter.Update(cfg.RateLimit)
+	logger.Info("rate limits are reloaded", "read_rate", cfg.RateLimit.Read.Rate,
+		"read_burst", cfg.RateLimit.Read.Burst, "write_rate", cfg.RateLimit.Write.Rate,
+		"write_burst", cfg.RateLimit.Write.Burst, "failed_auth_rate", cfg.RateLimit.FailedAuth.Rate,
+		"failed_auth_burst", cfg.RateLimit.FailedAuth.Burst)
+}
 
-	return nil
+// reloadSeed applies changes of a seed file since it has been loaded last time.
+func reloadSeed(logger *slog.Logger, portSeed router.Reloader) {
+	// A reload is not canceled by graceful shutdown, so it is never left half-applied.
+	report, err := portSeed.Reload(context.Background())
+	if err != nil {
+		logger.Error("failed to reload seed file", "error", err)
+		return
+	}
+
+	logFailures(logger, "reloaded seed file", report)
+	logger.Info("seed file is reloaded", "created", len(report.Created), "updated", len(report.Updated),
+		"deleted", len(report.Deleted), "failed", len(report.Failed))
+}
+
+// observedSeed observes loads and reloads of a seed file in metrics.
+type observedSeed struct {
+	*seed.Seed
+	metrics *metrics.Seed
+}
+
+// Load creates ports from a seed file. Changes are recorded with audit.SeedActor.
+func (s *observedSeed) Load(ctx context.Context) (ports.ImportReport, error) {
+	report, err := s.Seed.Load(audit.WithActor(ctx, audit.SeedActor))
+	s.metrics.Observe(metrics.SeedLoad, report, err)
+
+	return report, err
+}
+
+// Reload applies changes of a seed file since it has been loaded last time. Changes are recorded with
+// audit.SeedActor.
+func (s *observedSeed) Reload(ctx context.Context) (ports.ImportReport, error) {
+	report, err := s.Seed.Reload(audit.WithActor(ctx, audit.SeedActor))
+	s.metrics.Observe(metrics.SeedReload, report, err)
+
+	return report, err
+}
+
+// logFailures logs ports from a seed file which have failed.
+func logFailures(logger *slog.Logger, source string, report ports.ImportReport) {
+	for _, failure := range report.Failed {
+		var readErr *ports.ReadError
+		if errors.As(failure.Err, &readErr) {
+			logger.Warn("invalid port is skipped", "source", source, "port_id", readErr.ID,
+				"line", readErr.Line, "offset", readErr.Offset, "error", readErr.Err)
+			continue
+		}
+
+		logger.Warn("port is skipped", "source", source, "port_id", failure.ID, "error", failure.Err)
+	}
 }
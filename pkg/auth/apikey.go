@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIKeyHeader is a header with a static API key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a static key of a caller.
+type APIKey struct {
+	// Key is a secret which is sent in APIKeyHeader.
+	Key string `yaml:"key"`
+	// Subject is a name of a caller.
+	Subject string `yaml:"subject"`
+	// Role describes what a caller is allowed to do.
+	Role Role `yaml:"role"`
+}
+
+// apiKeys authenticates requests with static API keys.
+type apiKeys struct {
+	// identities are callers by hashes of their keys, so keys are not compared byte by byte.
+	identities map[[sha256.Size]byte]Identity
+}
+
+// NewAPIKeys returns an authenticator of requests with static API keys in APIKeyHeader.
+func NewAPIKeys(keys []APIKey) (Authenticator, error) {
+	a := &apiKeys{identities: make(map[[sha256.Size]byte]Identity, len(keys))}
+	for _, key := range keys {
+		if len(key.Key) == 0 || len(key.Subject) == 0 {
+			return nil, errors.New("API key and its subject can not be empty")
+		}
+		if !key.Role.Valid() {
+			return nil, fmt.Errorf("unknown role \"%s\" of API key of %s", key.Role, key.Subject)
+		}
+
+		hash := sha256.Sum256([]byte(key.Key))
+		if _, ok := a.identities[hash]; ok {
+			return nil, fmt.Errorf("API key of %s is duplicated", key.Subject)
+		}
+		a.identities[hash] = Identity{Subject: key.Subject, Role: key.Role, Method: "api-key"}
+	}
+
+	return a, nil
+}
+
+func (a *apiKeys) Authenticate(r *http.Request) (Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if len(key) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+
+	identity, ok := a.identities[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return identity, nil
+}
+
+// Challenge returns nothing, because API keys are not an HTTP authentication scheme.
+func (a *apiKeys) Challenge() string {
+	return ""
+}
@@ -0,0 +1,196 @@
+// Package auth authenticates requests to the ports server and authorizes them by roles.
+//
+// A request is authenticated with a static API key, an HMAC signature or a JWT, and the identified caller has
+// a role. Roles are ordered, so a role is allowed to do everything which lower roles are allowed to do:
+// readers only read, editors also create and update, and admins also import and delete.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/informalict/ports/pkg/problem"
+)
+
+var (
+	// ErrNoCredentials is returned by Authenticator when a request does not carry its kind of credentials,
+	// so another authenticator can be tried.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned by Authenticator when a request carries credentials which are not valid.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Role describes what a caller is allowed to do.
+type Role string
+
+const (
+	// RoleNone is not allowed to do anything, and it is required by public endpoints.
+	RoleNone Role = ""
+	// RoleReader is allowed to read ports.
+	RoleReader Role = "reader"
+	// RoleEditor is allowed to read, create and update ports.
+	RoleEditor Role = "editor"
+	// RoleAdmin is allowed to do everything, including imports and deletions.
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders roles from the lowest one.
+var roleRanks = map[Role]int{
+	RoleNone:   0,
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Valid checks whether a role is known. RoleNone is valid as well.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Allows checks whether a role is allowed to do what a required role is allowed to do.
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRanks[r]
+
+	return ok && rank >= roleRanks[required]
+}
+
+// Identity describes an authenticated caller.
+type Identity struct {
+	// Subject is a name of a caller, which is recorded as an actor of its changes.
+	Subject string
+	// Role describes what a caller is allowed to do.
+	Role Role
+	// Method is a name of an authentication method.
+	Method string
+}
+
+// Authenticator identifies a caller of a request.
+type Authenticator interface {
+	// Authenticate returns a caller's identity. ErrNoCredentials is returned when a request does not carry
+	// credentials of this authenticator, and an error which wraps ErrInvalidCredentials when they are not valid.
+	Authenticate(r *http.Request) (Identity, error)
+	// Challenge returns a value of WWW-Authenticate header for this authenticator, or an empty string.
+	Challenge() string
+}
+
+// Chain authenticates a request with the first authenticator whose credentials are carried by the request.
+type Chain []Authenticator
+
+// Authenticate returns a caller's identity from the first authenticator which does not return ErrNoCredentials.
+func (c Chain) Authenticate(r *http.Request) (Identity, error) {
+	for _, authenticator := range c {
+		identity, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+
+		return identity, err
+	}
+
+	return Identity{}, ErrNoCredentials
+}
+
+// Challenge returns challenges of all authenticators.
+func (c Chain) Challenge() string {
+	challenges := make([]string, 0, len(c))
+	for _, authenticator := range c {
+		if challenge := authenticator.Challenge(); len(challenge) > 0 {
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return strings.Join(challenges, ", ")
+}
+
+// identityKey is a key of a caller's identity in a context.
+type identityKey struct{}
+
+// WithIdentity returns a context of a request which has been made by an authenticated caller.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns an identity of an authenticated caller from a request's context.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Options describes how requests are authenticated and authorized.
+type Options struct {
+	// Authenticator identifies callers.
+	Authenticator Authenticator
+	// Required returns a role which is required for a request. RoleNone means that a request is public.
+	Required func(r *http.Request) Role
+	// Anonymous is a role of requests without credentials. RoleNone rejects them unless they are public.
+	Anonymous Role
+	// WithActor returns a context whose changes are recorded with a caller's subject. It is optional.
+	WithActor func(ctx context.Context, actor string) context.Context
+	// Logger logs failed authentications.
+	Logger *slog.Logger
+}
+
+// Middleware authenticates every request which is not public, and checks whether a caller has a required role.
+// 401 is returned when a request does not carry valid credentials, 413 when its body is too large to be verified,
+// and 403 when a caller's role is too low.
+func Middleware(options Options, next http.Handler) http.Handler {
+	challenge := options.Authenticator.Challenge()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := options.Required(r)
+		if required == RoleNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, err := options.Authenticator.Authenticate(r)
+		if r.Body != nil {
+			// An authenticator may replace a body with its verified copy, which is released here.
+			defer r.Body.Close()
+		}
+		if errors.Is(err, ErrNoCredentials) {
+			if options.Anonymous.Allows(required) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			unauthorized(w, r, challenge, "authentication is required")
+			return
+		} else if errors.Is(err, ErrBodyTooLarge) {
+			options.Logger.WarnContext(r.Context(), "authentication has failed", "error", err)
+			problem.Error(w, r, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			options.Logger.WarnContext(r.Context(), "authentication has failed", "error", err)
+			unauthorized(w, r, challenge, ErrInvalidCredentials.Error())
+			return
+		}
+
+		if !identity.Role.Allows(required) {
+			options.Logger.WarnContext(r.Context(), "caller is not allowed", "subject", identity.Subject,
+				"role", identity.Role, "required_role", required)
+			problem.Error(w, r, fmt.Sprintf("role %s is required", required), http.StatusForbidden)
+			return
+		}
+
+		ctx := WithIdentity(r.Context(), identity)
+		if options.WithActor != nil {
+			ctx = options.WithActor(ctx, identity.Subject)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// unauthorized responds with 401 and challenges of authenticators.
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge, message string) {
+	if len(challenge) > 0 {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	problem.Error(w, r, message, http.StatusUnauthorized)
+}
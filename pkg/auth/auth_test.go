@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/logging"
+)
+
+// actorKey is a key of an actor in a context of tests.
+type actorKey struct{}
+
+// requiredRole requires RoleReader for GET, RoleAdmin for DELETE and RoleEditor for other methods.
+// Paths starting with `/public` do not require any role.
+func requiredRole(r *http.Request) Role {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/public"):
+		return RoleNone
+	case r.Method == http.MethodGet:
+		return RoleReader
+	case r.Method == http.MethodDelete:
+		return RoleAdmin
+	default:
+		return RoleEditor
+	}
+}
+
+// newServer returns a server which responds with an actor and a body of a request.
+func newServer(t *testing.T, authenticator Authenticator, anonymous Role) *httptest.Server {
+	handler := Middleware(Options{
+		Authenticator: authenticator,
+		Required:      requiredRole,
+		Anonymous:     anonymous,
+		WithActor: func(ctx context.Context, actor string) context.Context {
+			return context.WithValue(ctx, actorKey{}, actor)
+		},
+		Logger: logging.Discard(),
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, _ := r.Context().Value(actorKey{}).(string)
+		identity, _ := FromContext(r.Context())
+		require.Equal(t, actor, identity.Subject)
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		_, _ = w.Write([]byte(actor + ":" + string(body)))
+	}))
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// do sends a request with a given header, and returns a status and a body of a response.
+func do(t *testing.T, server *httptest.Server, method, path string, header http.Header, body string) (int, string) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body)) // nolint: noctx
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	return send(t, server, req)
+}
+
+// send sends a request, and returns a status and a body of a response, or a detail of a problem.
+func send(t *testing.T, server *httptest.Server, req *http.Request) (int, string) {
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") == api.ProblemContentType {
+		var p api.Problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+		require.Equal(t, resp.StatusCode, p.Status)
+
+		return resp.StatusCode, p.Detail
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestAPIKeys(t *testing.T) { // nolint: funlen
+	apiKeys, err := NewAPIKeys([]APIKey{
+		{Key: "reader-key", Subject: "dashboard", Role: RoleReader},
+		{Key: "editor-key", Subject: "ci", Role: RoleEditor},
+		{Key: "admin-key", Subject: "ops", Role: RoleAdmin},
+	})
+	require.NoError(t, err)
+	server := newServer(t, apiKeys, RoleNone)
+	key := func(key string) http.Header {
+		return http.Header{APIKeyHeader: {key}}
+	}
+
+	passed := t.Run("roles", func(t *testing.T) {
+		tests := []struct {
+			method, key string
+			status      int
+		}{
+			{http.MethodGet, "reader-key", http.StatusOK},
+			{http.MethodPost, "reader-key", http.StatusForbidden},
+			{http.MethodPut, "editor-key", http.StatusOK},
+			{http.MethodDelete, "editor-key", http.StatusForbidden},
+			{http.MethodDelete, "admin-key", http.StatusOK},
+			{http.MethodGet, "admin-key", http.StatusOK},
+		}
+		for _, test := range tests {
+			status, _ := do(t, server, test.method, "/ports", key(test.key), "")
+			assert.Equal(t, test.status, status, "%s with %s", test.method, test.key)
+		}
+
+		status, body := do(t, server, http.MethodPost, "/ports", key("reader-key"), "")
+		require.Equal(t, http.StatusForbidden, status)
+		require.Equal(t, "role editor is required", body)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("subject is an actor", func(t *testing.T) {
+		status, body := do(t, server, http.MethodPost, "/ports", key("editor-key"), "port")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "ci:port", body)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("missing or invalid key", func(t *testing.T) {
+		status, body := do(t, server, http.MethodGet, "/ports", nil, "")
+		require.Equal(t, http.StatusUnauthorized, status)
+		require.Equal(t, "authentication is required", body)
+
+		status, body = do(t, server, http.MethodGet, "/ports", key("unknown-key"), "")
+		require.Equal(t, http.StatusUnauthorized, status)
+		require.Equal(t, "invalid credentials", body)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("public and anonymous requests", func(t *testing.T) {
+		status, body := do(t, server, http.MethodPost, "/public", nil, "probe")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, ":probe", body)
+
+		anonymous := newServer(t, apiKeys, RoleReader)
+		status, _ = do(t, anonymous, http.MethodGet, "/ports", nil, "")
+		require.Equal(t, http.StatusOK, status)
+		status, _ = do(t, anonymous, http.MethodPost, "/ports", nil, "")
+		require.Equal(t, http.StatusUnauthorized, status, "anonymous request must authenticate for a higher role")
+		status, _ = do(t, anonymous, http.MethodGet, "/ports", key("unknown-key"), "")
+		require.Equal(t, http.StatusUnauthorized, status, "invalid credentials must not fall back to anonymous role")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid keys", func(t *testing.T) {
+		_, err := NewAPIKeys([]APIKey{{Key: "key", Subject: "ci", Role: "owner"}})
+		require.ErrorContains(t, err, "owner")
+		_, err = NewAPIKeys([]APIKey{{Key: "key", Role: RoleReader}})
+		require.Error(t, err)
+		_, err = NewAPIKeys([]APIKey{{Key: "key", Subject: "a", Role: RoleReader}, {Key: "key", Subject: "b"}})
+		require.ErrorContains(t, err, "duplicated")
+	})
+	require.True(t, passed)
+}
+
+func TestHMAC(t *testing.T) { // nolint: funlen
+	// Signed bodies can not be larger than 16 bytes, unless they are streamed. Streamed bodies are kept
+	// in temporary files, which must be removed.
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	hmacKeys, err := NewHMAC(
+		[]HMACKey{{ID: "importer", Secret: "shared secret", Subject: "importer", Role: RoleAdmin}},
+		HMACOptions{MaxBodyBytes: 16, Streamed: func(r *http.Request) bool { return r.URL.Path == "/stream" }})
+	require.NoError(t, err)
+	apiKeys, err := NewAPIKeys([]APIKey{{Key: "reader-key", Subject: "dashboard", Role: RoleReader}})
+	require.NoError(t, err)
+	server := newServer(t, Chain{apiKeys, hmacKeys}, RoleNone)
+
+	// signed returns a request which is signed with a given key at a given time.
+	signed := func(t *testing.T, method, path, body, keyID, secret string, at time.Time) *http.Request {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body)) // nolint: noctx
+		require.NoError(t, err)
+		require.NoError(t, SignRequest(req, keyID, secret, at))
+
+		return req
+	}
+
+	passed := t.Run("signed request", func(t *testing.T) {
+		status, body := send(t, server, signed(t, http.MethodPost, "/ports?mode=upsert", "ports", "importer",
+			"shared secret", time.Now()))
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "importer:ports", body, "body must be readable after it has been verified")
+
+		status, _ = send(t, server, signed(t, http.MethodDelete, "/ports/PLGDN", "", "importer", "shared secret",
+			time.Now().Add(-time.Minute)))
+		require.Equal(t, http.StatusOK, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("bodies", func(t *testing.T) {
+		req := signed(t, http.MethodPost, "/ports", "ports", "importer", "shared secret", time.Now())
+		req.Header.Del(ContentSHA256Header)
+		status, body := send(t, server, req)
+		require.Equal(t, http.StatusOK, status, "hash header is optional")
+		require.Equal(t, "importer:ports", body)
+
+		large := strings.Repeat("ports", 10)
+		status, body = send(t, server, signed(t, http.MethodPost, "/ports", large, "importer", "shared secret",
+			time.Now()))
+		require.Equal(t, http.StatusRequestEntityTooLarge, status)
+		require.Equal(t, "body is too large to be verified: signed body is larger than 16 bytes", body)
+
+		status, body = send(t, server, signed(t, http.MethodPost, "/stream", large, "importer", "shared secret",
+			time.Now()))
+		require.Equal(t, http.StatusOK, status, "streamed body is not limited")
+		require.Equal(t, "importer:"+large, body)
+
+		files, err := os.ReadDir(tempDir)
+		require.NoError(t, err)
+		require.Empty(t, files, "streamed body must be removed")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid signatures", func(t *testing.T) {
+		// tampered returns a signed request whose body is changed, so a handler must not be called.
+		tampered := func(path string, withHash bool) *http.Request {
+			req := signed(t, http.MethodPost, path, "ports", "importer", "shared secret", time.Now())
+			if !withHash {
+				req.Header.Del(ContentSHA256Header)
+			}
+			req.Body = io.NopCloser(strings.NewReader("other ports"))
+			req.ContentLength = int64(len("other ports"))
+
+			return req
+		}
+
+		otherHash := signed(t, http.MethodPost, "/ports", "ports", "importer", "shared secret", time.Now())
+		otherHash.Header.Set(ContentSHA256Header, strings.Repeat("0", 64))
+
+		otherPath := signed(t, http.MethodPost, "/ports", "ports", "importer", "shared secret", time.Now())
+		otherPath.URL.Path = "/ports/other"
+
+		requests := map[string]*http.Request{
+			"tampered body":           tampered("/ports", false),
+			"tampered body with hash": tampered("/ports", true),
+			"tampered streamed body":  tampered("/stream", true),
+			"other hash":              otherHash,
+			"other path":              otherPath,
+			"wrong secret":            signed(t, http.MethodPost, "/ports", "", "importer", "other secret", time.Now()),
+			"unknown key":             signed(t, http.MethodPost, "/ports", "", "exporter", "shared secret", time.Now()),
+			"expired": signed(t, http.MethodPost, "/ports", "", "importer", "shared secret",
+				time.Now().Add(-MaxHMACSkew-time.Minute)),
+		}
+		for name, req := range requests {
+			status, body := send(t, server, req)
+			assert.Equal(t, http.StatusUnauthorized, status, name)
+			assert.Equal(t, "invalid credentials", body, name)
+		}
+
+		files, err := os.ReadDir(tempDir)
+		require.NoError(t, err)
+		require.Empty(t, files, "rejected streamed body must be removed")
+
+		incomplete := http.Header{"Authorization": {"HMAC-SHA256 keyId=importer"}}
+		status, _ := do(t, server, http.MethodGet, "/ports", incomplete, "")
+		require.Equal(t, http.StatusUnauthorized, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("challenges of chain", func(t *testing.T) {
+		resp, err := server.Client().Get(server.URL + "/ports") // nolint: noctx
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.Equal(t, HMACScheme, resp.Header.Get("WWW-Authenticate"))
+
+		status, body := do(t, server, http.MethodGet, "/ports", http.Header{APIKeyHeader: {"reader-key"}}, "")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "dashboard:", body)
+	})
+	require.True(t, passed)
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HMACScheme is a scheme of Authorization header of signed requests:
+	// `HMAC-SHA256 keyId=<ID>, timestamp=<Unix time in seconds>, signature=<hex-encoded signature>`.
+	HMACScheme = "HMAC-SHA256"
+	// MaxHMACSkew is the longest difference between time of a signature and the server's time, so a signed request
+	// can not be replayed later.
+	MaxHMACSkew = 5 * time.Minute
+	// ContentSHA256Header carries hex-encoded SHA-256 of a signed body. It is optional, and a body is checked
+	// against it together with a signature.
+	ContentSHA256Header = "X-Content-SHA256"
+	// DefaultMaxSignedBodyBytes is a default limit of a size of a signed body which is read into memory.
+	DefaultMaxSignedBodyBytes = 1 << 20
+)
+
+// ErrBodyTooLarge is returned by an authenticator when a body of a request is too large to be verified.
+var ErrBodyTooLarge = errors.New("body is too large to be verified")
+
+// HMACKey is a shared secret of a caller which signs its requests.
+type HMACKey struct {
+	// ID identifies a key in a signature.
+	ID string `yaml:"id"`
+	// Secret is a key of HMAC-SHA256.
+	Secret string `yaml:"secret"`
+	// Subject is a name of a caller.
+	Subject string `yaml:"subject"`
+	// Role describes what a caller is allowed to do.
+	Role Role `yaml:"role"`
+}
+
+// HMACOptions describes how bodies of signed requests are verified.
+type HMACOptions struct {
+	// MaxBodyBytes limits a size of a signed body, which is read into memory and verified before a handler reads
+	// it. DefaultMaxSignedBodyBytes is used when it is zero.
+	MaxBodyBytes int64
+	// Streamed returns whether a handler streams a request's body, e.g. an import. Such a body is not limited, and
+	// it is written to a temporary file until it is verified, so a handler never reads a body which is not signed.
+	// It is optional.
+	Streamed func(r *http.Request) bool
+}
+
+// hmacKeys authenticates signed requests.
+type hmacKeys struct {
+	keys    map[string]HMACKey
+	options HMACOptions
+	now     func() time.Time
+}
+
+// NewHMAC returns an authenticator of requests which are signed with SignRequest. A signed body is replaced
+// with its verified copy, and Middleware closes it when a request is handled.
+func NewHMAC(keys []HMACKey, options HMACOptions) (Authenticator, error) {
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = DefaultMaxSignedBodyBytes
+	}
+
+	a := &hmacKeys{keys: make(map[string]HMACKey, len(keys)), options: options, now: time.Now}
+	for _, key := range keys {
+		if len(key.ID) == 0 || len(key.Secret) == 0 || len(key.Subject) == 0 {
+			return nil, errors.New("HMAC key's ID, secret and subject can not be empty")
+		}
+		if !key.Role.Valid() {
+			return nil, fmt.Errorf("unknown role \"%s\" of HMAC key \"%s\"", key.Role, key.ID)
+		}
+		if _, ok := a.keys[key.ID]; ok {
+			return nil, fmt.Errorf("HMAC key \"%s\" is duplicated", key.ID)
+		}
+		a.keys[key.ID] = key
+	}
+
+	return a, nil
+}
+
+func (a *hmacKeys) Authenticate(r *http.Request) (Identity, error) {
+	scheme, params, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, HMACScheme) {
+		return Identity{}, ErrNoCredentials
+	}
+
+	keyID, timestamp, signature, err := parseHMACParams(params)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	key, ok := a.keys[keyID]
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: unknown HMAC key \"%s\"", ErrInvalidCredentials, keyID)
+	}
+
+	if skew := a.now().Sub(time.Unix(timestamp, 0)).Abs(); skew > MaxHMACSkew {
+		return Identity{}, fmt.Errorf("%w: signature of HMAC key \"%s\" has expired", ErrInvalidCredentials, keyID)
+	}
+
+	// A whole body is hashed before a handler reads it, so a handler never acts on a body which is not signed.
+	var bodyHash []byte
+	if a.options.Streamed != nil && a.options.Streamed(r) {
+		bodyHash, err = spoolBody(r)
+	} else {
+		bodyHash, err = hashBody(r, a.options.MaxBodyBytes)
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if err := checkDeclaredHash(r, bodyHash); err != nil {
+		return Identity{}, err
+	}
+
+	expected := sign(r, key.Secret, timestamp, bodyHash)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return Identity{}, fmt.Errorf("%w: invalid signature of HMAC key \"%s\"", ErrInvalidCredentials, keyID)
+	}
+
+	return Identity{Subject: key.Subject, Role: key.Role, Method: "hmac"}, nil
+}
+
+func (a *hmacKeys) Challenge() string {
+	return HMACScheme
+}
+
+// parseHMACParams parses parameters of HMACScheme in Authorization header.
+func parseHMACParams(params string) (keyID string, timestamp int64, signature string, err error) {
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "keyId":
+			keyID = value
+		case "timestamp":
+			if timestamp, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return "", 0, "", fmt.Errorf("%w: invalid timestamp of signature", ErrInvalidCredentials)
+			}
+		case "signature":
+			signature = value
+		}
+	}
+
+	if len(keyID) == 0 || timestamp == 0 || len(signature) == 0 {
+		return "", 0, "", fmt.Errorf("%w: keyId, timestamp and signature are required", ErrInvalidCredentials)
+	}
+
+	return keyID, timestamp, signature, nil
+}
+
+// SignRequest signs a request with a given key at a given time, and sets its Authorization header.
+// A signature covers the time, request's method, path with a query and a body. Hash of the body is sent
+// in ContentSHA256Header as well.
+func SignRequest(r *http.Request, keyID, secret string, at time.Time) error {
+	bodyHash, err := hashBody(r, 0)
+	if err != nil {
+		return err
+	}
+
+	timestamp := at.Unix()
+	r.Header.Set(ContentSHA256Header, hex.EncodeToString(bodyHash))
+	r.Header.Set("Authorization", fmt.Sprintf("%s keyId=%s, timestamp=%d, signature=%s",
+		HMACScheme, keyID, timestamp, sign(r, secret, timestamp, bodyHash)))
+
+	return nil
+}
+
+// sign returns a hex-encoded HMAC-SHA256 of a request: time, method, path with a query and hex-encoded SHA-256
+// of a body, separated by new lines.
+func sign(r *http.Request, secret string, timestamp int64, bodyHash []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s", timestamp, r.Method, r.URL.RequestURI(), hex.EncodeToString(bodyHash))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkDeclaredHash checks SHA-256 of a body against ContentSHA256Header, when it is set.
+func checkDeclaredHash(r *http.Request, bodyHash []byte) error {
+	value := r.Header.Get(ContentSHA256Header)
+	if len(value) == 0 {
+		return nil
+	}
+
+	declared, err := hex.DecodeString(value)
+	if err != nil || !hmac.Equal(declared, bodyHash) {
+		return fmt.Errorf("%w: body does not match %s header", ErrInvalidCredentials, ContentSHA256Header)
+	}
+
+	return nil
+}
+
+// hashBody returns SHA-256 of a body. The body is read into memory, and it is replaced, so it can be read again.
+// A body can not be larger than maxBytes, unless it is zero.
+func hashBody(r *http.Request, maxBytes int64) ([]byte, error) {
+	bodyHash := sha256.New()
+	if r.Body == nil || r.Body == http.NoBody {
+		return bodyHash.Sum(nil), nil
+	}
+
+	var reader io.Reader = r.Body
+	if maxBytes > 0 {
+		reader = io.LimitReader(r.Body, maxBytes+1)
+	}
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed request: %w", err)
+	}
+	if maxBytes > 0 && int64(len(b)) > maxBytes {
+		return nil, fmt.Errorf("%w: signed body is larger than %d bytes", ErrBodyTooLarge, maxBytes)
+	}
+
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	bodyHash.Write(b)
+
+	return bodyHash.Sum(nil), nil
+}
+
+// spoolBody returns SHA-256 of a body. The body is written to a temporary file, and it is replaced with the file,
+// which is removed when the body is closed.
+func spoolBody(r *http.Request) ([]byte, error) {
+	bodyHash := sha256.New()
+	if r.Body == nil || r.Body == http.NoBody {
+		return bodyHash.Sum(nil), nil
+	}
+
+	f, err := os.CreateTemp("", "signed-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file of signed body: %w", err)
+	}
+	spooled := &spooledBody{File: f}
+
+	if _, err := io.Copy(io.MultiWriter(f, bodyHash), r.Body); err != nil {
+		spooled.Close()
+		return nil, fmt.Errorf("failed to read signed request: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, fmt.Errorf("failed to rewind signed body: %w", err)
+	}
+
+	r.Body.Close()
+	r.Body = spooled
+
+	return bodyHash.Sum(nil), nil
+}
+
+// spooledBody is a body in a temporary file, which is removed when the body is closed.
+type spooledBody struct {
+	*os.File
+}
+
+func (b *spooledBody) Close() error {
+	return errors.Join(b.File.Close(), os.Remove(b.File.Name()))
+}
@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRoleClaim is a claim with a caller's role, when another one is not configured.
+	DefaultRoleClaim = "role"
+	// jwtLeeway is the longest difference between the server's time and an issuer's time.
+	jwtLeeway = 30 * time.Second
+)
+
+// JWTOptions describes which tokens are accepted.
+type JWTOptions struct {
+	// JWKSFile is a path to a JSON Web Key Set with public keys of an issuer.
+	JWKSFile string
+	// Issuer must be equal to `iss` claim when it is not empty.
+	Issuer string
+	// Audience must be one of `aud` claim when it is not empty.
+	Audience string
+	// RoleClaim is a claim with a role, or a list of roles whose highest one is taken. DefaultRoleClaim is used
+	// when it is empty.
+	RoleClaim string
+}
+
+// jwk is a public key in a JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verificationKey is a parsed public key.
+type verificationKey struct {
+	// alg is an algorithm of a key, which is checked against token's algorithm when it is not empty.
+	alg string
+	key crypto.PublicKey
+}
+
+// jwtVerifier authenticates requests with bearer tokens which are signed by keys from a JWKS file.
+type jwtVerifier struct {
+	options JWTOptions
+	keys    map[string]verificationKey
+	now     func() time.Time
+}
+
+// NewJWT returns an authenticator of requests with JWTs in Authorization header, which are signed with RS*, PS*,
+// ES* or EdDSA algorithm by keys from a JWKS file. Tokens must have `exp` and `sub` claims.
+func NewJWT(options JWTOptions) (Authenticator, error) {
+	if len(options.RoleClaim) == 0 {
+		options.RoleClaim = DefaultRoleClaim
+	}
+
+	b, err := os.ReadFile(options.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file \"%s\": %w", options.JWKSFile, err)
+	}
+
+	v := &jwtVerifier{options: options, keys: make(map[string]verificationKey, len(set.Keys)), now: time.Now}
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key \"%s\" in JWKS file \"%s\": %w", k.Kid, options.JWKSFile, err)
+		}
+		if _, ok := v.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("key \"%s\" is duplicated in JWKS file \"%s\"", k.Kid, options.JWKSFile)
+		}
+		v.keys[k.Kid] = verificationKey{alg: k.Alg, key: key}
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("JWKS file \"%s\" does not have any signing key", options.JWKSFile)
+	}
+
+	return v, nil
+}
+
+// parseJWK parses a public RSA, EC or Ed25519 key.
+func parseJWK(k jwk) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve \"%s\"", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("only Ed25519 keys are supported")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type \"%s\"", k.Kty)
+	}
+}
+
+// curves are supported curves of EC keys.
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// decodeBigInt decodes a base64url-encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url-encoded integer")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (v *jwtVerifier) Authenticate(r *http.Request) (Identity, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return Identity{}, ErrNoCredentials
+	}
+
+	claims, err := v.verify(strings.TrimSpace(token))
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if len(subject) == 0 {
+		return Identity{}, fmt.Errorf("%w: token does not have a subject", ErrInvalidCredentials)
+	}
+
+	return Identity{Subject: subject, Role: highestRole(claims[v.options.RoleClaim]), Method: "jwt"}, nil
+}
+
+func (v *jwtVerifier) Challenge() string {
+	return "Bearer"
+}
+
+// verify checks a signature and registered claims of a compact JWT, and returns its claims.
+func (v *jwtVerifier) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	key, ok := v.keys[header.Kid]
+	if !ok && len(header.Kid) == 0 && len(v.keys) == 1 {
+		// A token does not have to identify a key when there is only one.
+		for _, k := range v.keys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key \"%s\"", header.Kid)
+	}
+	if len(key.alg) > 0 && key.alg != header.Alg {
+		return nil, fmt.Errorf("algorithm %s does not match key \"%s\"", header.Alg, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	if err := verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	return claims, v.validateClaims(claims)
+}
+
+// validateClaims checks time, an issuer and an audience of a token.
+func (v *jwtVerifier) validateClaims(claims map[string]interface{}) error {
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token does not have an expiration time")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+
+	if len(v.options.Issuer) > 0 && claims["iss"] != v.options.Issuer {
+		return errors.New("token has another issuer")
+	}
+
+	if len(v.options.Audience) > 0 {
+		audience := claims["aud"]
+		if list, ok := audience.([]interface{}); ok {
+			for _, a := range list {
+				if a == v.options.Audience {
+					audience = a
+					break
+				}
+			}
+		}
+		if audience != v.options.Audience {
+			return errors.New("token is meant for another audience")
+		}
+	}
+
+	return nil
+}
+
+// algorithms are hashes of supported algorithms except EdDSA.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// verifySignature verifies a signature of a signing input with a given algorithm and a public key.
+func verifySignature(alg string, key crypto.PublicKey, input, signature []byte) error {
+	var valid bool
+	if alg == "EdDSA" {
+		k, ok := key.(ed25519.PublicKey)
+		valid = ok && ed25519.Verify(k, input, signature)
+	} else {
+		hash, ok := algorithms[alg]
+		if !ok {
+			return fmt.Errorf("unsupported algorithm \"%s\"", alg)
+		}
+		h := hash.New()
+		h.Write(input)
+		digest := h.Sum(nil)
+
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") {
+				valid = rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+			} else if strings.HasPrefix(alg, "PS") {
+				valid = rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+			}
+		case *ecdsa.PublicKey:
+			// A signature is a concatenation of fixed-size R and S.
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if strings.HasPrefix(alg, "ES") && len(signature) == 2*size {
+				r := new(big.Int).SetBytes(signature[:size])
+				s := new(big.Int).SetBytes(signature[size:])
+				valid = ecdsa.Verify(k, digest, r, s)
+			}
+		}
+	}
+
+	if !valid {
+		return errors.New("invalid token signature")
+	}
+
+	return nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token.
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// highestRole returns a role from a claim, which is a single role or a list of roles. Unknown roles are ignored.
+func highestRole(claim interface{}) Role {
+	values, ok := claim.([]interface{})
+	if !ok {
+		values = []interface{}{claim}
+	}
+
+	highest := RoleNone
+	for _, value := range values {
+		if name, ok := value.(string); ok && Role(name).Valid() && Role(name).Allows(highest) {
+			highest = Role(name)
+		}
+	}
+
+	return highest
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signingKeys are private keys of an issuer of tokens in tests.
+type signingKeys struct {
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+// newSigningKeys generates keys, and writes their public keys to a JWKS file.
+func newSigningKeys(t *testing.T) (signingKeys, string) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa", "alg": "RS256", "use": "sig",
+			"n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.Bytes()), "y": encode(ecKey.Y.Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": encode(edKey.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	b, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	return signingKeys{rsa: rsaKey, ecdsa: ecKey, ed25519: edKey}, path
+}
+
+// token returns a compact JWT which is signed with a given algorithm.
+func (k signingKeys) token(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	encodeJSON := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if len(kid) > 0 {
+		header["kid"] = kid
+	}
+	input := encodeJSON(header) + "." + encodeJSON(claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, k.rsa, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ecdsa, digest[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case "EdDSA":
+		signature = ed25519.Sign(k.ed25519, []byte(input))
+	}
+	require.NoError(t, err)
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWT(t *testing.T) { // nolint: funlen
+	keys, path := newSigningKeys(t)
+	verifier, err := NewJWT(JWTOptions{JWKSFile: path, Issuer: "https://issuer", Audience: "ports"})
+	require.NoError(t, err)
+
+	// claims returns valid claims with given changes.
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":  "alice",
+			"iss":  "https://issuer",
+			"aud":  []string{"other", "ports"},
+			"exp":  time.Now().Add(time.Hour).Unix(),
+			"role": "editor",
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+				continue
+			}
+			c[name] = value
+		}
+		return c
+	}
+
+	authenticate := func(token string) (Identity, error) {
+		req, err := http.NewRequest(http.MethodGet, "/ports", nil) // nolint: noctx
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return verifier.Authenticate(req)
+	}
+
+	passed := t.Run("valid tokens", func(t *testing.T) {
+		tokens := map[string]string{
+			"RS256": keys.token(t, "RS256", "rsa", claims(nil)),
+			"ES256": keys.token(t, "ES256", "ec", claims(nil)),
+			"EdDSA": keys.token(t, "EdDSA", "ed", claims(map[string]interface{}{"aud": "ports"})),
+		}
+		for alg, token := range tokens {
+			identity, err := authenticate(token)
+			if assert.NoError(t, err, alg) {
+				assert.Equal(t, Identity{Subject: "alice", Role: RoleEditor, Method: "jwt"}, identity, alg)
+			}
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("highest role", func(t *testing.T) {
+		identity, err := authenticate(keys.token(t, "ES256", "ec", claims(map[string]interface{}{
+			"role": []string{"reader", "owner", "admin"},
+		})))
+		require.NoError(t, err)
+		require.Equal(t, RoleAdmin, identity.Role)
+
+		identity, err = authenticate(keys.token(t, "ES256", "ec", claims(map[string]interface{}{"role": nil})))
+		require.NoError(t, err)
+		require.Equal(t, RoleNone, identity.Role, "token without a role is not allowed to do anything")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid tokens", func(t *testing.T) {
+		valid := keys.token(t, "RS256", "rsa", claims(nil))
+		parts := strings.Split(valid, ".")
+		other := strings.Split(keys.token(t, "RS256", "rsa", claims(map[string]interface{}{"role": "admin"})), ".")
+
+		// es256 returns a token which is signed by EC key with given changes of valid claims.
+		es256 := func(changes map[string]interface{}) string {
+			return keys.token(t, "ES256", "ec", claims(changes))
+		}
+
+		tokens := map[string]string{
+			"malformed":         "token",
+			"tampered claims":   parts[0] + "." + other[1] + "." + parts[2],
+			"no signature":      parts[0] + "." + parts[1] + ".",
+			"algorithm none":    keys.token(t, "none", "rsa", claims(nil)),
+			"unknown key":       keys.token(t, "ES256", "unknown", claims(nil)),
+			"key without kid":   keys.token(t, "ES256", "", claims(nil)),
+			"algorithm of key":  keys.token(t, "PS256", "rsa", claims(nil)),
+			"key of other type": keys.token(t, "PS256", "ec", claims(nil)),
+			"encryption key":    keys.token(t, "RS256", "encryption", claims(nil)),
+			"expired":           es256(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+			"no expiration":     es256(map[string]interface{}{"exp": nil}),
+			"not valid yet":     es256(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()}),
+			"other issuer":      es256(map[string]interface{}{"iss": "https://other"}),
+			"other audience":    es256(map[string]interface{}{"aud": "other"}),
+			"no subject":        es256(map[string]interface{}{"sub": nil}),
+			"no audience claim": es256(map[string]interface{}{"aud": nil}),
+		}
+		for name, token := range tokens {
+			_, err := authenticate(token)
+			assert.ErrorIs(t, err, ErrInvalidCredentials, name)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/ports", nil) // nolint: noctx
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Basic YWxpY2U6c2VjcmV0")
+		_, err = verifier.Authenticate(req)
+		require.ErrorIs(t, err, ErrNoCredentials)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid JWKS file", func(t *testing.T) {
+		_, err := NewJWT(JWTOptions{JWKSFile: filepath.Join(t.TempDir(), "missing.json")})
+		require.Error(t, err)
+
+		for _, content := range []string{
+			`{`,
+			`{"keys": []}`,
+			`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`,
+			`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		} {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			_, err := NewJWT(JWTOptions{JWKSFile: path})
+			assert.Error(t, err, content)
+		}
+	})
+	require.True(t, passed)
+}
@@ -0,0 +1,516 @@
+// Package config provides configuration of the ports server.
+//
+// Every setting can be provided in a YAML file, in a `PORTS_*` environment variable or in a command-line flag.
+// The precedence from the lowest to the highest one is: default values, a config file, environment variables
+// and flags. A config file is optional, and its path is taken from `-config` flag or `PORTS_CONFIG` variable.
+// A name of an environment variable is a flag's name in upper case with `PORTS_` prefix, e.g. `-sql-dsn` flag
+// is `PORTS_SQL_DSN` variable.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/ratelimit"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/seed"
+)
+
+const (
+	// envPrefix is a prefix of all environment variables.
+	envPrefix = "PORTS_"
+	// configFlag is a name of a flag with a path to a config file.
+	configFlag = "config"
+)
+
+// Storage backends.
+const (
+	// StorageMemory keeps ports in memory.
+	StorageMemory = "memory"
+	// StorageFile keeps ports in files in a data directory.
+	StorageFile = "file"
+	// StorageSQL keeps ports in SQLite or PostgreSQL.
+	StorageSQL = "sql"
+)
+
+// Config describes configuration of the ports server.
+type Config struct {
+	// Address is an address for the server to listen on.
+	Address string `yaml:"address"`
+	// Storage describes where ports are stored.
+	Storage Storage `yaml:"storage"`
+	// Seed describes ports which are loaded when the server starts.
+	Seed Seed `yaml:"seed"`
+	// Timeouts describes timeouts of the server.
+	Timeouts Timeouts `yaml:"timeouts"`
+	// Log describes how the server logs.
+	Log Log `yaml:"log"`
+	// Audit describes where changes of ports are recorded.
+	Audit Audit `yaml:"audit"`
+	// Auth describes how requests are authenticated.
+	Auth Auth `yaml:"auth"`
+	// RateLimit limits rates of requests of every client. It can be changed without a restart.
+	RateLimit ratelimit.Limits `yaml:"rateLimit"`
+	// Requests describes which bodies of requests are accepted.
+	Requests Requests `yaml:"requests"`
+}
+
+// Storage describes where ports are stored.
+type Storage struct {
+	// Backend is one of StorageMemory, StorageFile or StorageSQL.
+	Backend string `yaml:"backend"`
+	// DataDir is a directory for StorageFile backend.
+	DataDir string `yaml:"dataDir"`
+	// SQL describes a database for StorageSQL backend.
+	SQL SQL `yaml:"sql"`
+}
+
+// SQL describes a database for the SQL storage backend.
+type SQL struct {
+	// Driver is a name of a database driver: sqlite or pgx.
+	Driver string `yaml:"driver"`
+	// DSN is a data source name.
+	DSN string `yaml:"dsn"`
+}
+
+// Seed describes ports which are loaded when the server starts.
+type Seed struct {
+	// File is a path to a file in the same format as `assets/ports.json`. No ports are loaded when it is empty.
+	File string `yaml:"file"`
+	// LoadMode describes what happens when a port from a file is not valid.
+	LoadMode ports.ReadMode `yaml:"loadMode"`
+	// Removed describes what happens with ports which are removed from a file when it is reloaded.
+	Removed seed.RemovePolicy `yaml:"removed"`
+}
+
+// Timeouts describes timeouts of the server. Zero means no timeout.
+type Timeouts struct {
+	// ReadHeader is time for reading request's headers.
+	ReadHeader time.Duration `yaml:"readHeader"`
+	// Read is time for reading a whole request, including its body.
+	Read time.Duration `yaml:"read"`
+	// Write is time from the end of reading request's headers to the end of writing a response.
+	Write time.Duration `yaml:"write"`
+	// Idle is time for waiting for a next request on a keep-alive connection.
+	Idle time.Duration `yaml:"idle"`
+	// Shutdown is time for finishing requests which are in progress when the server is stopped.
+	Shutdown time.Duration `yaml:"shutdown"`
+}
+
+// Log describes how the server logs.
+type Log struct {
+	// Level is the lowest level of logged lines: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is a format of log lines.
+	Format logging.Format `yaml:"format"`
+}
+
+// Audit describes where changes of ports are recorded.
+type Audit struct {
+	// File is a path to a file with audit events. Events are kept only in memory when it is empty.
+	File string `yaml:"file"`
+}
+
+// Auth describes how requests are authenticated. Authentication is disabled when no API keys, HMAC keys
+// or JWKS file are configured.
+type Auth struct {
+	// AnonymousRole is a role of requests without credentials. They are rejected when it is empty.
+	AnonymousRole auth.Role `yaml:"anonymousRole"`
+	// APIKeys are static keys of callers.
+	APIKeys []auth.APIKey `yaml:"apiKeys"`
+	// HMACKeys are shared secrets of callers which sign their requests.
+	HMACKeys []auth.HMACKey `yaml:"hmacKeys"`
+	// JWT describes which JWTs are accepted.
+	JWT JWT `yaml:"jwt"`
+}
+
+// Enabled checks whether any authentication method is configured.
+func (a Auth) Enabled() bool {
+	return len(a.APIKeys) > 0 || len(a.HMACKeys) > 0 || len(a.JWT.JWKSFile) > 0
+}
+
+// JWT describes which JWTs are accepted.
+type JWT struct {
+	// JWKSFile is a path to a JSON Web Key Set with public keys of an issuer. JWTs are not accepted when it is empty.
+	JWKSFile string `yaml:"jwksFile"`
+	// Issuer must be equal to `iss` claim when it is not empty.
+	Issuer string `yaml:"issuer"`
+	// Audience must be one of `aud` claim when it is not empty.
+	Audience string `yaml:"audience"`
+	// RoleClaim is a claim with a caller's role.
+	RoleClaim string `yaml:"roleClaim"`
+}
+
+// Requests describes which bodies of requests are accepted.
+type Requests struct {
+	// MaxBodyBytes limits a size of a JSON body other than an import. Only strict bodies are limited when it is zero.
+	MaxBodyBytes int64 `yaml:"maxBodyBytes"`
+	// StrictJSON rejects JSON bodies with unknown fields.
+	StrictJSON bool `yaml:"strictJSON"`
+}
+
+// Default returns default configuration.
+// Read and write timeouts are disabled, because import and export of ports stream large bodies.
+// Rates of requests are not limited, but bursts are ready for when rates are set.
+func Default() Config {
+	return Config{
+		Address: ":8080",
+		Storage: Storage{
+			Backend: StorageMemory,
+			DataDir: "./data",
+			SQL: SQL{
+				Driver: "sqlite",
+				DSN:    "./ports.db?_pragma=busy_timeout(5000)",
+			},
+		},
+		Seed: Seed{
+			File:     "./assets/ports.json",
+			LoadMode: ports.ReadLenient,
+			Removed:  seed.RemoveKeep,
+		},
+		Timeouts: Timeouts{
+			ReadHeader: 10 * time.Second,
+			Idle:       2 * time.Minute,
+			Shutdown:   10 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+		Auth: Auth{
+			JWT: JWT{RoleClaim: auth.DefaultRoleClaim},
+		},
+		RateLimit: ratelimit.Limits{
+			Read:  ratelimit.Limit{Burst: 50},
+			Write: ratelimit.Limit{Burst: 10},
+			// Failed authentications are limited by default, so credentials can not be guessed.
+			FailedAuth: ratelimit.Limit{Rate: 0.1, Burst: 10},
+		},
+		Requests: Requests{
+			MaxBodyBytes: 1 << 20,
+			StrictJSON:   true,
+		},
+	}
+}
+
+// Validate checks whether configuration is correct.
+func (c Config) Validate() error {
+	if len(c.Address) == 0 {
+		return errors.New("address can not be empty")
+	}
+
+	switch c.Storage.Backend {
+	case StorageMemory, StorageFile, StorageSQL:
+	default:
+		return fmt.Errorf("unknown storage backend \"%s\"", c.Storage.Backend)
+	}
+
+	if !c.Seed.LoadMode.Valid() {
+		return fmt.Errorf("unknown load mode \"%s\"", c.Seed.LoadMode)
+	}
+
+	if !c.Seed.Removed.Valid() {
+		return fmt.Errorf("unknown policy \"%s\" for removed seed ports", c.Seed.Removed)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		return err
+	}
+
+	if !c.Log.Format.Valid() {
+		return fmt.Errorf("unknown log format \"%s\"", c.Log.Format)
+	}
+
+	if !c.Auth.AnonymousRole.Valid() {
+		return fmt.Errorf("unknown anonymous role \"%s\"", c.Auth.AnonymousRole)
+	}
+
+	for _, s := range settings {
+		switch field := s.field(&c).(type) {
+		case *time.Duration:
+			if *field < 0 {
+				return fmt.Errorf("%s can not be negative", s.flag)
+			}
+		case *float64:
+			if *field < 0 {
+				return fmt.Errorf("%s can not be negative", s.flag)
+			}
+		case *int:
+			if *field < 0 {
+				return fmt.Errorf("%s can not be negative", s.flag)
+			}
+		case *int64:
+			if *field < 0 {
+				return fmt.Errorf("%s can not be negative", s.flag)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setting is a single configuration value which can be provided in a flag or in an environment variable.
+type setting struct {
+	// flag is a name of a flag.
+	flag string
+	// usage describes a setting.
+	usage string
+	// field returns a pointer to a string, a time.Duration, a float64, an int, an int64, a bool or a string-based
+	// type field in configuration.
+	field func(c *Config) interface{}
+}
+
+// settings are all settings except a path to a config file.
+var settings = []setting{
+	{"address", "address for the server to listen on", func(c *Config) interface{} { return &c.Address }},
+	{"storage", "storage backend for ports: memory, file or sql", func(c *Config) interface{} { return &c.Storage.Backend }},
+	{"data-dir", "directory for the file storage backend", func(c *Config) interface{} { return &c.Storage.DataDir }},
+	{"sql-driver", "database driver for the sql storage backend: sqlite or pgx", func(c *Config) interface{} {
+		return &c.Storage.SQL.Driver
+	}},
+	{"sql-dsn", "data source name for the sql storage backend", func(c *Config) interface{} { return &c.Storage.SQL.DSN }},
+	{"seed-file", "file with ports which are loaded at start, or empty for none", func(c *Config) interface{} {
+		return &c.Seed.File
+	}},
+	{"load-mode", "validation of the seed file: lenient skips invalid ports, strict stops at the first one",
+		func(c *Config) interface{} { return &c.Seed.LoadMode }},
+	{"seed-removed", "ports removed from the seed file on reload: keep or delete", func(c *Config) interface{} {
+		return &c.Seed.Removed
+	}},
+	{"read-header-timeout", "timeout for reading request's headers", func(c *Config) interface{} {
+		return &c.Timeouts.ReadHeader
+	}},
+	{"read-timeout", "timeout for reading a whole request", func(c *Config) interface{} { return &c.Timeouts.Read }},
+	{"write-timeout", "timeout for writing a response", func(c *Config) interface{} { return &c.Timeouts.Write }},
+	{"idle-timeout", "timeout for waiting for a next request", func(c *Config) interface{} { return &c.Timeouts.Idle }},
+	{"shutdown-timeout", "timeout for graceful shutdown", func(c *Config) interface{} { return &c.Timeouts.Shutdown }},
+	{"log-level", "lowest level of logged lines: debug, info, warn or error", func(c *Config) interface{} {
+		return &c.Log.Level
+	}},
+	{"log-format", "format of log lines: text or json", func(c *Config) interface{} { return &c.Log.Format }},
+	{"audit-file", "file with audit events of port changes, or empty to keep them in memory",
+		func(c *Config) interface{} { return &c.Audit.File }},
+	{"auth-anonymous-role", "role of requests without credentials when authentication is enabled: reader, editor, " +
+		"admin or empty to reject them", func(c *Config) interface{} { return &c.Auth.AnonymousRole }},
+	{"auth-jwks-file", "JSON Web Key Set with keys which sign accepted JWTs, or empty to not accept JWTs",
+		func(c *Config) interface{} { return &c.Auth.JWT.JWKSFile }},
+	{"auth-jwt-issuer", "required issuer of JWTs, or empty for any", func(c *Config) interface{} {
+		return &c.Auth.JWT.Issuer
+	}},
+	{"auth-jwt-audience", "required audience of JWTs, or empty for any", func(c *Config) interface{} {
+		return &c.Auth.JWT.Audience
+	}},
+	{"auth-jwt-role-claim", "claim of JWTs with a role", func(c *Config) interface{} { return &c.Auth.JWT.RoleClaim }},
+	{"rate-limit-read", "reads per second of every client, or 0 for no limit", func(c *Config) interface{} {
+		return &c.RateLimit.Read.Rate
+	}},
+	{"rate-limit-read-burst", "reads which every client can send at once", func(c *Config) interface{} {
+		return &c.RateLimit.Read.Burst
+	}},
+	{"rate-limit-write", "writes per second of every client, or 0 for no limit", func(c *Config) interface{} {
+		return &c.RateLimit.Write.Rate
+	}},
+	{"rate-limit-write-burst", "writes which every client can send at once", func(c *Config) interface{} {
+		return &c.RateLimit.Write.Burst
+	}},
+	{"rate-limit-failed-auth", "failed authentications per second of every IP address, or 0 for no limit",
+		func(c *Config) interface{} { return &c.RateLimit.FailedAuth.Rate }},
+	{"rate-limit-failed-auth-burst", "failed authentications which every IP address can send at once",
+		func(c *Config) interface{} { return &c.RateLimit.FailedAuth.Burst }},
+	{"max-body-bytes", "largest JSON body of a request other than an import, or 0 for no limit",
+		func(c *Config) interface{} { return &c.Requests.MaxBodyBytes }},
+	{"strict-json", "reject JSON bodies of requests with unknown fields", func(c *Config) interface{} {
+		return &c.Requests.StrictJSON
+	}},
+}
+
+// env returns a name of an environment variable for a setting.
+func env(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// set parses a value of a setting into configuration.
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *ports.ReadMode:
+		*field = ports.ReadMode(value)
+	case *seed.RemovePolicy:
+		*field = seed.RemovePolicy(value)
+	case *logging.Format:
+		*field = logging.Format(value)
+	case *auth.Role:
+		*field = auth.Role(value)
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration \"%s\" of %s", value, s.flag)
+		}
+		*field = d
+	case *float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number \"%s\" of %s", value, s.flag)
+		}
+		*field = f
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer \"%s\" of %s", value, s.flag)
+		}
+		*field = i
+	case *int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer \"%s\" of %s", value, s.flag)
+		}
+		*field = i
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean \"%s\" of %s", value, s.flag)
+		}
+		*field = b
+	}
+
+	return nil
+}
+
+// get returns a value of a setting from configuration.
+func (s setting) get(c *Config) string {
+	switch field := s.field(c).(type) {
+	case *string:
+		return *field
+	case *ports.ReadMode:
+		return string(*field)
+	case *seed.RemovePolicy:
+		return string(*field)
+	case *logging.Format:
+		return string(*field)
+	case *auth.Role:
+		return string(*field)
+	case *time.Duration:
+		return field.String()
+	case *float64:
+		return strconv.FormatFloat(*field, 'f', -1, 64)
+	case *int:
+		return strconv.Itoa(*field)
+	case *int64:
+		return strconv.FormatInt(*field, 10)
+	case *bool:
+		return strconv.FormatBool(*field)
+	default:
+		return ""
+	}
+}
+
+// flagValue stores a value of a flag, so it can be applied after a config file and environment variables.
+type flagValue struct {
+	value    *string
+	defValue string
+	// boolFlag is true for a setting of bool type, so its flag can be given without a value, e.g. `-strict-json`.
+	boolFlag bool
+}
+
+// String returns a default value until a flag is set, so it is printed in usage.
+func (f flagValue) String() string {
+	if f.value == nil || len(*f.value) == 0 {
+		return f.defValue
+	}
+
+	return *f.value
+}
+
+func (f flagValue) Set(value string) error {
+	*f.value = value
+
+	return nil
+}
+
+func (f flagValue) IsBoolFlag() bool {
+	return f.boolFlag
+}
+
+// Load returns configuration from command-line arguments without a program's name, environment variables
+// which are looked up by a given function and a config file. flag.ErrHelp is returned when help is requested.
+func Load(name string, args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	cfg := Default()
+
+	// Flags are parsed at first to find a config file, but they are applied at the end, so they take precedence.
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String(configFlag, "", fmt.Sprintf("path to a YAML config file (env %s)", env(configFlag)))
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.flag] = new(string)
+		defValue := s.get(&cfg)
+		_, boolFlag := s.field(&cfg).(*bool)
+		flags.Var(flagValue{value: values[s.flag], defValue: defValue, boolFlag: boolFlag}, s.flag,
+			fmt.Sprintf("%s (env %s)", s.usage, env(s.flag)))
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+	if flags.NArg() > 0 {
+		// A value after a boolean flag is not its value, e.g. `-strict-json false`, so it is not ignored silently.
+		return cfg, fmt.Errorf("unexpected argument \"%s\", boolean flags take values as -flag=value", flags.Arg(0))
+	}
+
+	visited := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+
+	if !visited[configFlag] {
+		*configFile, _ = lookupEnv(env(configFlag))
+	}
+	if len(*configFile) > 0 {
+		if err := loadFile(&cfg, *configFile); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := lookupEnv(env(s.flag))
+		if visited[s.flag] {
+			value, ok = *values[s.flag], true
+		}
+		if !ok {
+			continue
+		}
+
+		if err := s.set(&cfg, value); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// loadFile loads a YAML config file. Unknown fields are not allowed, so a typo does not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file \"%s\": %w", path, err)
+	}
+
+	return nil
+}
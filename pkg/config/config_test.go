@@ -0,0 +1,204 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/ratelimit"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/seed"
+)
+
+func TestLoad(t *testing.T) { // nolint: funlen
+	// writeFile writes a config file, and returns its path.
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		return path
+	}
+
+	// lookupEnv returns a function which looks up given environment variables.
+	lookupEnv := func(env map[string]string) func(string) (string, bool) {
+		return func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		}
+	}
+
+	load := func(args []string, env map[string]string) (Config, error) {
+		return Load("ports", args, lookupEnv(env), io.Discard)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := load(nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, Default(), cfg)
+		require.False(t, cfg.Auth.Enabled(), "authentication must be enabled explicitly")
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		path := writeFile(t, `
+address: ":9090"
+storage:
+  backend: sql
+  sql:
+    driver: pgx
+    dsn: postgres://file
+seed:
+  loadMode: strict
+  removed: delete
+timeouts:
+  shutdown: 30s
+  write: 1m
+log:
+  level: warn
+  format: text
+audit:
+  file: /data/audit.log
+auth:
+  anonymousRole: reader
+  apiKeys:
+    - key: secret
+      subject: ci
+      role: editor
+  hmacKeys:
+    - id: importer
+      secret: shared
+      subject: importer
+      role: admin
+  jwt:
+    jwksFile: /etc/ports/jwks.json
+    issuer: https://issuer
+rateLimit:
+  read:
+    rate: 100
+    burst: 200
+  write:
+    rate: 10
+  failedAuth:
+    rate: 1
+    burst: 5
+requests:
+  maxBodyBytes: 4096
+`)
+		cfg, err := load([]string{"-config", path, "-sql-dsn", "postgres://flag"}, map[string]string{
+			"PORTS_SQL_DSN":          "postgres://env",
+			"PORTS_SHUTDOWN_TIMEOUT": "5s",
+			"PORTS_SEED_FILE":        "",
+			"PORTS_LOG_FORMAT":       "json",
+			"PORTS_AUTH_JWT_ISSUER":  "https://env",
+			"PORTS_RATE_LIMIT_WRITE": "2.5",
+			"PORTS_STRICT_JSON":      "false",
+		})
+		require.NoError(t, err)
+
+		expected := Default()
+		expected.Address = ":9090"
+		expected.Storage.Backend = StorageSQL
+		expected.Storage.SQL = SQL{Driver: "pgx", DSN: "postgres://flag"}
+		expected.Seed = Seed{LoadMode: ports.ReadStrict, Removed: seed.RemoveDelete}
+		expected.Timeouts.Shutdown = 5 * time.Second
+		expected.Timeouts.Write = time.Minute
+		expected.Log = Log{Level: "warn", Format: logging.FormatJSON}
+		expected.Audit.File = "/data/audit.log"
+		expected.Auth = Auth{
+			AnonymousRole: auth.RoleReader,
+			APIKeys:       []auth.APIKey{{Key: "secret", Subject: "ci", Role: auth.RoleEditor}},
+			HMACKeys:      []auth.HMACKey{{ID: "importer", Secret: "shared", Subject: "importer", Role: auth.RoleAdmin}},
+			JWT:           JWT{JWKSFile: "/etc/ports/jwks.json", Issuer: "https://env", RoleClaim: auth.DefaultRoleClaim},
+		}
+		require.True(t, cfg.Auth.Enabled())
+		expected.RateLimit = ratelimit.Limits{
+			Read:       ratelimit.Limit{Rate: 100, Burst: 200},
+			Write:      ratelimit.Limit{Rate: 2.5, Burst: Default().RateLimit.Write.Burst},
+			FailedAuth: ratelimit.Limit{Rate: 1, Burst: 5},
+		}
+		expected.Requests = Requests{MaxBodyBytes: 4096, StrictJSON: false}
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("boolean flags", func(t *testing.T) {
+		cfg, err := load([]string{"-strict-json"}, map[string]string{"PORTS_STRICT_JSON": "false"})
+		require.NoError(t, err)
+		require.True(t, cfg.Requests.StrictJSON)
+
+		cfg, err = load([]string{"-strict-json=false", "-max-body-bytes", "4096"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, Requests{MaxBodyBytes: 4096, StrictJSON: false}, cfg.Requests)
+	})
+
+	t.Run("config file from env", func(t *testing.T) {
+		path := writeFile(t, "storage:\n  backend: file\n  dataDir: /data\n")
+		cfg, err := load(nil, map[string]string{"PORTS_CONFIG": path})
+		require.NoError(t, err)
+		require.Equal(t, Storage{Backend: StorageFile, DataDir: "/data", SQL: Default().Storage.SQL}, cfg.Storage)
+
+		cfg, err = load([]string{"-config", ""}, map[string]string{"PORTS_CONFIG": path})
+		require.NoError(t, err)
+		require.Equal(t, Default(), cfg, "flag must take precedence over env")
+	})
+
+	t.Run("empty config file", func(t *testing.T) {
+		cfg, err := load([]string{"-config", writeFile(t, "")}, nil)
+		require.NoError(t, err)
+		require.Equal(t, Default(), cfg)
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		_, err := load([]string{"-config", writeFile(t, "storage:\n  backnd: file\n")}, nil)
+		require.ErrorContains(t, err, "backnd", "unknown fields must not be ignored")
+
+		_, err = load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, nil)
+		require.Error(t, err)
+
+		_, err = load([]string{"-storage", "mongo"}, nil)
+		require.ErrorContains(t, err, "mongo")
+
+		_, err = load(nil, map[string]string{"PORTS_LOAD_MODE": "fast"})
+		require.ErrorContains(t, err, "fast")
+
+		_, err = load([]string{"-seed-removed", "archive"}, nil)
+		require.ErrorContains(t, err, "archive")
+
+		_, err = load(nil, map[string]string{"PORTS_READ_TIMEOUT": "10"})
+		require.ErrorContains(t, err, "read-timeout")
+
+		_, err = load([]string{"-idle-timeout", "-1s"}, nil)
+		require.ErrorContains(t, err, "idle-timeout")
+
+		_, err = load([]string{"-log-level", "verbose"}, nil)
+		require.ErrorContains(t, err, "verbose")
+
+		_, err = load(nil, map[string]string{"PORTS_LOG_FORMAT": "xml"})
+		require.ErrorContains(t, err, "xml")
+
+		_, err = load([]string{"-rate-limit-read", "fast"}, nil)
+		require.ErrorContains(t, err, "rate-limit-read")
+
+		_, err = load(nil, map[string]string{"PORTS_RATE_LIMIT_WRITE_BURST": "-1"})
+		require.ErrorContains(t, err, "rate-limit-write-burst")
+
+		_, err = load([]string{"-strict-json=maybe"}, nil)
+		require.ErrorContains(t, err, "strict-json")
+
+		_, err = load([]string{"-strict-json", "false"}, nil)
+		require.ErrorContains(t, err, "unexpected argument \"false\"")
+
+		_, err = load([]string{"-max-body-bytes", "-1"}, nil)
+		require.ErrorContains(t, err, "max-body-bytes")
+
+		_, err = load([]string{"-auth-anonymous-role", "guest"}, nil)
+		require.ErrorContains(t, err, "guest")
+
+		_, err = load([]string{"-unknown"}, nil)
+		require.Error(t, err)
+	})
+}
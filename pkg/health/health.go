@@ -0,0 +1,149 @@
+// Package health provides liveness, readiness and startup probes of the ports server.
+//
+// A startup check fails until the server has started, e.g. while a seed file is loading. A readiness check fails
+// when the server can not serve requests, e.g. when a storage is not available. The server is ready when all
+// startup and readiness checks pass, so orchestrators send requests to it only then.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout is time for a single check.
+const checkTimeout = 2 * time.Second
+
+const (
+	// statusOK is a status of a passing probe or check.
+	statusOK = "ok"
+	// statusUnavailable is a status of a failing probe.
+	statusUnavailable = "unavailable"
+)
+
+// Check returns an error when a dependency of the server is not healthy.
+type Check func(ctx context.Context) error
+
+// namedCheck is a check with its name in a report.
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Probes describes checks of the server. Checks must be added before probes are served.
+type Probes struct {
+	startup   []namedCheck
+	readiness []namedCheck
+}
+
+// New returns probes without any checks, so they pass.
+func New() *Probes {
+	return &Probes{}
+}
+
+// AddStartup adds a check which fails until the server has started.
+func (p *Probes) AddStartup(name string, check Check) {
+	p.startup = append(p.startup, namedCheck{name: name, check: check})
+}
+
+// AddReadiness adds a check which fails when the server can not serve requests.
+func (p *Probes) AddReadiness(name string, check Check) {
+	p.readiness = append(p.readiness, namedCheck{name: name, check: check})
+}
+
+// report describes a result of a probe.
+type report struct {
+	// Status is statusOK or statusUnavailable.
+	Status string `json:"status"`
+	// Checks contains statusOK or an error of every check by its name.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Liveness returns a handler which responds with 200 as long as the server handles requests.
+func (p *Probes) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, report{Status: statusOK})
+	})
+}
+
+// Readiness returns a handler which responds with 200 when all startup and readiness checks pass,
+// and with 503 otherwise.
+func (p *Probes) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, run(r.Context(), p.startup, p.readiness))
+	})
+}
+
+// Startup returns a handler which responds with 200 when all startup checks pass, and with 503 otherwise.
+func (p *Probes) Startup() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, run(r.Context(), p.startup))
+	})
+}
+
+// run runs all checks, and returns their report.
+func run(ctx context.Context, checks ...[]namedCheck) report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	r := report{Status: statusOK, Checks: make(map[string]string)}
+	for _, group := range checks {
+		for _, c := range group {
+			if err := c.check(ctx); err != nil {
+				r.Status = statusUnavailable
+				r.Checks[c.name] = err.Error()
+				continue
+			}
+			r.Checks[c.name] = statusOK
+		}
+	}
+
+	return r
+}
+
+// writeReport sends a report with 200 when its status is statusOK, and with 503 otherwise.
+func writeReport(w http.ResponseWriter, r report) {
+	status := http.StatusOK
+	if r.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		http.Error(w, "failed to serialize health report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// Gate is a check which fails until it is opened, e.g. when a seed file is loaded.
+type Gate struct {
+	open   atomic.Bool
+	reason error
+}
+
+// NewGate returns a closed gate which fails with a given reason.
+func NewGate(reason string) *Gate {
+	return &Gate{reason: errors.New(reason)}
+}
+
+// Open makes a gate pass.
+func (g *Gate) Open() {
+	g.open.Store(true)
+}
+
+// Check fails until a gate is opened.
+func (g *Gate) Check(_ context.Context) error {
+	if g.open.Load() {
+		return nil
+	}
+
+	return g.reason
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbes(t *testing.T) {
+	// probe calls a handler, and returns its status with a report.
+	probe := func(t *testing.T, handler http.Handler) (int, report) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var r report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+
+		return w.Code, r
+	}
+
+	probes := New()
+	seedLoaded := NewGate("seed file is loading")
+	probes.AddStartup("seed", seedLoaded.Check)
+	var storageErr error
+	probes.AddReadiness("storage", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		require.True(t, ok, "a check must have a timeout")
+		return storageErr
+	})
+
+	passed := t.Run("starting", func(t *testing.T) {
+		status, _ := probe(t, probes.Liveness())
+		require.Equal(t, http.StatusOK, status)
+
+		status, r := probe(t, probes.Startup())
+		require.Equal(t, http.StatusServiceUnavailable, status)
+		require.Equal(t, report{Status: statusUnavailable, Checks: map[string]string{
+			"seed": "seed file is loading",
+		}}, r)
+
+		status, r = probe(t, probes.Readiness())
+		require.Equal(t, http.StatusServiceUnavailable, status)
+		require.Equal(t, report{Status: statusUnavailable, Checks: map[string]string{
+			"seed":    "seed file is loading",
+			"storage": statusOK,
+		}}, r)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("ready", func(t *testing.T) {
+		seedLoaded.Open()
+
+		status, _ := probe(t, probes.Startup())
+		require.Equal(t, http.StatusOK, status)
+
+		status, r := probe(t, probes.Readiness())
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, statusOK, r.Status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("storage is not available", func(t *testing.T) {
+		storageErr = errors.New("database is not available")
+
+		status, r := probe(t, probes.Readiness())
+		require.Equal(t, http.StatusServiceUnavailable, status)
+		require.Equal(t, "database is not available", r.Checks["storage"])
+
+		status, _ = probe(t, probes.Startup())
+		require.Equal(t, http.StatusOK, status, "a started server does not start again")
+		status, _ = probe(t, probes.Liveness())
+		require.Equal(t, http.StatusOK, status)
+	})
+	require.True(t, passed)
+}
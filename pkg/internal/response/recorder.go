@@ -0,0 +1,66 @@
+// Package response provides a response writer which is shared by middlewares of the ports server.
+package response
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Recorder remembers a status of a response. Only the first status is sent, so a status can not be changed after
+// it is sent. It is safe for concurrent use, because a handler may log from many goroutines.
+type Recorder struct {
+	http.ResponseWriter
+
+	mutex  sync.Mutex
+	status int
+}
+
+// NewRecorder returns a recorder of a response writer. A writer which already is a recorder is returned as it is,
+// so middlewares of a request share one recorder.
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	if recorder, ok := w.(*Recorder); ok {
+		return recorder
+	}
+
+	return &Recorder{ResponseWriter: w}
+}
+
+// Status returns a status of a response, or zero when a handler has not written anything yet.
+func (r *Recorder) Status() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.status
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	r.mutex.Lock()
+	written := r.status != 0
+	if !written {
+		r.status = status
+	}
+	r.mutex.Unlock()
+
+	if !written {
+		r.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to a client, so streamed responses work through middlewares.
+func (r *Recorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.WriteHeader(http.StatusOK)
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original response writer for http.ResponseController.
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,44 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Run("first status is sent", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		recorder := NewRecorder(w)
+		require.Equal(t, 0, recorder.Status())
+
+		recorder.WriteHeader(http.StatusNotFound)
+		recorder.WriteHeader(http.StatusInternalServerError)
+		require.Equal(t, http.StatusNotFound, recorder.Status())
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("recorder is shared", func(t *testing.T) {
+		recorder := NewRecorder(httptest.NewRecorder())
+		require.Same(t, recorder, NewRecorder(recorder))
+	})
+
+	t.Run("write sends 200", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		recorder := NewRecorder(w)
+		_, err := recorder.Write([]byte("body"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, recorder.Status())
+		require.Equal(t, "body", w.Body.String())
+	})
+
+	t.Run("flush sends 200", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		recorder := NewRecorder(w)
+		require.NoError(t, http.NewResponseController(recorder).Flush())
+		require.Equal(t, http.StatusOK, recorder.Status())
+		require.True(t, w.Flushed)
+	})
+}
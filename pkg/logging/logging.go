@@ -0,0 +1,211 @@
+// Package logging provides structured leveled logging of the ports server.
+//
+// Every line which is logged with a request's context carries the request's ID, method, port's ID, status and
+// latency, so lines of a single request can be found together.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/informalict/ports/pkg/internal/response"
+)
+
+// RequestIDHeader is a header with a request's ID. It is taken from a request when it is provided, and it is always
+// returned in a response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request's ID which is taken from a request.
+const maxRequestIDLength = 128
+
+// Format describes how log lines are written.
+type Format string
+
+const (
+	// FormatText writes log lines as key=value pairs.
+	FormatText Format = "text"
+	// FormatJSON writes log lines as JSON objects.
+	FormatJSON Format = "json"
+)
+
+// Valid checks whether a format is supported.
+func (f Format) Valid() bool {
+	return f == FormatText || f == FormatJSON
+}
+
+// ParseLevel parses a level name such as "debug", "info", "warn" or "error".
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return level, fmt.Errorf("unknown log level \"%s\"", name)
+	}
+
+	return level, nil
+}
+
+// New returns a logger which writes lines in a given format when they have at least a given level.
+func New(w io.Writer, format Format, level slog.Leveler) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if format == FormatJSON {
+		return slog.New(&contextHandler{slog.NewJSONHandler(w, options)})
+	}
+
+	return slog.New(&contextHandler{slog.NewTextHandler(w, options)})
+}
+
+// Discard returns a logger which does not write anything.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// requestKey is a key of a request's details in a context.
+type requestKey struct{}
+
+// request describes a request which is in progress.
+type request struct {
+	id     string
+	method string
+	path   string
+	start  time.Time
+
+	// recorder has a status of a response.
+	recorder *response.Recorder
+
+	// mutex protects fields below, because a request's handler may log from many goroutines.
+	mutex  sync.Mutex
+	portID string
+	// finished is set when a handler has returned, so a response without a status has 200.
+	finished bool
+}
+
+// attrs returns attributes of a request for a log line.
+func (r *request) attrs() []slog.Attr {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	attrs := make([]slog.Attr, 0, 6)
+	attrs = append(attrs,
+		slog.String("request_id", r.id),
+		slog.String("method", r.method),
+		slog.String("path", r.path),
+	)
+	if len(r.portID) > 0 {
+		attrs = append(attrs, slog.String("port_id", r.portID))
+	}
+	if status := r.status(); status != 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+
+	return append(attrs, slog.Duration("latency", time.Since(r.start)))
+}
+
+// status returns a status of a response, or zero when it has not been written yet. The caller must hold the mutex.
+func (r *request) status() int {
+	status := r.recorder.Status()
+	if status == 0 && r.finished {
+		// A handler has not written anything, so the server sends 200.
+		status = http.StatusOK
+	}
+
+	return status
+}
+
+// SetPortID adds a port's ID to all lines which are logged with a request's context.
+func SetPortID(ctx context.Context, ID string) {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		r.mutex.Lock()
+		r.portID = ID
+		r.mutex.Unlock()
+	}
+}
+
+// RequestID returns an ID of a request from its context, or an empty string outside of a request.
+func RequestID(ctx context.Context) string {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		return r.id
+	}
+
+	return ""
+}
+
+// contextHandler adds details of a request from a context to every log line.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		record.AddAttrs(r.attrs()...)
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Middleware assigns an ID to every request, and logs every request when it is finished.
+// Server errors are logged with error level, client errors with warning level and the rest with info level.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &request{
+			id:     requestID(r),
+			method: r.Method,
+			path:   r.URL.Path,
+			start:  time.Now(),
+		}
+		w.Header().Set(RequestIDHeader, req.id)
+
+		ctx := context.WithValue(r.Context(), requestKey{}, req)
+		req.recorder = response.NewRecorder(w)
+		defer func() {
+			if v := recover(); v != nil {
+				logger.ErrorContext(ctx, "request is aborted", "panic", v)
+				panic(v)
+			}
+
+			req.mutex.Lock()
+			req.finished = true
+			status := req.status()
+			req.mutex.Unlock()
+
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+
+			logger.LogAttrs(ctx, level, "request is finished")
+		}()
+
+		next.ServeHTTP(req.recorder, r.WithContext(ctx))
+	})
+}
+
+// requestID returns an ID from a request's header, or a new random one.
+func requestID(r *http.Request) string {
+	if ID := r.Header.Get(RequestIDHeader); len(ID) > 0 && len(ID) <= maxRequestIDLength {
+		return ID
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) { // nolint: funlen
+	// serve sends a request through the middleware, and returns a response with logged lines.
+	serve := func(t *testing.T, level slog.Level, requestID string, handler http.HandlerFunc,
+	) (*httptest.ResponseRecorder, []map[string]interface{}) {
+		var buf bytes.Buffer
+		logger := New(&buf, FormatJSON, level)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/ports/AEAJM", nil)
+		if len(requestID) > 0 {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetPortID(r.Context(), "AEAJM")
+			handler(w, r)
+			logger.DebugContext(r.Context(), "handled")
+		})).ServeHTTP(w, req)
+
+		var lines []map[string]interface{}
+		decoder := json.NewDecoder(&buf)
+		for decoder.More() {
+			line := make(map[string]interface{})
+			require.NoError(t, decoder.Decode(&line))
+			lines = append(lines, line)
+		}
+
+		return w, lines
+	}
+
+	passed := t.Run("every line carries request's details", func(t *testing.T) {
+		w, lines := serve(t, slog.LevelDebug, "", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "not found", http.StatusNotFound)
+		})
+		requestID := w.Header().Get(RequestIDHeader)
+		require.Len(t, requestID, 16)
+		require.Len(t, lines, 2)
+
+		for _, line := range lines {
+			require.Equal(t, requestID, line["request_id"])
+			require.Equal(t, http.MethodGet, line["method"])
+			require.Equal(t, "/api/v1/ports/AEAJM", line["path"])
+			require.Equal(t, "AEAJM", line["port_id"])
+			require.Equal(t, float64(http.StatusNotFound), line["status"])
+			require.Contains(t, line, "latency")
+		}
+		require.Equal(t, "DEBUG", lines[0]["level"])
+		require.Equal(t, "request is finished", lines[1]["msg"])
+		require.Equal(t, "WARN", lines[1]["level"])
+	})
+	require.True(t, passed)
+
+	passed = t.Run("request's ID is taken from a request", func(t *testing.T) {
+		w, lines := serve(t, slog.LevelInfo, "client-id", func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "client-id", RequestID(r.Context()))
+		})
+		require.Equal(t, "client-id", w.Header().Get(RequestIDHeader))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		require.Len(t, lines, 1, "debug lines must not be logged with info level")
+		require.Equal(t, "client-id", lines[0]["request_id"])
+		require.Equal(t, float64(http.StatusOK), lines[0]["status"])
+		require.Equal(t, "INFO", lines[0]["level"])
+
+		tooLong := strings.Repeat("x", maxRequestIDLength+1)
+		w, _ = serve(t, slog.LevelInfo, tooLong, func(http.ResponseWriter, *http.Request) {})
+		require.Len(t, w.Header().Get(RequestIDHeader), 16, "a too long ID must be replaced")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("server errors", func(t *testing.T) {
+		_, lines := serve(t, slog.LevelError, "", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			// A status can not be changed after it is sent.
+			w.WriteHeader(http.StatusOK)
+		})
+		require.Len(t, lines, 1)
+		require.Equal(t, "ERROR", lines[0]["level"])
+		require.Equal(t, float64(http.StatusInternalServerError), lines[0]["status"])
+	})
+	require.True(t, passed)
+
+	passed = t.Run("streamed response", func(t *testing.T) {
+		w, _ := serve(t, slog.LevelInfo, "", func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			require.True(t, ok)
+			_, _ = w.Write([]byte("first"))
+			flusher.Flush()
+		})
+		require.True(t, w.Flushed)
+		require.Equal(t, "first", w.Body.String())
+	})
+	require.True(t, passed)
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, FormatText, slog.LevelWarn).Warn("message", "port_id", "AEAJM")
+	require.Contains(t, buf.String(), "level=WARN msg=message port_id=AEAJM")
+
+	_, err := ParseLevel("debug")
+	require.NoError(t, err)
+	_, err = ParseLevel("verbose")
+	require.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/informalict/ports/pkg/internal/response"
+)
+
+// unknownRoute is a route of requests which have not been matched by any router.
+const unknownRoute = "unknown"
+
+// routeKey is a key of a request's route in a context.
+type routeKey struct{}
+
+// SetRoute sets a route of a request, e.g. `/api/v1/ports/:id`. Routes are used as labels instead of paths,
+// so every port does not get its own metrics.
+func SetRoute(ctx context.Context, route string) {
+	if r, ok := ctx.Value(routeKey{}).(*atomic.Value); ok {
+		r.Store(route)
+	}
+}
+
+// Route sets a route of every request which is handled by a handler.
+func Route(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), route)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HTTP describes metrics of HTTP requests.
+type HTTP struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewHTTP creates metrics of HTTP requests, and registers them in a registerer.
+func NewHTTP(registerer prometheus.Registerer) (*HTTP, error) {
+	m := &HTTP{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by their routes, methods and statuses.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by their routes and methods.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.requests, m.duration} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Middleware observes every request by its route, which is set by a handler with SetRoute.
+func (m *HTTP) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := &atomic.Value{}
+		route.Store(unknownRoute)
+		recorder := response.NewRecorder(w)
+		defer func() {
+			v := recover()
+			status := recorder.Status()
+			if status == 0 {
+				// A handler has not written anything, so the server sends 200, or a connection is broken by a panic.
+				status = http.StatusOK
+				if v != nil {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			name := route.Load().(string) // nolint: forcetypeassert
+			m.requests.WithLabelValues(name, r.Method, strconv.Itoa(status)).Inc()
+			m.duration.WithLabelValues(name, r.Method).Observe(time.Since(start).Seconds())
+
+			if v != nil {
+				panic(v)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)))
+	})
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/memory"
+	"github.com/informalict/ports/pkg/services/ports/portstest"
+)
+
+func TestPortService(t *testing.T) {
+	portstest.TestPortService(t, func(t *testing.T) ports.PortService {
+		svc, err := NewPortService(memory.NewPortMemory(), prometheus.NewRegistry())
+		require.NoError(t, err)
+
+		return svc
+	})
+}
+
+func TestPortServiceMetrics(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	svc, err := NewPortService(memory.NewPortMemory(), registry)
+	require.NoError(t, err)
+	_, ok := svc.(ports.GeoService)
+	require.True(t, ok, "geo search must not be hidden by metrics")
+
+	require.NoError(t, svc.Create(ctx, "AEAJM", portstest.ValidPort("port")))
+	require.ErrorIs(t, svc.Create(ctx, "AEAJM", portstest.ValidPort("port")), ports.ErrPortAlreadyExist)
+	_, err = svc.Get(ctx, "missing")
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+	aborted := errors.New("aborted")
+	_, err = svc.Modify(ctx, "AEAJM", func(port ports.Port) (ports.Port, error) {
+		return port, aborted
+	})
+	require.ErrorIs(t, err, aborted)
+
+	operations := svc.(*geoPortService).operations // nolint: forcetypeassert
+	for _, c := range []struct {
+		operation, result int
+		expected          float64
+	}{
+		{operationCreate, resultSuccess, 1},
+		{operationCreate, resultAlreadyExists, 1},
+		{operationGet, resultNotFound, 1},
+		{operationModify, resultAborted, 1},
+		{operationModify, resultError, 0},
+		{operationDelete, resultSuccess, 0},
+	} {
+		require.Equal(t, c.expected, testutil.ToFloat64(operations[c.operation].results[c.result]),
+			"%s %s", operationNames[c.operation], resultNames[c.result])
+	}
+	require.Equal(t, operationCount*resultCount, testutil.CollectAndCount(registry, "ports_service_operations_total"),
+		"all results of all operations must be exposed from the start")
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP ports_stored Number of stored ports.
+# TYPE ports_stored gauge
+ports_stored 1
+`), "ports_stored"))
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := NewHTTP(registry)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/ports/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), "/ports/:id")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	mux.Handle("/metrics", Route("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("metrics"))
+	})))
+	handler := m.Middleware(mux)
+
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, "/ports/AEAJM"},
+		{http.MethodGet, "/ports/AEAUH"},
+		{http.MethodPost, "/ports/AEAJM"},
+		{http.MethodGet, "/metrics"},
+		{http.MethodGet, "/missing"},
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.path, nil))
+	}
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP ports_http_requests_total Number of HTTP requests by their routes, methods and statuses.
+# TYPE ports_http_requests_total counter
+ports_http_requests_total{method="GET",route="/metrics",status="200"} 1
+ports_http_requests_total{method="GET",route="/ports/:id",status="200"} 2
+ports_http_requests_total{method="GET",route="unknown",status="404"} 1
+ports_http_requests_total{method="POST",route="/ports/:id",status="201"} 1
+`), "ports_http_requests_total"))
+	require.Equal(t, 4, testutil.CollectAndCount(m.duration), "every route must have a histogram")
+}
+
+func TestSeed(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := NewSeed(registry)
+	require.NoError(t, err)
+
+	m.ObservePort("AEAJM", nil)
+	m.ObservePort("INVALID", errors.New("invalid port"))
+	m.Observe(SeedLoad, ports.ImportReport{
+		Created: []string{"AEAJM"},
+		Failed:  []ports.ImportFailure{{ID: "INVALID", Err: errors.New("invalid port")}},
+	}, nil)
+	m.Observe(SeedReload, ports.ImportReport{}, errors.New("file does not exist"))
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.processed))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.failed))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.runs.WithLabelValues(SeedLoad, "success")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.runs.WithLabelValues(SeedReload, "failure")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.lastRun.WithLabelValues(SeedLoad, "created")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.lastRun.WithLabelValues(SeedLoad, "failed")))
+	require.Equal(t, float64(0), testutil.ToFloat64(m.lastRun.WithLabelValues(SeedLoad, "updated")))
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// Operations with a seed file.
+const (
+	// SeedLoad is the first load of a seed file.
+	SeedLoad = "load"
+	// SeedReload is a reload of a seed file.
+	SeedReload = "reload"
+)
+
+// Seed describes metrics of loading ports from a seed file.
+type Seed struct {
+	processed prometheus.Counter
+	failed    prometheus.Counter
+	runs      *prometheus.CounterVec
+	lastRun   *prometheus.GaugeVec
+	success   *prometheus.GaugeVec
+}
+
+// NewSeed creates metrics of a seed file, and registers them in a registerer.
+func NewSeed(registerer prometheus.Registerer) (*Seed, error) {
+	m := &Seed{
+		processed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "seed_processed_ports_total",
+			Help:      "Number of ports from a seed file which have been processed, so a load can be followed.",
+		}),
+		failed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "seed_failed_ports_total",
+			Help:      "Number of ports from a seed file which are invalid or which have not been stored.",
+		}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "seed_runs_total",
+			Help:      "Number of loads and reloads of a seed file by their results.",
+		}, []string{"operation", "result"}),
+		lastRun: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "seed_last_run_ports",
+			Help:      "Number of ports from the last successful load or reload of a seed file by their outcomes.",
+		}, []string{"operation", "outcome"}),
+		success: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "seed_last_success_timestamp_seconds",
+			Help:      "Time of the last successful load or reload of a seed file.",
+		}, []string{"operation"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.processed, m.failed, m.runs, m.lastRun, m.success} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ObservePort observes a single port from a seed file while it is being loaded.
+func (m *Seed) ObservePort(_ string, err error) {
+	m.processed.Inc()
+	if err != nil {
+		m.failed.Inc()
+	}
+}
+
+// Observe observes a finished load or reload of a seed file.
+func (m *Seed) Observe(operation string, report ports.ImportReport, err error) {
+	if err != nil {
+		m.runs.WithLabelValues(operation, "failure").Inc()
+		return
+	}
+
+	m.runs.WithLabelValues(operation, "success").Inc()
+	m.success.WithLabelValues(operation).Set(float64(time.Now().Unix()))
+	for outcome, IDs := range map[string][]string{
+		"created": report.Created,
+		"updated": report.Updated,
+		"skipped": report.Skipped,
+		"deleted": report.Deleted,
+	} {
+		m.lastRun.WithLabelValues(operation, outcome).Set(float64(len(IDs)))
+	}
+	m.lastRun.WithLabelValues(operation, "failed").Set(float64(len(report.Failed)))
+}
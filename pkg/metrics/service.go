@@ -0,0 +1,334 @@
+// Package metrics provides Prometheus metrics of the ports server.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+const (
+	// namespace is a prefix of all metrics.
+	namespace = "ports"
+	// countTimeout is time for counting ports when metrics are scraped.
+	countTimeout = 5 * time.Second
+)
+
+// Operations of a port's service.
+const (
+	operationCreate = iota
+	operationGet
+	operationUpdate
+	operationUpdateIfRevision
+	operationModify
+	operationDelete
+	operationList
+	operationNearest
+	operationWithinRadius
+	operationWithinBoundingBox
+	operationCount
+)
+
+// operationNames are label values of operations.
+var operationNames = [operationCount]string{
+	operationCreate:            "create",
+	operationGet:               "get",
+	operationUpdate:            "update",
+	operationUpdateIfRevision:  "update_if_revision",
+	operationModify:            "modify",
+	operationDelete:            "delete",
+	operationList:              "list",
+	operationNearest:           "nearest",
+	operationWithinRadius:      "within_radius",
+	operationWithinBoundingBox: "within_bounding_box",
+}
+
+// Results of operations of a port's service.
+const (
+	resultSuccess = iota
+	resultNotFound
+	resultAlreadyExists
+	resultRevisionMismatch
+	// resultInvalid means that a caller has provided invalid coordinates, cursor or sort field.
+	resultInvalid
+	// resultAborted means that a modify function has returned an error.
+	resultAborted
+	resultError
+	resultCount
+)
+
+// resultNames are label values of results.
+var resultNames = [resultCount]string{
+	resultSuccess:          "success",
+	resultNotFound:         "not_found",
+	resultAlreadyExists:    "already_exists",
+	resultRevisionMismatch: "revision_mismatch",
+	resultInvalid:          "invalid",
+	resultAborted:          "aborted",
+	resultError:            "error",
+}
+
+// operationMetrics are metrics of a single operation. They are resolved when a service is created, because finding
+// metrics by their labels takes a lock, and an operation then only updates atomic values.
+type operationMetrics struct {
+	results  [resultCount]prometheus.Counter
+	duration prometheus.Observer
+}
+
+// portService counts operations of a port's service, and it measures their duration.
+type portService struct {
+	svc        ports.PortService
+	operations [operationCount]operationMetrics
+}
+
+// geoPortService is a port's service which can also search ports by coordinates.
+type geoPortService struct {
+	*portService
+	geo ports.GeoService
+}
+
+// NewPortService wraps a port's service, so its operations are observed in metrics registered in a registerer.
+// A number of stored ports is observed when a service implements ports.Counter.
+// The returned service implements ports.GeoService when a given service does.
+func NewPortService(svc ports.PortService, registerer prometheus.Registerer) (ports.PortService, error) {
+	operations := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "service_operations_total",
+		Help:      "Number of operations of the port's service by their results.",
+	}, []string{"operation", "result"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "service_operation_duration_seconds",
+		Help:      "Duration of operations of the port's service.",
+		Buckets:   []float64{.00001, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+	collectors := []prometheus.Collector{operations, duration}
+
+	if counter, ok := svc.(ports.Counter); ok {
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stored",
+			Help:      "Number of stored ports.",
+		}, func() float64 {
+			ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+			defer cancel()
+
+			count, err := counter.Count(ctx)
+			if err != nil {
+				return -1
+			}
+
+			return float64(count)
+		}))
+	}
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &portService{svc: svc}
+	for operation, name := range operationNames {
+		for result, resultName := range resultNames {
+			p.operations[operation].results[result] = operations.WithLabelValues(name, resultName)
+		}
+		p.operations[operation].duration = duration.WithLabelValues(name)
+	}
+
+	if geo, ok := svc.(ports.GeoService); ok {
+		return &geoPortService{portService: p, geo: geo}, nil
+	}
+
+	return p, nil
+}
+
+// observe observes an operation which has started at a given time.
+func (p *portService) observe(operation int, start time.Time, result int) {
+	p.operations[operation].duration.Observe(time.Since(start).Seconds())
+	p.operations[operation].results[result].Inc()
+}
+
+// result returns a result of an operation.
+func result(err error) int {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case errors.Is(err, ports.ErrPortNotFound):
+		return resultNotFound
+	case errors.Is(err, ports.ErrPortAlreadyExist):
+		return resultAlreadyExists
+	case errors.Is(err, ports.ErrRevisionMismatch):
+		return resultRevisionMismatch
+	case errors.Is(err, ports.ErrInvalidCoordinates), errors.Is(err, ports.ErrInvalidCursor),
+		errors.Is(err, ports.ErrInvalidSortField):
+		return resultInvalid
+	default:
+		return resultError
+	}
+}
+
+// Create creates a new port entry.
+func (p *portService) Create(ctx context.Context, ID string, port ports.Port) error {
+	start := time.Now()
+	err := p.svc.Create(ctx, ID, port)
+	p.observe(operationCreate, start, result(err))
+
+	return err
+}
+
+// CreateReturning creates a new port entry, and it returns the stored port.
+func (p *portService) CreateReturning(ctx context.Context, ID string, port ports.Port) (ports.Port, error) {
+	start := time.Now()
+	created, err := ports.CreateReturning(ctx, p.svc, ID, port)
+	p.observe(operationCreate, start, result(err))
+
+	return created, err
+}
+
+// Get returns port for a given port's ID.
+func (p *portService) Get(ctx context.Context, ID string) (ports.Port, error) {
+	start := time.Now()
+	port, err := p.svc.Get(ctx, ID)
+	p.observe(operationGet, start, result(err))
+
+	return port, err
+}
+
+// Update updates an existing port.
+func (p *portService) Update(ctx context.Context, ID string, port ports.Port) error {
+	start := time.Now()
+	err := p.svc.Update(ctx, ID, port)
+	p.observe(operationUpdate, start, result(err))
+
+	return err
+}
+
+// UpdateIfRevision updates an existing port only when it has a given revision.
+func (p *portService) UpdateIfRevision(ctx context.Context, ID string, revision uint64, port ports.Port) error {
+	start := time.Now()
+	err := p.svc.UpdateIfRevision(ctx, ID, revision, port)
+	p.observe(operationUpdateIfRevision, start, result(err))
+
+	return err
+}
+
+// Modify reads an existing port, modifies it and stores the result atomically.
+// An error of a modify function is observed as aborted operation instead of a failure of a service.
+func (p *portService) Modify(ctx context.Context, ID string, modify ports.ModifyFunc) (ports.Port, error) {
+	start := time.Now()
+	var modifyErr error
+	port, err := p.svc.Modify(ctx, ID, func(port ports.Port) (ports.Port, error) {
+		port, modifyErr = modify(port)
+		return port, modifyErr
+	})
+
+	res := result(err)
+	if err != nil && modifyErr != nil && errors.Is(err, modifyErr) {
+		res = resultAborted
+	}
+	p.observe(operationModify, start, res)
+
+	return port, err
+}
+
+// Delete deletes an existing port.
+func (p *portService) Delete(ctx context.Context, ID string) error {
+	start := time.Now()
+	err := p.svc.Delete(ctx, ID)
+	p.observe(operationDelete, start, result(err))
+
+	return err
+}
+
+// DeleteReturning deletes an existing port, and it returns the deleted port.
+func (p *portService) DeleteReturning(ctx context.Context, ID string) (ports.Port, error) {
+	start := time.Now()
+	deleted, err := ports.DeleteReturning(ctx, p.svc, ID)
+	p.observe(operationDelete, start, result(err))
+
+	return deleted, err
+}
+
+// List returns a page of ports which match given options.
+func (p *portService) List(ctx context.Context, options ports.ListOptions) (ports.PortList, error) {
+	start := time.Now()
+	list, err := p.svc.List(ctx, options)
+	p.observe(operationList, start, result(err))
+
+	return list, err
+}
+
+// Count returns a number of stored ports when a wrapped service implements ports.Counter.
+func (p *portService) Count(ctx context.Context) (int, error) {
+	counter, ok := p.svc.(ports.Counter)
+	if !ok {
+		return 0, errors.New("port's service does not count ports")
+	}
+
+	return counter.Count(ctx)
+}
+
+// Watch watches changes of a wrapped service when it implements ports.Watcher.
+func (p *portService) Watch(ctx context.Context, fromRevision uint64) (<-chan ports.WatchEvent, error) {
+	watcher, ok := p.svc.(ports.Watcher)
+	if !ok {
+		return nil, ports.ErrWatchNotSupported
+	}
+
+	return watcher.Watch(ctx, fromRevision)
+}
+
+// Ping checks a wrapped service when it implements ports.Pinger.
+func (p *portService) Ping(ctx context.Context) error {
+	if pinger, ok := p.svc.(ports.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Close closes a wrapped service when it implements io.Closer.
+func (p *portService) Close() error {
+	if closer, ok := p.svc.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// Nearest returns at most k ports which are the nearest to a point.
+func (g *geoPortService) Nearest(ctx context.Context, point ports.Point, k int) ([]ports.PortWithDistance, error) {
+	start := time.Now()
+	found, err := g.geo.Nearest(ctx, point, k)
+	g.observe(operationNearest, start, result(err))
+
+	return found, err
+}
+
+// WithinRadius returns ports which are not further from a point than a radius in kilometers.
+func (g *geoPortService) WithinRadius(
+	ctx context.Context, point ports.Point, radius float64,
+) ([]ports.PortWithDistance, error) {
+	start := time.Now()
+	found, err := g.geo.WithinRadius(ctx, point, radius)
+	g.observe(operationWithinRadius, start, result(err))
+
+	return found, err
+}
+
+// WithinBoundingBox returns ports inside a bounding box, and distance is measured from a given point.
+func (g *geoPortService) WithinBoundingBox(
+	ctx context.Context, box ports.BoundingBox, from ports.Point,
+) ([]ports.PortWithDistance, error) {
+	start := time.Now()
+	found, err := g.geo.WithinBoundingBox(ctx, box, from)
+	g.observe(operationWithinBoundingBox, start, result(err))
+
+	return found, err
+}
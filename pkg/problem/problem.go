@@ -0,0 +1,55 @@
+// Package problem sends errors of the ports server as Problem Details for HTTP APIs (RFC 7807).
+//
+// Every error response has `application/problem+json` content type, so a caller can always parse it the same way.
+// A problem of invalid fields of a request lists them with their JSON paths.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	api "github.com/informalict/ports/api/v1"
+)
+
+// New returns a problem of a request with a status and a detail.
+func New(r *http.Request, status int, detail string) api.Problem {
+	return api.Problem{
+		Type:     api.BlankProblemType,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+}
+
+// Invalid returns a problem of a request whose fields are not valid. Its status is 400.
+func Invalid(r *http.Request, detail string, errs ...api.FieldError) api.Problem {
+	p := New(r, http.StatusBadRequest, detail)
+	p.Type = api.ValidationProblemType
+	p.Title = "Request is not valid"
+	p.Errors = errs
+
+	return p
+}
+
+// Error sends a problem with a status and a detail. It replaces http.Error, which sends plain text.
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	Write(w, New(r, status, detail))
+}
+
+// Write sends a problem with its status.
+func Write(w http.ResponseWriter, p api.Problem) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, p.Detail, p.Status)
+		return
+	}
+
+	// A problem replaces a response which has been prepared for a success, and it is not a port's representation.
+	w.Header().Del("Content-Length")
+	w.Header().Del("ETag")
+	w.Header().Set("Content-Type", api.ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_, _ = w.Write(append(b, '\n'))
+}
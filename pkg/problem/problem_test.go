@@ -0,0 +1,59 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	api "github.com/informalict/ports/api/v1"
+)
+
+func TestWrite(t *testing.T) {
+	read := func(t *testing.T, w *httptest.ResponseRecorder) api.Problem {
+		require.Equal(t, api.ProblemContentType, w.Header().Get("Content-Type"))
+		require.Empty(t, w.Header().Get("ETag"), "headers of a successful response must be removed")
+
+		var p api.Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+
+		return p
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/ports/test?revision=1", nil)
+
+	passed := t.Run("error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"1"`)
+		Error(w, r, "port is not found", http.StatusNotFound)
+
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.Equal(t, api.Problem{
+			Type:     api.BlankProblemType,
+			Title:    "Not Found",
+			Status:   http.StatusNotFound,
+			Detail:   "port is not found",
+			Instance: "/api/v1/ports/test",
+		}, read(t, w))
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid fields", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		fieldErr := api.FieldError{Field: "$.name", Message: "port's name can not be empty"}
+		Write(w, Invalid(r, fieldErr.Message, fieldErr))
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, api.Problem{
+			Type:     api.ValidationProblemType,
+			Title:    "Request is not valid",
+			Status:   http.StatusBadRequest,
+			Detail:   "port's name can not be empty",
+			Instance: "/api/v1/ports/test",
+			Errors:   []api.FieldError{fieldErr},
+		}, read(t, w))
+	})
+	require.True(t, passed)
+}
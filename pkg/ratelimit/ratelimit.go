@@ -0,0 +1,294 @@
+// Package ratelimit limits rates of requests of every client with token buckets.
+//
+// A client is identified by an authenticated subject, or by its IP address. Every client has a separate bucket
+// for every budget, e.g. reads and writes, so a client which floods writes can still read. Failed authentications
+// are limited by IP addresses before requests are authenticated, so credentials can not be guessed quickly.
+// Limits can be changed while the server is running, and buckets which exist keep their tokens.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/internal/response"
+	"github.com/informalict/ports/pkg/problem"
+)
+
+// Budget is a kind of requests which have their own limit.
+type Budget string
+
+const (
+	// Unlimited is a budget of requests which are not limited.
+	Unlimited Budget = ""
+	// Read is a budget of requests which do not change anything.
+	Read Budget = "read"
+	// Write is a budget of requests which change something.
+	Write Budget = "write"
+	// FailedAuth is a budget of requests of an IP address which are rejected with 401.
+	FailedAuth Budget = "failedAuth"
+)
+
+// sweepInterval is time between removals of buckets which are full, so idle clients do not take memory.
+const sweepInterval = time.Minute
+
+// Limit describes a token bucket.
+type Limit struct {
+	// Rate is a number of requests per second. A budget is not limited when it is zero.
+	Rate float64 `yaml:"rate"`
+	// Burst is a number of requests which can be sent at once. It is at least one.
+	Burst int `yaml:"burst"`
+}
+
+// Enabled checks whether a limit limits anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0
+}
+
+// burst returns a capacity of a bucket.
+func (l Limit) burst() float64 {
+	return math.Max(float64(l.Burst), 1)
+}
+
+// Limits describes limits of budgets.
+type Limits struct {
+	// Read limits reads of every client.
+	Read Limit `yaml:"read"`
+	// Write limits writes of every client.
+	Write Limit `yaml:"write"`
+	// FailedAuth limits failed authentications of every IP address.
+	FailedAuth Limit `yaml:"failedAuth"`
+}
+
+// limit returns a limit of a budget.
+func (l Limits) limit(budget Budget) Limit {
+	switch budget {
+	case Read:
+		return l.Read
+	case Write:
+		return l.Write
+	case FailedAuth:
+		return l.FailedAuth
+	default:
+		return Limit{}
+	}
+}
+
+// Result describes whether a request is allowed, and a state of its bucket.
+type Result struct {
+	// Allowed is true when a request can be handled.
+	Allowed bool
+	// Limit is a capacity of a bucket.
+	Limit int
+	// Remaining is a number of requests which can be sent at once now.
+	Remaining int
+	// Reset is time until a bucket is full again.
+	Reset time.Duration
+	// RetryAfter is time until a next request is allowed, when this one is not.
+	RetryAfter time.Duration
+}
+
+// bucketKey identifies a bucket of a client's budget.
+type bucketKey struct {
+	budget Budget
+	client string
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64
+	// last is time when tokens have been counted.
+	last time.Time
+}
+
+// Limiter limits rates of requests of clients.
+type Limiter struct {
+	mutex     sync.Mutex
+	limits    Limits
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New returns a limiter with given limits.
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:    limits,
+		buckets:   make(map[bucketKey]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Update changes limits. Buckets keep their tokens up to new capacities.
+func (l *Limiter) Update(limits Limits) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.limits = limits
+}
+
+// Limits returns current limits.
+func (l *Limiter) Limits() Limits {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.limits
+}
+
+// Allow takes a token from a bucket of a client's budget. A request is allowed when a budget is not limited.
+func (l *Limiter) Allow(budget Budget, client string) Result {
+	return l.take(budget, client, 1)
+}
+
+// Check returns whether a client has a token in a bucket of its budget, without taking it.
+func (l *Limiter) Check(budget Budget, client string) Result {
+	return l.take(budget, client, 0)
+}
+
+// take takes a given number of tokens from a bucket of a client's budget, when the bucket has at least one token.
+func (l *Limiter) take(budget Budget, client string, tokens float64) Result {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limit := l.limits.limit(budget)
+	if !limit.Enabled() {
+		return Result{Allowed: true}
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	key := bucketKey{budget: budget, client: client}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst(), last: now}
+		l.buckets[key] = b
+	}
+	refill(b, limit, now)
+
+	result := Result{Allowed: b.tokens >= 1, Limit: int(limit.burst())}
+	if result.Allowed {
+		b.tokens -= tokens
+	} else {
+		result.RetryAfter = seconds(1-b.tokens, limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds(limit.burst()-b.tokens, limit.Rate)
+
+	return result
+}
+
+// refill adds tokens to a bucket for time since they have been counted, up to its capacity.
+func refill(b *bucket, limit Limit, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * limit.Rate
+	}
+	b.tokens = math.Min(b.tokens, limit.burst())
+	b.last = now
+}
+
+// seconds returns time in which a given number of tokens is added with a given rate.
+func seconds(tokens, rate float64) time.Duration {
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+// sweep removes buckets which are full, because they are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		limit := l.limits.limit(key.budget)
+		if !limit.Enabled() {
+			delete(l.buckets, key)
+			continue
+		}
+
+		refill(b, limit, now)
+		if b.tokens >= limit.burst() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware limits requests of every client in a budget which is returned for a request.
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set for every limited request,
+// and 429 with Retry-After header is returned when a client has used its budget.
+func (l *Limiter) Middleware(budget func(r *http.Request) Budget, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := budget(r)
+		if b == Unlimited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := l.Allow(b, Client(r))
+		if result.Limit > 0 {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		}
+		if !result.Allowed {
+			tooManyRequests(w, r, result, "rate limit is exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FailedAuthMiddleware limits failed authentications of every IP address in FailedAuth budget. It runs before
+// authentication, and every response with 401 takes a token of a caller's address. 429 with Retry-After header
+// is returned when an address has used its budget, so credentials can not be guessed.
+func (l *Limiter) FailedAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := address(r)
+		if result := l.Check(FailedAuth, client); !result.Allowed {
+			tooManyRequests(w, r, result, "too many failed authentications")
+			return
+		}
+
+		recorder := response.NewRecorder(w)
+		next.ServeHTTP(recorder, r)
+		if recorder.Status() == http.StatusUnauthorized {
+			l.Allow(FailedAuth, client)
+		}
+	})
+}
+
+// tooManyRequests responds with 429 and time until a next request is allowed.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, result Result, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	problem.Error(w, r, message, http.StatusTooManyRequests)
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Client identifies a client of a request by its authenticated subject, or by its IP address.
+func Client(r *http.Request) string {
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		return "subject:" + identity.Subject
+	}
+
+	return address(r)
+}
+
+// address identifies a client of a request by its IP address.
+func address(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
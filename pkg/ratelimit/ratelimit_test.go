@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/auth"
+)
+
+// clock is time of a limiter in tests.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newLimiter returns a limiter whose time is moved by a clock.
+func newLimiter(limits Limits) (*Limiter, *clock) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	l := New(limits)
+	l.now = func() time.Time { return c.now }
+	l.lastSweep = c.now
+
+	return l, c
+}
+
+func TestLimiter(t *testing.T) { // nolint: funlen
+	passed := t.Run("token bucket", func(t *testing.T) {
+		l, c := newLimiter(Limits{Read: Limit{Rate: 2, Burst: 3}})
+
+		for i := 2; i >= 0; i-- {
+			result := l.Allow(Read, "ip:1")
+			require.True(t, result.Allowed)
+			require.Equal(t, 3, result.Limit)
+			require.Equal(t, i, result.Remaining)
+		}
+
+		result := l.Allow(Read, "ip:1")
+		require.False(t, result.Allowed)
+		require.Equal(t, 0, result.Remaining)
+		require.Equal(t, 500*time.Millisecond, result.RetryAfter)
+		require.Equal(t, 1500*time.Millisecond, result.Reset)
+
+		c.advance(500 * time.Millisecond)
+		require.True(t, l.Allow(Read, "ip:1").Allowed)
+		require.False(t, l.Allow(Read, "ip:1").Allowed)
+
+		c.advance(time.Hour)
+		require.Equal(t, 2, l.Allow(Read, "ip:1").Remaining, "bucket must not exceed its burst")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("clients and budgets are separate", func(t *testing.T) {
+		l, _ := newLimiter(Limits{Read: Limit{Rate: 1, Burst: 1}, Write: Limit{Rate: 1}})
+
+		require.True(t, l.Allow(Write, "ip:1").Allowed)
+		require.False(t, l.Allow(Write, "ip:1").Allowed, "burst is at least one")
+		require.True(t, l.Allow(Read, "ip:1").Allowed)
+		require.True(t, l.Allow(Write, "ip:2").Allowed)
+		require.True(t, l.Allow(Unlimited, "ip:1").Allowed)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("update limits", func(t *testing.T) {
+		l, c := newLimiter(Limits{})
+		for i := 0; i < 100; i++ {
+			require.True(t, l.Allow(Write, "ip:1").Allowed, "budget without rate is not limited")
+		}
+
+		l.Update(Limits{Write: Limit{Rate: 1, Burst: 5}})
+		require.Equal(t, Limits{Write: Limit{Rate: 1, Burst: 5}}, l.Limits())
+		for i := 0; i < 5; i++ {
+			require.True(t, l.Allow(Write, "ip:1").Allowed)
+		}
+		require.False(t, l.Allow(Write, "ip:1").Allowed)
+
+		l.Update(Limits{Write: Limit{Rate: 10, Burst: 2}})
+		c.advance(100 * time.Millisecond)
+		result := l.Allow(Write, "ip:1")
+		require.True(t, result.Allowed, "bucket must keep its state with a new rate")
+		require.Equal(t, 2, result.Limit)
+		require.Equal(t, 0, result.Remaining)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("full buckets are removed", func(t *testing.T) {
+		l, c := newLimiter(Limits{Read: Limit{Rate: 0.1, Burst: 10}})
+		l.Allow(Read, "ip:1")
+		for i := 0; i < 10; i++ {
+			l.Allow(Read, "ip:2")
+		}
+		require.Len(t, l.buckets, 2)
+
+		c.advance(sweepInterval)
+		l.Allow(Read, "ip:3")
+		require.Len(t, l.buckets, 2, "only a bucket of ip:1 must be full again")
+	})
+	require.True(t, passed)
+}
+
+func TestMiddleware(t *testing.T) {
+	l, _ := newLimiter(Limits{Read: Limit{Rate: 0.5, Burst: 2}})
+	budget := func(r *http.Request) Budget {
+		if r.URL.Path == "/healthz" {
+			return Unlimited
+		}
+		return Read
+	}
+	handler := l.Middleware(budget, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(path, remoteAddr string, identity *auth.Identity) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remoteAddr
+		if identity != nil {
+			r = r.WithContext(auth.WithIdentity(r.Context(), *identity))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := do("/ports", "192.0.2.1:1234", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+
+	require.Equal(t, http.StatusOK, do("/ports", "192.0.2.1:5678", nil).Code)
+	w = do("/ports", "192.0.2.1:1234", nil)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+	require.Equal(t, api.ProblemContentType, w.Header().Get("Content-Type"))
+	require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "4", w.Header().Get("RateLimit-Reset"))
+
+	w = do("/healthz", "192.0.2.1:1234", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	identity := &auth.Identity{Subject: "ci", Role: auth.RoleEditor}
+	require.Equal(t, http.StatusOK, do("/ports", "192.0.2.1:1234", identity).Code, "subject must have its own budget")
+	require.Equal(t, http.StatusOK, do("/ports", "192.0.2.2:1234", identity).Code)
+	require.Equal(t, http.StatusTooManyRequests, do("/ports", "192.0.2.3:1234", identity).Code,
+		"subject must have the same budget from every address")
+}
+
+func TestFailedAuthMiddleware(t *testing.T) {
+	l, c := newLimiter(Limits{FailedAuth: Limit{Rate: 0.5, Burst: 2}})
+	handler := l.FailedAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+
+	do := func(remoteAddr, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/ports", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, do("192.0.2.1:1234", "secret").Code, "successes must not be limited")
+	}
+	require.Equal(t, http.StatusUnauthorized, do("192.0.2.1:1234", "guess").Code)
+	require.Equal(t, http.StatusUnauthorized, do("192.0.2.1:5678", "guess").Code)
+
+	w := do("192.0.2.1:1234", "secret")
+	require.Equal(t, http.StatusTooManyRequests, w.Code, "address must be limited before its credentials are checked")
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+	require.Equal(t, api.ProblemContentType, w.Header().Get("Content-Type"))
+	require.Equal(t, http.StatusUnauthorized, do("192.0.2.2:1234", "guess").Code, "addresses must be separate")
+
+	c.advance(2 * time.Second)
+	require.Equal(t, http.StatusUnauthorized, do("192.0.2.1:1234", "guess").Code)
+	require.Equal(t, http.StatusTooManyRequests, do("192.0.2.1:1234", "secret").Code)
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// ActorHeader is a header with a name of who sends a request.
+	ActorHeader = "X-Actor"
+	// AnonymousActor is an actor of changes when nobody has been identified.
+	AnonymousActor = "anonymous"
+	// SeedActor is an actor of changes which are made by loading a seed file.
+	SeedActor = "seed"
+	// maxActorLength is a maximum length of an actor from a header, so audit events can not be flooded with it.
+	maxActorLength = 128
+)
+
+// actorKey is a key of an actor in a context.
+type actorKey struct{}
+
+// WithActor returns a context whose changes of ports are recorded with a given actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns an actor from a context, or AnonymousActor when a context does not have any.
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && len(actor) > 0 {
+		return actor
+	}
+
+	return AnonymousActor
+}
+
+// Middleware takes an actor of every request from ActorHeader, unless an actor has been already set,
+// e.g. by authentication. The header is trusted only when trustHeader is true, because any caller can send it.
+// It must be false when requests are authenticated, so anonymous callers can not forge actors of their changes.
+func Middleware(trustHeader bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(actorKey{}).(string); !ok && trustHeader {
+			if actor := r.Header.Get(ActorHeader); len(actor) > 0 && len(actor) <= maxActorLength {
+				r = r.WithContext(WithActor(r.Context(), actor))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
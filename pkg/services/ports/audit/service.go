@@ -0,0 +1,221 @@
+// Package audit records changes of ports as events with who has changed a port, when and how.
+//
+// A port's service is wrapped, so changes are recorded no matter whether they come from API, an import
+// or a seed file. Events are stored in a sink, and they are listed by ports.HistoryService.
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// portService records changes of ports which are made through a wrapped service.
+type portService struct {
+	svc    ports.PortService
+	sink   Sink
+	logger *slog.Logger
+	// now returns time of an event.
+	now func() time.Time
+}
+
+// geoPortService is a port's service which can also search ports by coordinates.
+type geoPortService struct {
+	*portService
+	geo ports.GeoService
+}
+
+// NewPortService wraps a port's service, so its changes are recorded in a sink. An actor of a change is taken
+// from a context with Actor. A change is not reverted when its event can not be stored, and the failure is logged.
+// Such a gap in a history is found from revisions of the following events by ports.PortAtRevision and ports.PortAsOf.
+// Ports before and after a change are taken from a wrapped service while it makes the change, so they are exact
+// even when other writers change the same port. Created and deleted ports are exact only when a wrapped service
+// implements ports.ReturningService. The returned service implements ports.HistoryService, and also
+// ports.GeoService when a given service does.
+func NewPortService(svc ports.PortService, sink Sink, logger *slog.Logger) ports.PortService {
+	p := &portService{
+		svc:    svc,
+		sink:   sink,
+		logger: logger,
+		now:    time.Now,
+	}
+
+	if geo, ok := svc.(ports.GeoService); ok {
+		return &geoPortService{portService: p, geo: geo}
+	}
+
+	return p
+}
+
+// record stores an event of a change. A failure is only logged, because a change has been already made.
+func (p *portService) record(ctx context.Context, action ports.Action, ID string, before, after *ports.Port) {
+	event := ports.Event{
+		PortID: ID,
+		Action: action,
+		Actor:  Actor(ctx),
+		Time:   p.now().UTC(),
+		Before: before,
+		After:  after,
+	}
+
+	// An event is stored even when a caller has gone away after a change.
+	if _, err := p.sink.Append(context.WithoutCancel(ctx), event); err != nil {
+		p.logger.ErrorContext(ctx, "failed to record audit event", "port_id", ID, "action", action, "error", err)
+	}
+}
+
+// Create creates a new port entry.
+func (p *portService) Create(ctx context.Context, ID string, port ports.Port) error {
+	_, err := p.CreateReturning(ctx, ID, port)
+
+	return err
+}
+
+// CreateReturning creates a new port entry, and it returns the stored port.
+func (p *portService) CreateReturning(ctx context.Context, ID string, port ports.Port) (ports.Port, error) {
+	after, err := ports.CreateReturning(ctx, p.svc, ID, port)
+	if err != nil {
+		return ports.Port{}, err
+	}
+	p.record(ctx, ports.ActionCreate, ID, nil, &after)
+
+	return after, nil
+}
+
+// Get returns port for a given port's ID.
+func (p *portService) Get(ctx context.Context, ID string) (ports.Port, error) {
+	return p.svc.Get(ctx, ID)
+}
+
+// Update updates an existing port. It is made by Modify of a wrapped service, so a port before an update is
+// the one which has been replaced.
+func (p *portService) Update(ctx context.Context, ID string, port ports.Port) error {
+	_, err := p.Modify(ctx, ID, func(ports.Port) (ports.Port, error) {
+		return port, nil
+	})
+
+	return err
+}
+
+// UpdateIfRevision updates an existing port only when it has a given revision. It is made by Modify of a wrapped
+// service, so a port before an update is the one which has been replaced.
+func (p *portService) UpdateIfRevision(ctx context.Context, ID string, revision uint64, port ports.Port) error {
+	_, err := p.Modify(ctx, ID, func(previous ports.Port) (ports.Port, error) {
+		if previous.Revision != revision {
+			return ports.Port{}, ports.ErrRevisionMismatch
+		}
+
+		return port, nil
+	})
+
+	return err
+}
+
+// Modify reads an existing port, modifies it and stores the result atomically.
+func (p *portService) Modify(ctx context.Context, ID string, modify ports.ModifyFunc) (ports.Port, error) {
+	// A modify function can be called more than once, and the last call is the one which has been stored.
+	var before ports.Port
+	after, err := p.svc.Modify(ctx, ID, func(port ports.Port) (ports.Port, error) {
+		before = port
+		return modify(port)
+	})
+	if err != nil {
+		return after, err
+	}
+
+	p.record(ctx, ports.ActionUpdate, ID, &before, &after)
+
+	return after, nil
+}
+
+// Delete deletes an existing port.
+func (p *portService) Delete(ctx context.Context, ID string) error {
+	_, err := p.DeleteReturning(ctx, ID)
+
+	return err
+}
+
+// DeleteReturning deletes an existing port, and it returns the deleted port.
+func (p *portService) DeleteReturning(ctx context.Context, ID string) (ports.Port, error) {
+	before, err := ports.DeleteReturning(ctx, p.svc, ID)
+	if err != nil {
+		return ports.Port{}, err
+	}
+	p.record(ctx, ports.ActionDelete, ID, &before, nil)
+
+	return before, nil
+}
+
+// List returns a page of ports which match given options.
+func (p *portService) List(ctx context.Context, options ports.ListOptions) (ports.PortList, error) {
+	return p.svc.List(ctx, options)
+}
+
+// Events returns a page of recorded events which match given options.
+func (p *portService) Events(ctx context.Context, options ports.EventListOptions) (ports.EventList, error) {
+	return p.sink.Events(ctx, options)
+}
+
+// Count returns a number of stored ports when a wrapped service implements ports.Counter.
+func (p *portService) Count(ctx context.Context) (int, error) {
+	counter, ok := p.svc.(ports.Counter)
+	if !ok {
+		return 0, errors.New("port's service does not count ports")
+	}
+
+	return counter.Count(ctx)
+}
+
+// Watch watches changes of a wrapped service when it implements ports.Watcher.
+func (p *portService) Watch(ctx context.Context, fromRevision uint64) (<-chan ports.WatchEvent, error) {
+	watcher, ok := p.svc.(ports.Watcher)
+	if !ok {
+		return nil, ports.ErrWatchNotSupported
+	}
+
+	return watcher.Watch(ctx, fromRevision)
+}
+
+// Ping checks a wrapped service when it implements ports.Pinger.
+func (p *portService) Ping(ctx context.Context) error {
+	if pinger, ok := p.svc.(ports.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Close closes a wrapped service and a sink when they implement io.Closer.
+func (p *portService) Close() error {
+	var errs []error
+	for _, v := range []interface{}{p.svc, p.sink} {
+		if closer, ok := v.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Nearest returns at most k ports which are the nearest to a point.
+func (g *geoPortService) Nearest(ctx context.Context, point ports.Point, k int) ([]ports.PortWithDistance, error) {
+	return g.geo.Nearest(ctx, point, k)
+}
+
+// WithinRadius returns ports which are not further from a point than a radius in kilometers.
+func (g *geoPortService) WithinRadius(
+	ctx context.Context, point ports.Point, radius float64,
+) ([]ports.PortWithDistance, error) {
+	return g.geo.WithinRadius(ctx, point, radius)
+}
+
+// WithinBoundingBox returns ports inside a bounding box, and distance is measured from a given point.
+func (g *geoPortService) WithinBoundingBox(
+	ctx context.Context, box ports.BoundingBox, from ports.Point,
+) ([]ports.PortWithDistance, error) {
+	return g.geo.WithinBoundingBox(ctx, box, from)
+}
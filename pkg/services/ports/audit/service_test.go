@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/memory"
+)
+
+// failingSink fails to store every event.
+type failingSink struct {
+	Sink
+}
+
+func (failingSink) Append(_ context.Context, event ports.Event) (ports.Event, error) {
+	return event, errors.New("disk is full")
+}
+
+// otherWriter changes a port right before every change, like another instance of the server does.
+type otherWriter struct {
+	ports.PortService
+}
+
+// change changes a city of a port in a wrapped service.
+func (w otherWriter) change(ctx context.Context, ID string) {
+	_, _ = w.PortService.Modify(ctx, ID, func(port ports.Port) (ports.Port, error) {
+		port.City = "other"
+		return port, nil
+	})
+}
+
+func (w otherWriter) Modify(ctx context.Context, ID string, modify ports.ModifyFunc) (ports.Port, error) {
+	w.change(ctx, ID)
+	return w.PortService.Modify(ctx, ID, modify)
+}
+
+func (w otherWriter) CreateReturning(ctx context.Context, ID string, port ports.Port) (ports.Port, error) {
+	return ports.CreateReturning(ctx, w.PortService, ID, port)
+}
+
+func (w otherWriter) DeleteReturning(ctx context.Context, ID string) (ports.Port, error) {
+	w.change(ctx, ID)
+	return ports.DeleteReturning(ctx, w.PortService, ID)
+}
+
+func TestPortService(t *testing.T) { // nolint: funlen
+	ctx := WithActor(context.Background(), "alice")
+	sink := NewMemorySink()
+	svc := NewPortService(memory.NewPortMemory(), sink, logging.Discard())
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc.(*geoPortService).now = func() time.Time { return now }
+	port := ports.Port{Name: "name", Country: "country", Coordinates: []float64{1, 2}}
+
+	// events returns all recorded events of a port.
+	events := func(t *testing.T, ID string) []ports.Event {
+		list, err := svc.(ports.HistoryService).Events(ctx, ports.EventListOptions{PortID: ID})
+		require.NoError(t, err)
+		return list.Events
+	}
+
+	passed := t.Run("changes are recorded", func(t *testing.T) {
+		require.NoError(t, svc.Create(ctx, "A", port))
+		created, err := svc.Get(ctx, "A")
+		require.NoError(t, err)
+
+		changed := port
+		changed.City = "city"
+		require.NoError(t, svc.UpdateIfRevision(ctx, "A", created.Revision, changed))
+		updated, err := svc.Get(ctx, "A")
+		require.NoError(t, err)
+
+		modified, err := svc.Modify(ctx, "A", func(port ports.Port) (ports.Port, error) {
+			port.Name = "new name"
+			return port, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, svc.Delete(ctx, "A"))
+
+		require.Equal(t, []ports.Event{
+			{Sequence: 1, PortID: "A", Action: ports.ActionCreate, Actor: "alice", Time: now, After: &created},
+			{Sequence: 2, PortID: "A", Action: ports.ActionUpdate, Actor: "alice", Time: now,
+				Before: &created, After: &updated},
+			{Sequence: 3, PortID: "A", Action: ports.ActionUpdate, Actor: "alice", Time: now,
+				Before: &updated, After: &modified},
+			{Sequence: 4, PortID: "A", Action: ports.ActionDelete, Actor: "alice", Time: now, Before: &modified},
+		}, events(t, "A"))
+		require.Equal(t, []ports.Change{{Field: "name", Before: "name", After: "new name"}},
+			events(t, "A")[2].Changes())
+	})
+	require.True(t, passed)
+
+	passed = t.Run("failed changes are not recorded", func(t *testing.T) {
+		require.ErrorIs(t, svc.Update(ctx, "B", port), ports.ErrPortNotFound)
+		require.ErrorIs(t, svc.Delete(ctx, "B"), ports.ErrPortNotFound)
+
+		require.NoError(t, svc.Create(context.Background(), "B", port))
+		require.ErrorIs(t, svc.Create(ctx, "B", port), ports.ErrPortAlreadyExist)
+		require.ErrorIs(t, svc.UpdateIfRevision(ctx, "B", 1, port), ports.ErrRevisionMismatch)
+		abortErr := errors.New("aborted")
+		_, err := svc.Modify(ctx, "B", func(ports.Port) (ports.Port, error) {
+			return ports.Port{}, abortErr
+		})
+		require.ErrorIs(t, err, abortErr)
+
+		recorded := events(t, "B")
+		require.Len(t, recorded, 1)
+		require.Equal(t, AnonymousActor, recorded[0].Actor)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("changes of other writers are not recorded as own", func(t *testing.T) {
+		svc := NewPortService(otherWriter{PortService: memory.NewPortMemory()}, NewMemorySink(), logging.Discard())
+		require.NoError(t, svc.Create(ctx, "A", port))
+		changed := port
+		changed.Name = "changed"
+		require.NoError(t, svc.Update(ctx, "A", changed))
+		require.NoError(t, svc.Delete(ctx, "A"))
+
+		list, err := svc.(ports.HistoryService).Events(ctx, ports.EventListOptions{PortID: "A"})
+		require.NoError(t, err)
+		require.Len(t, list.Events, 3)
+		update, deletion := list.Events[1], list.Events[2]
+		require.Equal(t, "other", update.Before.City, "a port before an update must be the replaced one")
+		require.Equal(t, uint64(2), update.Before.Revision)
+		require.Equal(t, uint64(3), update.After.Revision)
+		require.Equal(t, "other", deletion.Before.City, "a deleted port must be the one which has been deleted")
+		require.Equal(t, uint64(4), deletion.Before.Revision)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("change is not reverted when event is not stored", func(t *testing.T) {
+		svc := NewPortService(memory.NewPortMemory(), failingSink{}, logging.Discard())
+		require.NoError(t, svc.Create(ctx, "A", port))
+
+		_, err := svc.Get(ctx, "A")
+		require.NoError(t, err)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("optional interfaces are forwarded", func(t *testing.T) {
+		_, ok := svc.(ports.GeoService)
+		require.True(t, ok)
+
+		count, err := svc.(ports.Counter).Count(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+	})
+	require.True(t, passed)
+}
+
+func TestMiddleware(t *testing.T) {
+	// actor returns an actor which is seen by a handler.
+	actor := func(t *testing.T, ctx context.Context, header string, trustHeader bool) string {
+		var actor string
+		handler := Middleware(trustHeader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor = Actor(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		if len(header) > 0 {
+			req.Header.Set(ActorHeader, header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		return actor
+	}
+
+	require.Equal(t, "alice", actor(t, context.Background(), "alice", true))
+	require.Equal(t, AnonymousActor, actor(t, context.Background(), "", true))
+	require.Equal(t, AnonymousActor, actor(t, context.Background(), string(make([]byte, maxActorLength+1)), true))
+	require.Equal(t, "bob", actor(t, WithActor(context.Background(), "bob"), "alice", true),
+		"an authenticated actor must not be replaced by a header")
+	require.Equal(t, AnonymousActor, actor(t, context.Background(), "alice", false),
+		"a header must be ignored when it is not trusted")
+}
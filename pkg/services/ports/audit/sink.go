@@ -0,0 +1,360 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// Sink stores audit events.
+type Sink interface {
+	// Append stores an event, and it returns the event with its sequence.
+	Append(ctx context.Context, event ports.Event) (ports.Event, error)
+	// Events returns a page of stored events in order of their sequences.
+	Events(ctx context.Context, options ports.EventListOptions) (ports.EventList, error)
+}
+
+// NewMemorySink returns a sink which keeps events in memory, so they are lost when the server stops.
+func NewMemorySink() *memorySink {
+	return &memorySink{
+		byPort: make(map[string][]int),
+	}
+}
+
+type memorySink struct {
+	// mutex locks this structure when events are appended or listed.
+	mutex sync.RWMutex
+	// events are in order of their sequences.
+	events []ports.Event
+	// byPort contains indexes of events of every port.
+	byPort map[string][]int
+}
+
+// Append stores an event with a next sequence.
+func (s *memorySink) Append(_ context.Context, event ports.Event) (ports.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event.Sequence = s.lastSequence() + 1
+	s.add(event)
+
+	return event, nil
+}
+
+// lastSequence returns a sequence of the last event, or zero when there are no events.
+// The caller must hold the mutex.
+func (s *memorySink) lastSequence() uint64 {
+	if len(s.events) == 0 {
+		return 0
+	}
+
+	return s.events[len(s.events)-1].Sequence
+}
+
+// add stores an event which already has a sequence. The caller must hold the mutex.
+func (s *memorySink) add(event ports.Event) {
+	s.byPort[event.PortID] = append(s.byPort[event.PortID], len(s.events))
+	s.events = append(s.events, event)
+}
+
+// Events returns a page of events after a sequence from a cursor.
+func (s *memorySink) Events(_ context.Context, options ports.EventListOptions) (ports.EventList, error) {
+	after, err := parseCursor(options.Cursor)
+	if err != nil {
+		return ports.EventList{}, err
+	}
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = ports.DefaultListLimit
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// event returns the i-th event which matches options.
+	event := func(i int) ports.Event { return s.events[i] }
+	count := len(s.events)
+	if len(options.PortID) > 0 {
+		indexes := s.byPort[options.PortID]
+		event = func(i int) ports.Event { return s.events[indexes[i]] }
+		count = len(indexes)
+	}
+
+	start, end := selectPage(count, func(i int) uint64 { return event(i).Sequence }, after, limit)
+	list := ports.EventList{Events: make([]ports.Event, 0, end-start)}
+	for i := start; i < end; i++ {
+		list.Events = append(list.Events, event(i))
+	}
+
+	if end < count {
+		list.NextCursor = strconv.FormatUint(list.Events[len(list.Events)-1].Sequence, 10)
+	}
+
+	return list, nil
+}
+
+// selectPage returns a range of the first events after a sequence, up to a limit, from a given number of events
+// in order of their sequences.
+func selectPage(count int, sequence func(i int) uint64, after uint64, limit int) (start, end int) {
+	start = sort.Search(count, func(i int) bool { return sequence(i) > after })
+
+	return start, start + min(limit, count-start)
+}
+
+// parseCursor returns a sequence after which a page starts. A cursor is a sequence of the last event
+// on a previous page.
+func parseCursor(cursor string) (uint64, error) {
+	if len(cursor) == 0 {
+		return 0, nil
+	}
+
+	after, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, ports.ErrInvalidCursor
+	}
+
+	return after, nil
+}
+
+// NewFileSink returns a sink which appends events to a file, one JSON object per line.
+// Events which have been stored in the file before are indexed, and only their sequences, ports' IDs and offsets
+// are kept in memory, so events are listed by reading them from the file.
+func NewFileSink(path string) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileSink{
+		byPort: make(map[string][]int),
+	}
+	if err := s.load(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to load audit events: %w", err)
+	}
+	s.file = file
+
+	return s, nil
+}
+
+// auditFile is a file which is opened for appending and reading events. It is an interface, so failures of a disk
+// can be tested.
+type auditFile interface {
+	io.Writer
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// eventLocation locates an event in a file.
+type eventLocation struct {
+	sequence uint64
+	offset   int64
+	size     int
+}
+
+type fileSink struct {
+	// mutex locks this structure when events are appended, so they are written in order of their sequences.
+	// Events are listed with a read lock.
+	mutex sync.RWMutex
+	// file is opened for appending and reading events.
+	file auditFile
+	// failed is set when a failed write can not be undone, so the file does not match its index anymore,
+	// and then all events are rejected until the sink is opened again.
+	failed error
+	// locations are in order of sequences of events.
+	locations []eventLocation
+	// byPort contains indexes of locations of events of every port.
+	byPort map[string][]int
+}
+
+// load indexes all events from a file, and it leaves the file at the end of the last complete event.
+// The last event is removed when it is not complete, because process could have crashed during writing it.
+func (s *fileSink) load(file *os.File) error {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// The last event has not been fully written, so it has never been acknowledged.
+				if err := file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var event ports.Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("corrupted event at offset %d: %w", offset, err)
+		}
+		s.add(event, offset, len(line))
+		offset += int64(len(line))
+	}
+
+	_, err := file.Seek(offset, io.SeekStart)
+
+	return err
+}
+
+// add indexes an event which is stored at an offset. The caller must hold the mutex.
+func (s *fileSink) add(event ports.Event, offset int64, size int) {
+	s.byPort[event.PortID] = append(s.byPort[event.PortID], len(s.locations))
+	s.locations = append(s.locations, eventLocation{sequence: event.Sequence, offset: offset, size: size})
+}
+
+// Append writes an event with a next sequence to the file, and syncs it to a disk.
+func (s *fileSink) Append(_ context.Context, event ports.Event) (ports.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return event, errors.New("audit file is closed")
+	}
+	if s.failed != nil {
+		return event, s.failed
+	}
+
+	event.Sequence = 1
+	if len(s.locations) > 0 {
+		event.Sequence = s.locations[len(s.locations)-1].sequence + 1
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return event, err
+	}
+
+	offset, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return event, fmt.Errorf("failed to read audit file's offset: %w", err)
+	}
+
+	b = append(b, '\n')
+	if _, err := s.file.Write(b); err != nil {
+		return event, s.rollback(offset, fmt.Errorf("failed to write audit event: %w", err))
+	}
+	if err := s.file.Sync(); err != nil {
+		return event, s.rollback(offset, fmt.Errorf("failed to sync audit file: %w", err))
+	}
+
+	s.add(event, offset, len(b))
+
+	return event, nil
+}
+
+// rollback removes an event which has not been acknowledged from the file, so a next event is not appended after
+// a torn line, and its sequence is not duplicated. When the file can not be truncated, then the sink is failed,
+// because it does not match events in memory. The caller must hold the mutex.
+func (s *fileSink) rollback(offset int64, err error) error {
+	if truncateErr := s.file.Truncate(offset); truncateErr != nil {
+		s.failed = fmt.Errorf("audit sink is failed: %w", errors.Join(err, truncateErr))
+		return s.failed
+	}
+	if _, seekErr := s.file.Seek(offset, io.SeekStart); seekErr != nil {
+		s.failed = fmt.Errorf("audit sink is failed: %w", errors.Join(err, seekErr))
+		return s.failed
+	}
+	if syncErr := s.file.Sync(); syncErr != nil {
+		s.failed = fmt.Errorf("audit sink is failed: %w", errors.Join(err, syncErr))
+		return s.failed
+	}
+
+	return err
+}
+
+// Events returns a page of events after a sequence from a cursor. Events are read from the file.
+func (s *fileSink) Events(_ context.Context, options ports.EventListOptions) (ports.EventList, error) {
+	after, err := parseCursor(options.Cursor)
+	if err != nil {
+		return ports.EventList{}, err
+	}
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = ports.DefaultListLimit
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.file == nil {
+		return ports.EventList{}, errors.New("audit file is closed")
+	}
+
+	// location returns a location of the i-th event which matches options.
+	location := func(i int) eventLocation { return s.locations[i] }
+	count := len(s.locations)
+	if len(options.PortID) > 0 {
+		indexes := s.byPort[options.PortID]
+		location = func(i int) eventLocation { return s.locations[indexes[i]] }
+		count = len(indexes)
+	}
+
+	start, end := selectPage(count, func(i int) uint64 { return location(i).sequence }, after, limit)
+	list := ports.EventList{Events: make([]ports.Event, 0, end-start)}
+	for i := start; i < end; i++ {
+		event, err := s.read(location(i))
+		if err != nil {
+			return ports.EventList{}, err
+		}
+		list.Events = append(list.Events, event)
+	}
+
+	if end < count {
+		list.NextCursor = strconv.FormatUint(list.Events[len(list.Events)-1].Sequence, 10)
+	}
+
+	return list, nil
+}
+
+// read reads an event from the file. The caller must hold the mutex.
+func (s *fileSink) read(location eventLocation) (ports.Event, error) {
+	b := make([]byte, location.size)
+	if _, err := s.file.ReadAt(b, location.offset); err != nil {
+		return ports.Event{}, fmt.Errorf("failed to read audit event %d: %w", location.sequence, err)
+	}
+
+	var event ports.Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return ports.Event{}, fmt.Errorf("corrupted audit event %d: %w", location.sequence, err)
+	}
+
+	return event, nil
+}
+
+// Close closes the file, and events can not be appended anymore.
+func (s *fileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+func TestSinks(t *testing.T) { // nolint: funlen
+	ctx := context.Background()
+
+	// appendEvents appends an event for every port's ID, and returns sequences of the events.
+	appendEvents := func(t *testing.T, sink Sink, IDs ...string) []uint64 {
+		sequences := make([]uint64, 0, len(IDs))
+		for _, ID := range IDs {
+			event, err := sink.Append(ctx, ports.Event{
+				PortID: ID,
+				Action: ports.ActionCreate,
+				Actor:  "alice",
+				Time:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				After:  &ports.Port{Name: ID, Coordinates: []float64{1, 2}, Revision: 7},
+			})
+			require.NoError(t, err)
+			sequences = append(sequences, event.Sequence)
+		}
+
+		return sequences
+	}
+	// pages returns sequences of events on all pages.
+	pages := func(t *testing.T, sink Sink, options ports.EventListOptions) [][]uint64 {
+		var pages [][]uint64
+		for {
+			list, err := sink.Events(ctx, options)
+			require.NoError(t, err)
+
+			page := make([]uint64, 0, len(list.Events))
+			for _, event := range list.Events {
+				if len(options.PortID) > 0 {
+					require.Equal(t, options.PortID, event.PortID)
+				}
+				page = append(page, event.Sequence)
+			}
+			pages = append(pages, page)
+
+			if len(list.NextCursor) == 0 {
+				return pages
+			}
+			options.Cursor = list.NextCursor
+		}
+	}
+
+	// testSink tests a sink without any events.
+	testSink := func(t *testing.T, sink Sink) {
+		require.Equal(t, [][]uint64{{}}, pages(t, sink, ports.EventListOptions{}))
+
+		require.Equal(t, []uint64{1, 2, 3, 4, 5}, appendEvents(t, sink, "A", "B", "A", "C", "A"))
+		require.Equal(t, [][]uint64{{1, 2}, {3, 4}, {5}}, pages(t, sink, ports.EventListOptions{Limit: 2}))
+		require.Equal(t, [][]uint64{{1, 3}, {5}}, pages(t, sink, ports.EventListOptions{PortID: "A", Limit: 2}))
+		require.Equal(t, [][]uint64{{}}, pages(t, sink, ports.EventListOptions{PortID: "D"}))
+
+		_, err := sink.Events(ctx, ports.EventListOptions{Cursor: "invalid"})
+		require.ErrorIs(t, err, ports.ErrInvalidCursor)
+	}
+
+	passed := t.Run("memory", func(t *testing.T) {
+		testSink(t, NewMemorySink())
+	})
+	require.True(t, passed)
+
+	passed = t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit", "events.log")
+		sink, err := NewFileSink(path)
+		require.NoError(t, err)
+		testSink(t, sink)
+		stored, err := sink.Events(ctx, ports.EventListOptions{})
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+
+		_, err = sink.Append(ctx, ports.Event{PortID: "A"})
+		require.Error(t, err, "events can not be appended to a closed sink")
+
+		// The last event has not been fully written before a crash.
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o640)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"Sequence": 6, "PortID": "`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		sink, err = NewFileSink(path)
+		require.NoError(t, err)
+		defer sink.Close()
+
+		loaded, err := sink.Events(ctx, ports.EventListOptions{})
+		require.NoError(t, err)
+		require.Equal(t, stored, loaded)
+		require.Equal(t, []uint64{6}, appendEvents(t, sink, "B"), "sequences must continue after a restart")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("failed write is undone", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.log")
+		sink, err := NewFileSink(path)
+		require.NoError(t, err)
+		require.Equal(t, []uint64{1}, appendEvents(t, sink, "A"))
+
+		file := &faultyFile{auditFile: sink.file, failWrite: true}
+		sink.file = file
+		_, err = sink.Append(ctx, ports.Event{PortID: "torn"})
+		require.Error(t, err)
+		file.failWrite, file.failSync = false, true
+		_, err = sink.Append(ctx, ports.Event{PortID: "unsynced"})
+		require.Error(t, err)
+
+		// New events must be appended after the last acknowledged event with a next sequence.
+		require.Equal(t, []uint64{2}, appendEvents(t, sink, "B"))
+		require.NoError(t, sink.Close())
+
+		sink, err = NewFileSink(path)
+		require.NoError(t, err, "file must not be corrupted")
+		defer sink.Close()
+		require.Equal(t, [][]uint64{{1, 2}}, pages(t, sink, ports.EventListOptions{}))
+	})
+	require.True(t, passed)
+
+	passed = t.Run("failed rollback fails sink", func(t *testing.T) {
+		sink, err := NewFileSink(filepath.Join(t.TempDir(), "events.log"))
+		require.NoError(t, err)
+		defer sink.Close()
+
+		sink.file = &faultyFile{auditFile: sink.file, failWrite: true, failTruncate: true}
+		_, err = sink.Append(ctx, ports.Event{PortID: "torn"})
+		require.Error(t, err)
+		sink.file.(*faultyFile).failWrite = false
+		_, err = sink.Append(ctx, ports.Event{PortID: "next"})
+		require.Error(t, err, "failed sink must reject events")
+	})
+	require.True(t, passed)
+}
+
+// faultyFile is an audit file which fails on demand.
+type faultyFile struct {
+	auditFile
+	failWrite    bool
+	failSync     bool
+	failTruncate bool
+}
+
+// Write writes only a half of an event when it fails, like a disk which is full.
+func (f *faultyFile) Write(b []byte) (int, error) {
+	if f.failWrite {
+		n, _ := f.auditFile.Write(b[:len(b)/2])
+		return n, errors.New("disk is full")
+	}
+
+	return f.auditFile.Write(b)
+}
+
+// Sync fails once, after an event has been fully written.
+func (f *faultyFile) Sync() error {
+	if f.failSync {
+		f.failSync = false
+		return errors.New("disk is gone")
+	}
+
+	return f.auditFile.Sync()
+}
+
+func (f *faultyFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("disk is gone")
+	}
+
+	return f.auditFile.Truncate(size)
+}
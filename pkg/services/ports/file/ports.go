@@ -0,0 +1,573 @@
+// Package file provides port's storage which is persisted on a disk.
+//
+// Every change is appended to a log file and synced to a disk before it is visible for callers.
+// When the log becomes too long then all ports are written to a snapshot file and the log is truncated.
+// On start, the snapshot is loaded and the log is replayed on top of it.
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/geo"
+	"github.com/informalict/ports/pkg/services/ports/index"
+	"github.com/informalict/ports/pkg/services/ports/watch"
+)
+
+const (
+	// logFileName is a name of a file with changes which are not in a snapshot yet.
+	logFileName = "ports.log"
+	// snapshotFileName is a name of a file with all ports at the moment of the last snapshot.
+	snapshotFileName = "ports.snapshot.json"
+	// snapshotThreshold describes how many records can be in the log before a snapshot is made.
+	snapshotThreshold = 1000
+)
+
+const (
+	// opPut stores a port under an ID.
+	opPut = "put"
+	// opDelete removes a port with an ID.
+	opDelete = "delete"
+)
+
+// record describes a single change in the log.
+type record struct {
+	Op   string     `json:"op"`
+	ID   string     `json:"id"`
+	Port ports.Port `json:"port"`
+	// Revision is a revision of a change.
+	Revision uint64 `json:"revision"`
+}
+
+// logFile is the log which is opened for appending records. It is an interface, so failures of a disk can be tested.
+type logFile interface {
+	io.Writer
+	io.Seeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// snapshotContent describes all ports at the moment when the snapshot has been made.
+type snapshotContent struct {
+	// Revision is the last revision of any port.
+	Revision uint64 `json:"revision"`
+	// Ports by their IDs.
+	Ports map[string]ports.Port `json:"ports"`
+}
+
+// NewPortFile creates port's storage in a given directory.
+// Ports which have been stored in the directory before are loaded.
+func NewPortFile(dir string, logger *slog.Logger) (*portFile, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	p := &portFile{
+		dir:               dir,
+		logger:            logger,
+		ports:             make(map[string]ports.Port),
+		index:             index.NewIndex(),
+		grid:              geo.NewGrid(),
+		snapshotThreshold: snapshotThreshold,
+	}
+
+	if err := p.loadSnapshot(); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	if err := p.replayLog(); err != nil {
+		return nil, fmt.Errorf("failed to replay log: %w", err)
+	}
+	p.hub = watch.NewHub(watch.DefaultCapacity, p.revision)
+
+	return p, nil
+}
+
+type portFile struct {
+	// mutex locks this structure when CRUD actions are performed.
+	mutex sync.RWMutex
+	// ports stores ports.
+	ports map[string]ports.Port
+	// index keeps ports sorted, so they can be listed.
+	index *index.Index
+	// grid keeps ports by their locations, so they can be searched by coordinates.
+	grid *geo.Grid
+	// dir is a directory with the log and the snapshot.
+	dir string
+	// logger logs failures which are not returned to callers.
+	logger *slog.Logger
+	// log is opened for appending records.
+	log logFile
+	// failed is set when a failed write can not be undone, so the log does not match ports in memory anymore,
+	// and then all changes are rejected until the storage is opened again.
+	failed error
+	// logRecords is a number of records in the log.
+	logRecords int
+	// snapshotThreshold describes how many records can be in the log before a snapshot is made.
+	snapshotThreshold int
+	// revision is the last revision of any port.
+	revision uint64
+	// size is a number of ports, and it is read without the mutex, so counting does not block other actions.
+	size atomic.Int64
+	// hub sends changes to watchers, and it never waits for them while the mutex is held.
+	hub *watch.Hub
+}
+
+// Create creates a port with a given port ID.
+func (p *portFile) Create(ctx context.Context, ID string, port ports.Port) error {
+	_, err := p.CreateReturning(ctx, ID, port)
+
+	return err
+}
+
+// CreateReturning creates a port with a given port ID, and it returns the stored port.
+func (p *portFile) CreateReturning(_ context.Context, ID string, port ports.Port) (ports.Port, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.ports[ID]; ok {
+		return ports.Port{}, ports.ErrPortAlreadyExist
+	}
+
+	return p.put(ID, port)
+}
+
+// Get returns port for a given port's ID.
+func (p *portFile) Get(_ context.Context, ID string) (ports.Port, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if port, ok := p.ports[ID]; ok {
+		return port, nil
+	}
+
+	return ports.Port{}, ports.ErrPortNotFound
+}
+
+// Update updates an existing port.
+// When port does not exist then error is returned.
+func (p *portFile) Update(_ context.Context, ID string, port ports.Port) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.ports[ID]; !ok {
+		return ports.ErrPortNotFound
+	}
+
+	_, err := p.put(ID, port)
+
+	return err
+}
+
+// UpdateIfRevision updates an existing port only when it has a given revision.
+func (p *portFile) UpdateIfRevision(_ context.Context, ID string, revision uint64, port ports.Port) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, ok := p.ports[ID]
+	if !ok {
+		return ports.ErrPortNotFound
+	}
+
+	if previous.Revision != revision {
+		return ports.ErrRevisionMismatch
+	}
+
+	_, err := p.put(ID, port)
+
+	return err
+}
+
+// Modify reads an existing port, modifies it and stores the result atomically.
+// When port does not exist then error is returned.
+func (p *portFile) Modify(_ context.Context, ID string, modify ports.ModifyFunc) (ports.Port, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, ok := p.ports[ID]
+	if !ok {
+		return ports.Port{}, ports.ErrPortNotFound
+	}
+
+	port, err := modify(previous)
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	return p.put(ID, port)
+}
+
+// Delete deletes an existing port.
+// When port does not exist then error is returned.
+func (p *portFile) Delete(ctx context.Context, ID string) error {
+	_, err := p.DeleteReturning(ctx, ID)
+
+	return err
+}
+
+// DeleteReturning deletes an existing port, and it returns the deleted port.
+// When port does not exist then error is returned.
+func (p *portFile) DeleteReturning(_ context.Context, ID string) (ports.Port, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	port, ok := p.ports[ID]
+	if !ok {
+		return ports.Port{}, ports.ErrPortNotFound
+	}
+
+	if err := p.apply(record{Op: opDelete, ID: ID, Revision: p.revision + 1}); err != nil {
+		return ports.Port{}, err
+	}
+
+	return port, nil
+}
+
+// put stores a port with a next revision and returns it. The caller must hold the mutex.
+func (p *portFile) put(ID string, port ports.Port) (ports.Port, error) {
+	port.Revision = p.revision + 1
+	if err := p.apply(record{Op: opPut, ID: ID, Port: port, Revision: port.Revision}); err != nil {
+		return ports.Port{}, err
+	}
+
+	return port, nil
+}
+
+// Watch returns a channel with changes whose revisions are greater than fromRevision.
+// Changes are kept only in memory, so nobody can watch from revisions before the storage has been opened.
+func (p *portFile) Watch(ctx context.Context, fromRevision uint64) (<-chan ports.WatchEvent, error) {
+	return p.hub.Watch(ctx, fromRevision)
+}
+
+// Count returns a number of stored ports.
+func (p *portFile) Count(_ context.Context) (int, error) {
+	return int(p.size.Load()), nil
+}
+
+// List returns a page of ports which match given options.
+func (p *portFile) List(_ context.Context, options ports.ListOptions) (ports.PortList, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.index.List(options, p.get)
+}
+
+// Nearest returns at most k ports which are the nearest to a point.
+func (p *portFile) Nearest(_ context.Context, point ports.Point, k int) ([]ports.PortWithDistance, error) {
+	if !point.Valid() {
+		return nil, ports.ErrInvalidCoordinates
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return geo.WithPorts(p.grid.Nearest(point, k), p.get), nil
+}
+
+// WithinRadius returns ports which are not further from a point than a radius in kilometers.
+func (p *portFile) WithinRadius(_ context.Context, point ports.Point, radius float64) ([]ports.PortWithDistance, error) {
+	if !point.Valid() {
+		return nil, ports.ErrInvalidCoordinates
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return geo.WithPorts(p.grid.WithinRadius(point, radius), p.get), nil
+}
+
+// WithinBoundingBox returns ports inside a bounding box, and distance is measured from a given point.
+func (p *portFile) WithinBoundingBox(
+	_ context.Context, box ports.BoundingBox, from ports.Point,
+) ([]ports.PortWithDistance, error) {
+	if !box.Valid() || !from.Valid() {
+		return nil, ports.ErrInvalidCoordinates
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return geo.WithPorts(p.grid.WithinBoundingBox(box, from), p.get), nil
+}
+
+// get returns a port which exists. The caller must hold the mutex.
+func (p *portFile) get(ID string) ports.Port {
+	return p.ports[ID]
+}
+
+// Ping checks whether the log is open, so changes can be stored.
+func (p *portFile) Ping(_ context.Context) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.log == nil {
+		return errors.New("port's storage is closed")
+	}
+
+	return p.failed
+}
+
+// Close makes a snapshot and closes the log.
+func (p *portFile) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.log == nil {
+		return nil
+	}
+
+	if err := p.snapshot(); err != nil {
+		return err
+	}
+
+	err := p.log.Close()
+	p.log = nil
+
+	return err
+}
+
+// apply writes a record to the log and then changes ports in memory.
+// The caller must hold the mutex.
+func (p *portFile) apply(r record) error {
+	if p.log == nil {
+		return errors.New("port's storage is closed")
+	}
+	if p.failed != nil {
+		return p.failed
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	offset, err := p.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read log's offset: %w", err)
+	}
+
+	if _, err := p.log.Write(append(b, '\n')); err != nil {
+		return p.rollback(offset, fmt.Errorf("failed to write log: %w", err))
+	}
+	if err := p.log.Sync(); err != nil {
+		return p.rollback(offset, fmt.Errorf("failed to sync log: %w", err))
+	}
+	p.logRecords++
+
+	event := p.watchEvent(r)
+	p.applyInMemory(r)
+	p.hub.Publish(event)
+
+	if p.logRecords >= p.snapshotThreshold {
+		if err := p.snapshot(); err != nil {
+			// The change is already durable in the log, so the snapshot can be made next time.
+			p.logger.Warn("failed to make a snapshot", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// rollback removes a record which has not been acknowledged from the log, so a next record is not appended after
+// a torn line. When the log can not be truncated, then the storage is failed, because it does not match ports
+// in memory. The caller must hold the mutex.
+func (p *portFile) rollback(offset int64, err error) error {
+	if truncateErr := p.log.Truncate(offset); truncateErr != nil {
+		p.failed = fmt.Errorf("port's storage is failed: %w", errors.Join(err, truncateErr))
+		return p.failed
+	}
+	if _, seekErr := p.log.Seek(offset, io.SeekStart); seekErr != nil {
+		p.failed = fmt.Errorf("port's storage is failed: %w", errors.Join(err, seekErr))
+		return p.failed
+	}
+	if syncErr := p.log.Sync(); syncErr != nil {
+		p.failed = fmt.Errorf("port's storage is failed: %w", errors.Join(err, syncErr))
+		return p.failed
+	}
+
+	return err
+}
+
+// watchEvent returns a change which is described by a record. It must be called before the record is applied.
+// The caller must hold the mutex.
+func (p *portFile) watchEvent(r record) ports.WatchEvent {
+	event := ports.WatchEvent{Revision: r.Revision, Action: ports.ActionDelete, PortID: r.ID, Port: p.ports[r.ID]}
+	if r.Op == opPut {
+		event.Action = ports.ActionUpdate
+		if _, ok := p.ports[r.ID]; !ok {
+			event.Action = ports.ActionCreate
+		}
+		event.Port = r.Port
+	}
+
+	return event
+}
+
+// applyInMemory changes ports in memory.
+func (p *portFile) applyInMemory(r record) {
+	if r.Revision > p.revision {
+		p.revision = r.Revision
+	}
+
+	switch r.Op {
+	case opPut:
+		var previous *ports.Port
+		if port, ok := p.ports[r.ID]; ok {
+			previous = &port
+		} else {
+			p.size.Add(1)
+		}
+		p.index.Put(r.ID, previous, r.Port)
+		p.grid.Put(r.ID, previous, r.Port)
+		p.ports[r.ID] = r.Port
+	case opDelete:
+		if previous, ok := p.ports[r.ID]; ok {
+			p.index.Remove(r.ID, previous)
+			p.grid.Remove(r.ID, previous)
+			delete(p.ports, r.ID)
+			p.size.Add(-1)
+		}
+	}
+}
+
+// loadSnapshot loads ports from the snapshot file if it exists.
+func (p *portFile) loadSnapshot() error {
+	file, err := os.Open(filepath.Join(p.dir, snapshotFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+	defer file.Close()
+
+	content := snapshotContent{Ports: p.ports}
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&content); err != nil {
+		return err
+	}
+	p.revision = content.Revision
+	p.size.Store(int64(len(p.ports)))
+
+	for ID, port := range p.ports {
+		p.index.Put(ID, nil, port)
+		p.grid.Put(ID, nil, port)
+	}
+
+	return nil
+}
+
+// replayLog applies all records from the log file and opens it for appending.
+// The last record is removed when it is not complete, because process could have crashed during writing it.
+func (p *portFile) replayLog() error {
+	file, err := os.OpenFile(filepath.Join(p.dir, logFileName), os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// The last record has not been fully written, so it has never been acknowledged.
+				if err := file.Truncate(offset); err != nil {
+					file.Close()
+					return err
+				}
+			}
+			break
+		} else if err != nil {
+			file.Close()
+			return err
+		}
+
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			file.Close()
+			return fmt.Errorf("corrupted record at offset %d: %w", offset, err)
+		}
+		p.applyInMemory(r)
+		p.logRecords++
+		offset += int64(len(line))
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	p.log = file
+
+	return nil
+}
+
+// snapshot writes all ports to the snapshot file and truncates the log.
+// The snapshot is written to a temporary file first, so the previous snapshot is valid until the new one is complete.
+// The caller must hold the mutex.
+func (p *portFile) snapshot() error {
+	tmp, err := os.CreateTemp(p.dir, snapshotFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	if err := json.NewEncoder(writer).Encode(snapshotContent{Revision: p.revision, Ports: p.ports}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(p.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	if err := syncDir(p.dir); err != nil {
+		return err
+	}
+
+	// Records are idempotent, so when process crashes before the log is truncated,
+	// then they are replayed on top of the new snapshot with the same result.
+	if err := p.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := p.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	p.logRecords = 0
+
+	return p.log.Sync()
+}
+
+// syncDir makes sure that changes in a directory's entries are on a disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
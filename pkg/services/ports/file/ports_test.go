@@ -0,0 +1,211 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/portstest"
+)
+
+func TestPortFile(t *testing.T) {
+	portstest.TestPortService(t, func(t *testing.T) ports.PortService {
+		svc, err := NewPortFile(t.TempDir(), logging.Discard())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, svc.Close())
+		})
+
+		return svc
+	})
+}
+
+// TestPortFile_Recovery tests whether ports are loaded again from a directory.
+func TestPortFile_Recovery(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reopen after close", func(t *testing.T) {
+		dir := t.TempDir()
+		svc, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		require.NoError(t, svc.Create(ctx, "test", portstest.ValidPort("test")))
+		require.NoError(t, svc.Update(ctx, "test", portstest.ValidPort("new_test")))
+		require.NoError(t, svc.Create(ctx, "deleted", portstest.ValidPort("deleted")))
+		require.NoError(t, svc.Delete(ctx, "deleted"))
+		require.NoError(t, svc.Ping(ctx))
+		require.NoError(t, svc.Close())
+		require.Error(t, svc.Ping(ctx), "closed storage must not be healthy")
+
+		svc, err = NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		defer svc.Close()
+		count, err := svc.Count(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+		port, err := svc.Get(ctx, "test")
+		require.NoError(t, err)
+		portstest.RequireEqualPort(t, portstest.ValidPort("new_test"), port)
+		_, err = svc.Get(ctx, "deleted")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+		// Revisions are not reused, and the last one is consumed by deleted port.
+		require.NoError(t, svc.Create(ctx, "new", portstest.ValidPort("new")))
+		port, err = svc.Get(ctx, "new")
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), port.Revision)
+	})
+
+	t.Run("reopen after crash", func(t *testing.T) {
+		dir := t.TempDir()
+		svc, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		svc.snapshotThreshold = 4
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			require.NoError(t, svc.Create(ctx, id, portstest.ValidPort(id)))
+		}
+		require.NoError(t, svc.Delete(ctx, "e"))
+		// A port's storage is not closed, so it simulates a crash.
+
+		recovered, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		defer recovered.Close()
+		require.Equal(t, 2, recovered.logRecords, "snapshot should contain first four ports")
+		for _, id := range []string{"a", "b", "c", "d"} {
+			port, err := recovered.Get(ctx, id)
+			require.NoError(t, err)
+			portstest.RequireEqualPort(t, portstest.ValidPort(id), port)
+		}
+		_, err = recovered.Get(ctx, "e")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+	})
+
+	t.Run("incomplete record is dropped", func(t *testing.T) {
+		dir := t.TempDir()
+		svc, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		require.NoError(t, svc.Create(ctx, "test", portstest.ValidPort("test")))
+
+		logFile, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = logFile.WriteString(`{"op":"put","id":"torn","po`)
+		require.NoError(t, err)
+		require.NoError(t, logFile.Close())
+
+		recovered, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		_, err = recovered.Get(ctx, "torn")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+		// New records must be appended after the last complete record.
+		require.NoError(t, recovered.Create(ctx, "next", portstest.ValidPort("next")))
+		require.NoError(t, recovered.log.Close())
+		recovered.log = nil
+
+		recovered, err = NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		defer recovered.Close()
+		for _, id := range []string{"test", "next"} {
+			_, err := recovered.Get(ctx, id)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("failed write is undone", func(t *testing.T) {
+		dir := t.TempDir()
+		svc, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		require.NoError(t, svc.Create(ctx, "test", portstest.ValidPort("test")))
+
+		log := &faultyLog{logFile: svc.log, failWrite: true}
+		svc.log = log
+		require.Error(t, svc.Create(ctx, "torn", portstest.ValidPort("torn")))
+		log.failWrite, log.failSync = false, true
+		require.Error(t, svc.Create(ctx, "unsynced", portstest.ValidPort("unsynced")))
+		require.NoError(t, svc.Ping(ctx))
+
+		// New records must be appended after the last acknowledged record.
+		require.NoError(t, svc.Create(ctx, "next", portstest.ValidPort("next")))
+		require.NoError(t, svc.log.Close())
+		svc.log = nil
+
+		recovered, err := NewPortFile(dir, logging.Discard())
+		require.NoError(t, err)
+		defer recovered.Close()
+		for _, id := range []string{"test", "next"} {
+			_, err := recovered.Get(ctx, id)
+			require.NoError(t, err)
+		}
+		for _, id := range []string{"torn", "unsynced"} {
+			_, err := recovered.Get(ctx, id)
+			require.ErrorIs(t, err, ports.ErrPortNotFound)
+		}
+	})
+
+	t.Run("failed rollback fails storage", func(t *testing.T) {
+		svc, err := NewPortFile(t.TempDir(), logging.Discard())
+		require.NoError(t, err)
+		log := &faultyLog{logFile: svc.log, failWrite: true, failTruncate: true}
+		svc.log = log
+		defer func() {
+			require.NoError(t, log.logFile.Close())
+		}()
+
+		require.Error(t, svc.Create(ctx, "torn", portstest.ValidPort("torn")))
+		log.failWrite, log.failTruncate = false, false
+		require.Error(t, svc.Ping(ctx), "failed storage must not be healthy")
+		require.Error(t, svc.Create(ctx, "next", portstest.ValidPort("next")), "failed storage must reject changes")
+		_, err = svc.Get(ctx, "torn")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+	})
+
+	t.Run("corrupted record", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, logFileName), []byte("invalid\n"), 0o600)
+		require.NoError(t, err)
+
+		_, err = NewPortFile(dir, logging.Discard())
+		require.Error(t, err)
+	})
+}
+
+// faultyLog is a log which fails on demand.
+type faultyLog struct {
+	logFile
+	failWrite    bool
+	failSync     bool
+	failTruncate bool
+}
+
+// Write writes only a half of a record when it fails, like a disk which is full.
+func (f *faultyLog) Write(b []byte) (int, error) {
+	if f.failWrite {
+		n, _ := f.logFile.Write(b[:len(b)/2])
+		return n, errors.New("disk is full")
+	}
+
+	return f.logFile.Write(b)
+}
+
+// Sync fails only once, so a record which has not been synced can be removed.
+func (f *faultyLog) Sync() error {
+	if f.failSync {
+		f.failSync = false
+		return errors.New("disk is not available")
+	}
+
+	return f.logFile.Sync()
+}
+
+func (f *faultyLog) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("disk is not available")
+	}
+
+	return f.logFile.Truncate(size)
+}
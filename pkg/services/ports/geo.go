@@ -0,0 +1,98 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// EarthRadius is a mean radius of the Earth in kilometers.
+const EarthRadius = 6371.0088
+
+// ErrInvalidCoordinates is returned by GeoService methods when coordinates are out of range.
+var ErrInvalidCoordinates = errors.New("invalid coordinates")
+
+// Point is a location on the Earth in degrees.
+type Point struct {
+	// Lat is a latitude between -90 and 90.
+	Lat float64
+	// Lon is a longitude between -180 and 180.
+	Lon float64
+}
+
+// Valid checks whether a point's latitude and longitude are in range.
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// PortLocation returns a location of a port.
+// Port's coordinates are in `[longitude, latitude]` order, the same as in GeoJSON.
+// False is returned when a port does not have valid coordinates.
+func PortLocation(port Port) (Point, bool) {
+	if len(port.Coordinates) != 2 {
+		return Point{}, false
+	}
+
+	point := Point{Lat: port.Coordinates[1], Lon: port.Coordinates[0]}
+
+	return point, point.Valid()
+}
+
+// Distance returns great-circle distance between two points in kilometers.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon - a.Lon)
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// radians converts degrees to radians.
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// BoundingBox is an area between two latitudes and two longitudes.
+// When MinLon is greater than MaxLon, then a box crosses the antimeridian.
+type BoundingBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// Valid checks whether a bounding box's corners are in range.
+func (b BoundingBox) Valid() bool {
+	return Point{Lat: b.MinLat, Lon: b.MinLon}.Valid() && Point{Lat: b.MaxLat, Lon: b.MaxLon}.Valid() &&
+		b.MinLat <= b.MaxLat
+}
+
+// Contains checks whether a point is inside a bounding box.
+func (b BoundingBox) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+
+	if b.MinLon <= b.MaxLon {
+		return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+	}
+
+	return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+}
+
+// PortWithDistance extends PortWithID with a distance from a searched point.
+type PortWithDistance struct {
+	PortWithID
+	// Distance is a great-circle distance in kilometers.
+	Distance float64
+}
+
+// GeoService searches ports by their coordinates.
+// It is implemented by port's services which keep a spatial index, and results are sorted by distance.
+type GeoService interface {
+	// Nearest returns at most k ports which are the nearest to a point.
+	Nearest(ctx context.Context, point Point, k int) ([]PortWithDistance, error)
+	// WithinRadius returns ports which are not further from a point than a radius in kilometers.
+	WithinRadius(ctx context.Context, point Point, radius float64) ([]PortWithDistance, error)
+	// WithinBoundingBox returns ports inside a bounding box, and distance is measured from a given point.
+	WithinBoundingBox(ctx context.Context, box BoundingBox, from Point) ([]PortWithDistance, error)
+}
@@ -0,0 +1,297 @@
+// Package geo provides a spatial index of ports for storages which keep ports in memory.
+package geo
+
+import (
+	"math"
+	"sort"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+const (
+	// latCells is a number of rows in a grid, every row is one degree of latitude.
+	latCells = 180
+	// lonCells is a number of columns in a grid, every column is one degree of longitude.
+	lonCells = 360
+	// maxRing is the furthest ring of cells around a cell, and it covers the whole grid.
+	maxRing = lonCells / 2
+)
+
+// cell is a position of a cell in a grid.
+type cell struct {
+	lat, lon int
+}
+
+// cellOf returns a cell which contains a point.
+func cellOf(p ports.Point) cell {
+	lat := int(math.Floor(p.Lat + 90))
+	if lat >= latCells {
+		lat = latCells - 1
+	}
+
+	lon := int(math.Floor(p.Lon + 180))
+	if lon >= lonCells {
+		lon = 0
+	}
+
+	return cell{lat: lat, lon: lon}
+}
+
+// Result is a port's ID with a distance from a searched point.
+type Result struct {
+	// ID is port's ID.
+	ID string
+	// Distance is great-circle distance in kilometers.
+	Distance float64
+}
+
+// WithPorts converts results into ports which are fetched by get function.
+func WithPorts(results []Result, get func(ID string) ports.Port) []ports.PortWithDistance {
+	found := make([]ports.PortWithDistance, 0, len(results))
+	for _, r := range results {
+		found = append(found, ports.PortWithDistance{
+			PortWithID: ports.PortWithID{Port: get(r.ID), ID: r.ID},
+			Distance:   r.Distance,
+		})
+	}
+
+	return found
+}
+
+// NewGrid creates an empty grid.
+func NewGrid() *Grid {
+	return &Grid{
+		cells: make(map[cell]map[string]ports.Point),
+	}
+}
+
+// Grid is a spatial index which splits the Earth into cells of one degree.
+// A search visits rings of cells around a searched point, and it stops when no further cell can contain a better result.
+// It is not safe for concurrent use, so a caller must synchronize access to it together with ports.
+type Grid struct {
+	// cells contains locations of ports in a cell by their IDs.
+	cells map[cell]map[string]ports.Point
+}
+
+// Put adds a port to a grid.
+// When a port already exists, then its previous version must be provided, so it can be replaced.
+// Ports without valid coordinates are not added.
+func (g *Grid) Put(ID string, previous *ports.Port, port ports.Port) {
+	if previous != nil {
+		g.Remove(ID, *previous)
+	}
+
+	point, ok := ports.PortLocation(port)
+	if !ok {
+		return
+	}
+
+	c := cellOf(point)
+	if g.cells[c] == nil {
+		g.cells[c] = make(map[string]ports.Point)
+	}
+	g.cells[c][ID] = point
+}
+
+// Remove removes a port from a grid.
+func (g *Grid) Remove(ID string, port ports.Port) {
+	point, ok := ports.PortLocation(port)
+	if !ok {
+		return
+	}
+
+	c := cellOf(point)
+	delete(g.cells[c], ID)
+	if len(g.cells[c]) == 0 {
+		delete(g.cells, c)
+	}
+}
+
+// Nearest returns at most k ports which are the nearest to a point.
+func (g *Grid) Nearest(point ports.Point, k int) []Result {
+	var results []Result
+	if k <= 0 {
+		return results
+	}
+
+	g.visitRings(point, func(ring int, visit func(func(Result))) bool {
+		visit(func(r Result) {
+			results = append(results, r)
+		})
+		sortResults(results)
+		if len(results) > k {
+			results = results[:k]
+		}
+
+		// Unvisited cells can not have closer ports than the k-th port.
+		return len(results) < k || results[k-1].Distance > minDistanceOutside(point, ring)
+	})
+
+	return results
+}
+
+// WithinRadius returns ports which are not further from a point than a radius in kilometers.
+func (g *Grid) WithinRadius(point ports.Point, radius float64) []Result {
+	var results []Result
+
+	g.visitRings(point, func(ring int, visit func(func(Result))) bool {
+		visit(func(r Result) {
+			if r.Distance <= radius {
+				results = append(results, r)
+			}
+		})
+
+		return radius >= minDistanceOutside(point, ring)
+	})
+	sortResults(results)
+
+	return results
+}
+
+// WithinBoundingBox returns ports inside a bounding box, and distance is measured from a given point.
+func (g *Grid) WithinBoundingBox(box ports.BoundingBox, from ports.Point) []Result {
+	var results []Result
+
+	minCell := cellOf(ports.Point{Lat: box.MinLat, Lon: box.MinLon})
+	maxCell := cellOf(ports.Point{Lat: box.MaxLat, Lon: box.MaxLon})
+
+	for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+		for _, lon := range boxColumns(box) {
+			for ID, point := range g.cells[cell{lat: lat, lon: lon}] {
+				if box.Contains(point) {
+					results = append(results, Result{ID: ID, Distance: ports.Distance(from, point)})
+				}
+			}
+		}
+	}
+	sortResults(results)
+
+	return results
+}
+
+// boxColumns returns columns of a grid which overlap a bounding box.
+func boxColumns(box ports.BoundingBox) []int {
+	first := int(math.Floor(box.MinLon + 180))
+	last := int(math.Floor(box.MaxLon + 180))
+
+	var columns []int
+	if box.MinLon > box.MaxLon {
+		// A box crosses the antimeridian.
+		last += lonCells
+	}
+	for lon := first; lon <= last; lon++ {
+		columns = append(columns, wrapLon(lon))
+		if len(columns) == lonCells {
+			break
+		}
+	}
+
+	return columns
+}
+
+// visitRings calls next function for consecutive rings of cells around a point's cell, until it returns false.
+// A ring contains cells which are exactly `ring` cells away from a point's cell in any direction,
+// and next function gets visit function which iterates over ports in a ring.
+func (g *Grid) visitRings(point ports.Point, next func(ring int, visit func(func(Result))) bool) {
+	center := cellOf(point)
+
+	for ring := 0; ring <= maxRing; ring++ {
+		visit := func(found func(Result)) {
+			for _, c := range ringCells(center, ring) {
+				for ID, p := range g.cells[c] {
+					found(Result{ID: ID, Distance: ports.Distance(point, p)})
+				}
+			}
+		}
+
+		if !next(ring, visit) {
+			return
+		}
+	}
+}
+
+// ringCells returns cells which are exactly `ring` cells away from a center.
+// Longitude wraps around the antimeridian, so every cell is returned for only one ring.
+func ringCells(center cell, ring int) []cell {
+	var cells []cell
+
+	// Offsets of columns in the first and the last row of a ring. The last ring covers all columns.
+	minLonOffset, maxLonOffset := -ring, ring
+	if ring >= maxRing {
+		minLonOffset, maxLonOffset = -maxRing+1, maxRing
+	}
+
+	for latOffset := -ring; latOffset <= ring; latOffset++ {
+		lat := center.lat + latOffset
+		if lat < 0 || lat >= latCells {
+			continue
+		}
+
+		if latOffset == -ring || latOffset == ring {
+			for lonOffset := minLonOffset; lonOffset <= maxLonOffset; lonOffset++ {
+				cells = append(cells, cell{lat: lat, lon: wrapLon(center.lon + lonOffset)})
+			}
+			continue
+		}
+
+		// Both sides of the last ring are the same column.
+		if ring < maxRing {
+			cells = append(cells, cell{lat: lat, lon: wrapLon(center.lon - ring)})
+		}
+		cells = append(cells, cell{lat: lat, lon: wrapLon(center.lon + ring)})
+	}
+
+	return cells
+}
+
+// wrapLon wraps a column of a grid around the antimeridian.
+func wrapLon(lon int) int {
+	return ((lon % lonCells) + lonCells) % lonCells
+}
+
+// minDistanceOutside returns the lower bound of distance from a point to any cell outside a given ring.
+// Such cell lies behind a parallel or a meridian which bounds the ring, so the distance is the shortest one
+// to any of these lines.
+func minDistanceOutside(point ports.Point, ring int) float64 {
+	if ring >= maxRing {
+		return math.Inf(1)
+	}
+
+	center := cellOf(point)
+	distance := math.Inf(1)
+
+	// Parallels which bound a ring from south and north.
+	if south := float64(center.lat-ring) - 90; south > -90 {
+		distance = math.Min(distance, ports.EarthRadius*radians(point.Lat-south))
+	}
+	if north := float64(center.lat+ring+1) - 90; north < 90 {
+		distance = math.Min(distance, ports.EarthRadius*radians(north-point.Lat))
+	}
+
+	// Meridians which bound a ring from west and east. The shortest distance to a meridian is the cross-track
+	// distance to its great circle.
+	west := float64(center.lon-ring) - 180
+	east := float64(center.lon+ring+1) - 180
+	for _, meridian := range []float64{west, east} {
+		crossTrack := math.Asin(math.Min(1, math.Abs(math.Cos(radians(point.Lat))*math.Sin(radians(meridian-point.Lon)))))
+		distance = math.Min(distance, ports.EarthRadius*crossTrack)
+	}
+
+	return distance
+}
+
+// radians converts degrees to radians.
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// sortResults sorts results by distance, and then by ID.
+func sortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+
+		return results[i].ID < results[j].ID
+	})
+}
@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// TestRingCells tests whether rings cover every cell exactly once.
+func TestRingCells(t *testing.T) {
+	for _, center := range []cell{{lat: 0, lon: 0}, {lat: 90, lon: 180}, {lat: 179, lon: 359}, {lat: 45, lon: 3}} {
+		visited := make(map[cell]int)
+		for ring := 0; ring <= maxRing; ring++ {
+			for _, c := range ringCells(center, ring) {
+				visited[c]++
+			}
+		}
+
+		require.Len(t, visited, latCells*lonCells)
+		for c, count := range visited {
+			require.Equal(t, 1, count, "cell %v is visited more than once", c)
+		}
+	}
+}
+
+// TestGrid compares results of a grid with results of a full scan for random ports.
+func TestGrid(t *testing.T) {
+	random := rand.New(rand.NewSource(1)) // nolint: gosec
+	grid := NewGrid()
+	locations := make(map[string]ports.Point)
+	randomPoint := func() ports.Point {
+		return ports.Point{Lat: random.Float64()*180 - 90, Lon: random.Float64()*360 - 180}
+	}
+
+	for i := 0; i < 2000; i++ {
+		ID := string(rune('A'+i%26)) + string(rune('A'+i/26%26)) + string(rune('A'+i/676))
+		point := randomPoint()
+		locations[ID] = point
+		grid.Put(ID, nil, ports.Port{Coordinates: []float64{point.Lon, point.Lat}})
+	}
+
+	// Moves some ports, so the grid must remove their previous locations.
+	for ID, point := range locations {
+		if random.Intn(4) != 0 {
+			continue
+		}
+
+		moved := randomPoint()
+		grid.Put(ID, &ports.Port{Coordinates: []float64{point.Lon, point.Lat}},
+			ports.Port{Coordinates: []float64{moved.Lon, moved.Lat}})
+		locations[ID] = moved
+	}
+
+	fullScan := func(from ports.Point, match func(ports.Point) bool) []Result {
+		var results []Result
+		for ID, point := range locations {
+			if match(point) {
+				results = append(results, Result{ID: ID, Distance: ports.Distance(from, point)})
+			}
+		}
+		sortResults(results)
+
+		return results
+	}
+
+	points := []ports.Point{{Lat: 89.9, Lon: 179.9}, {Lat: -89.5, Lon: 0}, {Lat: 0, Lon: -180}, {Lat: 54.35, Lon: 18.65}}
+	for i := 0; i < 50; i++ {
+		points = append(points, randomPoint())
+	}
+
+	for _, point := range points {
+		expected := fullScan(point, func(ports.Point) bool { return true })
+		require.Equal(t, expected[:7], grid.Nearest(point, 7), "nearest to %v", point)
+
+		expected = fullScan(point, func(p ports.Point) bool { return ports.Distance(point, p) <= 1500 })
+		require.Equal(t, expected, grid.WithinRadius(point, 1500), "within radius from %v", point)
+	}
+
+	boxes := []ports.BoundingBox{
+		{MinLat: -10, MinLon: -20, MaxLat: 30, MaxLon: 40},
+		{MinLat: 50, MinLon: 170, MaxLat: 80, MaxLon: -170},
+		{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180},
+		{MinLat: 0, MinLon: 10.5, MaxLat: 20, MaxLon: 10.2},
+	}
+	for _, box := range boxes {
+		from := ports.Point{Lat: box.MinLat, Lon: box.MinLon}
+		expected := fullScan(from, box.Contains)
+		require.Equal(t, expected, grid.WithinBoundingBox(box, from), "within box %v", box)
+	}
+
+	t.Run("remove all ports", func(t *testing.T) {
+		IDs := make([]string, 0, len(locations))
+		for ID := range locations {
+			IDs = append(IDs, ID)
+		}
+		sort.Strings(IDs)
+
+		for _, ID := range IDs {
+			point := locations[ID]
+			grid.Remove(ID, ports.Port{Coordinates: []float64{point.Lon, point.Lat}})
+		}
+		require.Empty(t, grid.cells)
+		require.Empty(t, grid.Nearest(ports.Point{}, 1))
+	})
+}
@@ -0,0 +1,232 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+var (
+	// ErrRevisionNotFound is returned when a history of a port does not contain a given revision.
+	ErrRevisionNotFound = errors.New("port revision not found")
+	// ErrHistoryIncomplete is returned when changes of a port are missing in its history, so a previous port
+	// can not be found. Changes are missing when they have not been recorded, or when they have been made before
+	// a history has been kept, e.g. by a persistent storage backend before a restart.
+	ErrHistoryIncomplete = errors.New("port history is incomplete")
+)
+
+// Action describes how a port has been changed.
+type Action string
+
+const (
+	// ActionCreate means that a port has been created.
+	ActionCreate Action = "create"
+	// ActionUpdate means that a port has been updated or modified.
+	ActionUpdate Action = "update"
+	// ActionDelete means that a port has been deleted.
+	ActionDelete Action = "delete"
+)
+
+// Event describes a single change of a port.
+type Event struct {
+	// Sequence is a number of an event. Sequences grow across all ports, so events are listed by them.
+	Sequence uint64
+	// PortID is an ID of a changed port.
+	PortID string
+	// Action describes how a port has been changed.
+	Action Action
+	// Actor is who has changed a port.
+	Actor string
+	// Time is when a port has been changed.
+	Time time.Time
+	// Before is a port before a change. It is nil for ActionCreate.
+	Before *Port
+	// After is a port after a change. It is nil for ActionDelete.
+	After *Port
+}
+
+// Change describes a single changed property of a port.
+type Change struct {
+	// Field is a name of a property, the same as in API.
+	Field string
+	// Before is a value before a change, or nil when a port has not existed.
+	Before interface{}
+	// After is a value after a change, or nil when a port has been deleted.
+	After interface{}
+}
+
+// portFields are properties of a port which are compared by Event.Changes, in order of the changes.
+var portFields = []struct {
+	name  string
+	value func(port Port) interface{}
+}{
+	{"name", func(port Port) interface{} { return port.Name }},
+	{"city", func(port Port) interface{} { return port.City }},
+	{"country", func(port Port) interface{} { return port.Country }},
+	{"province", func(port Port) interface{} { return port.Province }},
+	{"timezone", func(port Port) interface{} { return port.Timezone }},
+	{"code", func(port Port) interface{} { return port.Code }},
+	{"coordinates", func(port Port) interface{} { return port.Coordinates }},
+	{"alias", func(port Port) interface{} { return port.Alias }},
+	{"regions", func(port Port) interface{} { return port.Regions }},
+	{"unlocs", func(port Port) interface{} { return port.Unlocs }},
+}
+
+// Changes returns properties which differ before and after an event.
+// Empty and missing values are the same, so a created port has only its non-empty properties changed.
+func (e Event) Changes() []Change {
+	var changes []Change
+	for _, field := range portFields {
+		var before, after interface{}
+		if e.Before != nil {
+			before = emptyToNil(field.value(*e.Before))
+		}
+		if e.After != nil {
+			after = emptyToNil(field.value(*e.After))
+		}
+
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, Change{Field: field.name, Before: before, After: after})
+		}
+	}
+
+	return changes
+}
+
+// emptyToNil returns nil for an empty string or an empty list.
+func emptyToNil(value interface{}) interface{} {
+	if v := reflect.ValueOf(value); v.Len() == 0 {
+		return nil
+	}
+
+	return value
+}
+
+// EventListOptions describes which events are returned by HistoryService.Events.
+type EventListOptions struct {
+	// PortID limits events to a single port. Events of all ports are returned when it is empty.
+	PortID string
+	// Limit is a maximum number of events on a page. DefaultListLimit is used when it is zero.
+	Limit int
+	// Cursor is taken from a previous page to get a next one. The first page is returned when it is empty.
+	Cursor string
+}
+
+// EventList is a single page of events in order of their sequences.
+type EventList struct {
+	// Events on a page.
+	Events []Event
+	// NextCursor is used to get a next page. It is empty for the last page.
+	NextCursor string
+}
+
+// HistoryService is implemented by port's services which record changes of ports.
+type HistoryService interface {
+	// Events returns a page of recorded events which match given options.
+	// ErrInvalidCursor is returned when a cursor is malformed.
+	Events(ctx context.Context, options EventListOptions) (EventList, error)
+}
+
+// PortAtRevision returns a port with a given revision from its history, even when the port has been deleted since.
+// ErrRevisionNotFound is returned when the port has never had the revision, and ErrHistoryIncomplete when
+// the revision may be missing in the history. The history is read page by page only until the revision.
+func PortAtRevision(ctx context.Context, history HistoryService, ID string, revision uint64) (Port, error) {
+	var (
+		found    *Port
+		previous *Event
+		complete = true
+	)
+	err := walkEvents(ctx, history, ID, func(event Event) bool {
+		complete = complete && follows(previous, event)
+		previous = &event
+		if event.After != nil && event.After.Revision == revision {
+			found = event.After
+			return false
+		}
+
+		// Revisions only grow, so later events can not have the revision.
+		return event.After == nil || event.After.Revision < revision
+	})
+	if err != nil {
+		return Port{}, err
+	}
+
+	switch {
+	case found != nil:
+		return *found, nil
+	case !complete:
+		return Port{}, ErrHistoryIncomplete
+	default:
+		return Port{}, ErrRevisionNotFound
+	}
+}
+
+// PortAsOf returns a port as it has been at a given time according to its history.
+// ErrPortNotFound is returned when the port has not existed at that time, and ErrHistoryIncomplete when
+// a change of the port at that time may be missing in the history.
+func PortAsOf(ctx context.Context, history HistoryService, ID string, at time.Time) (Port, error) {
+	var (
+		previous *Event
+		complete = true
+	)
+	err := walkEvents(ctx, history, ID, func(event Event) bool {
+		if event.Time.After(at) {
+			// Only changes between the last one before the time and the next one matter.
+			complete = follows(previous, event)
+			return false
+		}
+		previous = &event
+
+		return true
+	})
+	if err != nil {
+		return Port{}, err
+	}
+
+	switch {
+	case !complete:
+		return Port{}, ErrHistoryIncomplete
+	case previous == nil || previous.After == nil:
+		return Port{}, ErrPortNotFound
+	default:
+		return *previous.After, nil
+	}
+}
+
+// follows checks whether an event continues a previous event of the same port, or starts a history of a port
+// when the previous event is nil. Otherwise, some changes of the port are missing between the events.
+func follows(previous *Event, event Event) bool {
+	var last *Port
+	if previous != nil {
+		last = previous.After
+	}
+
+	if last == nil || event.Before == nil {
+		return last == nil && event.Before == nil
+	}
+
+	return last.Revision == event.Before.Revision
+}
+
+// walkEvents calls a function for events of a port from the oldest one, until the function returns false.
+func walkEvents(ctx context.Context, history HistoryService, ID string, f func(event Event) bool) error {
+	options := EventListOptions{PortID: ID, Limit: MaxListLimit}
+	for {
+		list, err := history.Events(ctx, options)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range list.Events {
+			if !f(event) {
+				return nil
+			}
+		}
+
+		if len(list.NextCursor) == 0 {
+			return nil
+		}
+		options.Cursor = list.NextCursor
+	}
+}
@@ -0,0 +1,76 @@
+package ports_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// pagedHistory returns a single event on every page, and it counts read pages.
+type pagedHistory struct {
+	events []ports.Event
+	pages  int
+}
+
+func (h *pagedHistory) Events(_ context.Context, options ports.EventListOptions) (ports.EventList, error) {
+	h.pages++
+
+	index := 0
+	if len(options.Cursor) > 0 {
+		var err error
+		if index, err = strconv.Atoi(options.Cursor); err != nil {
+			return ports.EventList{}, ports.ErrInvalidCursor
+		}
+	}
+
+	list := ports.EventList{Events: h.events[index : index+1]}
+	if index+1 < len(h.events) {
+		list.NextCursor = strconv.Itoa(index + 1)
+	}
+
+	return list, nil
+}
+
+func TestPortAtRevision(t *testing.T) {
+	ctx := context.Background()
+	revisions := []uint64{1, 2, 3, 5, 6}
+	newHistory := func() *pagedHistory {
+		history := &pagedHistory{}
+		var before *ports.Port
+		for i, revision := range revisions {
+			after := &ports.Port{Name: "name", Revision: revision}
+			history.events = append(history.events, ports.Event{
+				Sequence: uint64(i + 1), PortID: "test", Action: ports.ActionUpdate, Before: before, After: after,
+			})
+			before = after
+		}
+
+		return history
+	}
+
+	passed := t.Run("revision is found", func(t *testing.T) {
+		history := newHistory()
+		port, err := ports.PortAtRevision(ctx, history, "test", 2)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), port.Revision)
+		require.Equal(t, 2, history.pages, "later pages must not be read")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("history is read until the revision", func(t *testing.T) {
+		history := newHistory()
+		_, err := ports.PortAtRevision(ctx, history, "test", 4)
+		require.ErrorIs(t, err, ports.ErrRevisionNotFound)
+		require.Equal(t, 4, history.pages, "events after a larger revision must not be read")
+
+		history = newHistory()
+		_, err = ports.PortAtRevision(ctx, history, "test", 1000)
+		require.ErrorIs(t, err, ports.ErrRevisionNotFound)
+		require.Equal(t, len(revisions), history.pages)
+	})
+	require.True(t, passed)
+}
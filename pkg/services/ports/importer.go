@@ -0,0 +1,265 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// importBuffer describes how many ports are read ahead of a port's service during an import.
+const importBuffer = 10
+
+// ErrInvalidImportMode is returned by Import when an import mode is not supported.
+var ErrInvalidImportMode = errors.New("invalid import mode")
+
+// errUnchanged is returned by a modify function when an imported port is the same as a stored one.
+var errUnchanged = errors.New("port is unchanged")
+
+// ImportMode describes how imported ports are stored.
+type ImportMode string
+
+const (
+	// ImportCreate creates new ports only, and existing ports are skipped.
+	ImportCreate ImportMode = "create"
+	// ImportUpsert creates new ports and updates existing ones. Existing ports which are not changed are skipped.
+	ImportUpsert ImportMode = "upsert"
+	// ImportReplace works the same as ImportUpsert, and then it deletes all ports which are not imported.
+	// Ports which are in imported data, but they have failed, are not deleted.
+	ImportReplace ImportMode = "replace"
+)
+
+// Valid checks whether an import mode is supported.
+func (m ImportMode) Valid() bool {
+	return m == ImportCreate || m == ImportUpsert || m == ImportReplace
+}
+
+// ImportOptions describes how ports are imported.
+type ImportOptions struct {
+	// Mode describes how imported ports are stored. ImportCreate is used when it is empty.
+	Mode ImportMode
+	// Normalize is applied to an imported port before it is validated. Ports are not changed when it is nil.
+	Normalize func(port Port) Port
+	// Validate checks an imported port before it is stored. A port is reported as failed when it returns an error.
+	Validate func(port PortWithID) error
+	// ReadMode describes whether an import stops at the first failed port. ReadLenient is used when it is empty.
+	ReadMode ReadMode
+}
+
+// ImportFailure describes why a port has not been imported.
+type ImportFailure struct {
+	// ID is port's ID.
+	ID string
+	// Err is a reason of a failure.
+	Err error
+}
+
+// ImportReport describes what has happened with every imported port.
+type ImportReport struct {
+	// Created contains IDs of created ports.
+	Created []string
+	// Updated contains IDs of updated ports.
+	Updated []string
+	// Skipped contains IDs of ports which have not been changed.
+	Skipped []string
+	// Deleted contains IDs of ports which have been deleted, because they are not in imported data.
+	Deleted []string
+	// Failed contains ports which could not be imported.
+	Failed []ImportFailure
+}
+
+// Import streams ports from a reader in the same format as ReadPorts does, and stores them in a port's service.
+// Ports are stored one by one as soon as they are read, so a whole input is never kept in memory.
+// An import is not atomic. When an input is malformed, then ports which have been read so far remain stored,
+// and they are still reported. Ports are deleted by ImportReplace mode only when the whole input has been read.
+func Import(ctx context.Context, svc PortService, reader io.Reader, options ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	if len(options.Mode) == 0 {
+		options.Mode = ImportCreate
+	}
+	if !options.Mode.Valid() {
+		return report, ErrInvalidImportMode
+	}
+
+	// readCtx stops reading when a port fails in ReadStrict mode.
+	readCtx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+
+	type readResult struct {
+		summary ReadSummary
+		err     error
+	}
+	channel := make(chan PortWithID, importBuffer)
+	read := make(chan readResult, 1)
+	go func() {
+		summary, err := ReadPortsWithOptions(readCtx, reader, channel, ReadOptions{
+			Mode:      options.ReadMode,
+			Normalize: options.Normalize,
+			Validate:  options.Validate,
+		})
+		read <- readResult{summary: summary, err: err}
+		close(channel)
+	}()
+
+	// imported contains IDs of all imported ports, so ImportReplace mode knows which ports must be deleted.
+	imported := make(map[string]struct{})
+	var importErr error
+	for port := range channel {
+		// ReadPortsWithOptions can not be stopped while it sends ports, so the channel is always drained.
+		if readCtx.Err() != nil {
+			continue
+		}
+
+		imported[port.ID] = struct{}{}
+		if err := importPort(ctx, svc, port, options, &report); err != nil {
+			report.Failed = append(report.Failed, ImportFailure{ID: port.ID, Err: err})
+			if options.ReadMode == ReadStrict {
+				importErr = fmt.Errorf("failed to import port \"%s\": %w", port.ID, err)
+				cancelRead()
+			}
+		}
+	}
+
+	result := <-read
+	for _, rejected := range result.summary.Rejected {
+		// Rejected ports are not stored, but they are still in imported data, so they are not deleted.
+		imported[rejected.ID] = struct{}{}
+		report.Failed = append(report.Failed, ImportFailure{ID: rejected.ID, Err: rejected})
+	}
+
+	if importErr != nil {
+		return report, importErr
+	}
+
+	if result.err != nil {
+		return report, result.err
+	}
+
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+
+	if options.Mode == ImportReplace {
+		if err := deleteNotImported(ctx, svc, imported, &report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// importPort stores a single port, and adds it to a report.
+func importPort(ctx context.Context, svc PortService, port PortWithID, options ImportOptions, report *ImportReport) error {
+	if options.Mode == ImportCreate {
+		err := svc.Create(ctx, port.ID, port.Port)
+		switch {
+		case errors.Is(err, ErrPortAlreadyExist):
+			report.Skipped = append(report.Skipped, port.ID)
+		case err != nil:
+			return err
+		default:
+			report.Created = append(report.Created, port.ID)
+		}
+
+		return nil
+	}
+
+	result, err := Upsert(ctx, svc, port.ID, port.Port)
+	if err != nil {
+		return err
+	}
+	report.Add(port.ID, result)
+
+	return nil
+}
+
+// UpsertResult describes what has happened with a port in Upsert.
+type UpsertResult int
+
+const (
+	// UpsertCreated means that a port has been created.
+	UpsertCreated UpsertResult = iota
+	// UpsertUpdated means that an existing port has been updated.
+	UpsertUpdated
+	// UpsertUnchanged means that an existing port has been the same, so it has not been updated.
+	UpsertUnchanged
+)
+
+// Upsert creates a port, or it updates an existing one when it is different.
+// A port which is not changed keeps its revision. Empty and missing values are the same, like in Event.Changes.
+func Upsert(ctx context.Context, svc PortService, ID string, port Port) (UpsertResult, error) {
+	err := svc.Create(ctx, ID, port)
+	if err == nil {
+		return UpsertCreated, nil
+	}
+
+	if !errors.Is(err, ErrPortAlreadyExist) {
+		return 0, err
+	}
+
+	_, err = svc.Modify(ctx, ID, func(previous Port) (Port, error) {
+		port.Revision = previous.Revision
+		if len((Event{Before: &previous, After: &port}).Changes()) == 0 {
+			return previous, errUnchanged
+		}
+
+		return port, nil
+	})
+	switch {
+	case errors.Is(err, errUnchanged):
+		return UpsertUnchanged, nil
+	case err != nil:
+		return 0, err
+	default:
+		return UpsertUpdated, nil
+	}
+}
+
+// Add adds a port to a report according to a result of Upsert.
+func (r *ImportReport) Add(ID string, result UpsertResult) {
+	switch result {
+	case UpsertCreated:
+		r.Created = append(r.Created, ID)
+	case UpsertUpdated:
+		r.Updated = append(r.Updated, ID)
+	case UpsertUnchanged:
+		r.Skipped = append(r.Skipped, ID)
+	}
+}
+
+// deleteNotImported deletes all ports which have not been imported, and adds them to a report.
+func deleteNotImported(ctx context.Context, svc PortService, imported map[string]struct{}, report *ImportReport) error {
+	var deleted []string
+	options := ListOptions{Limit: MaxListLimit}
+	for {
+		list, err := svc.List(ctx, options)
+		if err != nil {
+			return fmt.Errorf("failed to list ports: %w", err)
+		}
+
+		for _, port := range list.Ports {
+			if _, ok := imported[port.ID]; !ok {
+				deleted = append(deleted, port.ID)
+			}
+		}
+
+		if len(list.NextCursor) == 0 {
+			break
+		}
+		options.Cursor = list.NextCursor
+	}
+
+	for _, ID := range deleted {
+		err := svc.Delete(ctx, ID)
+		switch {
+		case errors.Is(err, ErrPortNotFound):
+			// A port has been deleted by someone else in the meantime.
+		case err != nil:
+			report.Failed = append(report.Failed, ImportFailure{ID: ID, Err: err})
+		default:
+			report.Deleted = append(report.Deleted, ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package ports_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/memory"
+)
+
+func TestImport(t *testing.T) { // nolint: funlen
+	ctx := context.Background()
+	data := `{
+		"PLGDN": { "name": "Gdansk", "coordinates": [18.6466, 54.352], "alias": [] },
+		"PLGDY": { "name": "Gdynia", "coordinates": [18.5305, 54.5189] },
+		"DEHAM": { "name": "Hamburg", "coordinates": [9.9937, 53.5511] }
+	}`
+
+	// newService returns a service with an unchanged, a changed and a not imported port.
+	newService := func(t *testing.T) ports.PortService {
+		svc := memory.NewPortMemory()
+		require.NoError(t, svc.Create(ctx, "PLGDN", ports.Port{Name: "Gdansk", Coordinates: []float64{18.6466, 54.352}}))
+		require.NoError(t, svc.Create(ctx, "PLGDY", ports.Port{Name: "Old Gdynia"}))
+		require.NoError(t, svc.Create(ctx, "NLRTM", ports.Port{Name: "Rotterdam"}))
+
+		return svc
+	}
+
+	t.Run("create only", func(t *testing.T) {
+		svc := newService(t)
+		report, err := ports.Import(ctx, svc, strings.NewReader(data), ports.ImportOptions{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"DEHAM"}, report.Created)
+		require.Equal(t, []string{"PLGDN", "PLGDY"}, report.Skipped)
+		require.Empty(t, report.Updated)
+
+		port, err := svc.Get(ctx, "PLGDY")
+		require.NoError(t, err)
+		require.Equal(t, "Old Gdynia", port.Name)
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		svc := newService(t)
+		report, err := ports.Import(ctx, svc, strings.NewReader(data), ports.ImportOptions{Mode: ports.ImportUpsert})
+		require.NoError(t, err)
+		require.Equal(t, []string{"DEHAM"}, report.Created)
+		require.Equal(t, []string{"PLGDY"}, report.Updated)
+		require.Equal(t, []string{"PLGDN"}, report.Skipped)
+		require.Empty(t, report.Deleted)
+
+		port, err := svc.Get(ctx, "PLGDY")
+		require.NoError(t, err)
+		require.Equal(t, "Gdynia", port.Name)
+		_, err = svc.Get(ctx, "NLRTM")
+		require.NoError(t, err)
+	})
+
+	t.Run("replace all", func(t *testing.T) {
+		svc := newService(t)
+		validationErr := errors.New("validation error")
+		report, err := ports.Import(ctx, svc, strings.NewReader(data), ports.ImportOptions{
+			Mode: ports.ImportReplace,
+			Validate: func(port ports.PortWithID) error {
+				if port.ID == "PLGDY" {
+					return validationErr
+				}
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"DEHAM"}, report.Created)
+		require.Equal(t, []string{"NLRTM"}, report.Deleted)
+		require.Len(t, report.Failed, 1)
+		require.Equal(t, "PLGDY", report.Failed[0].ID)
+		require.ErrorIs(t, report.Failed[0].Err, validationErr)
+
+		list, err := svc.List(ctx, ports.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Ports, 3, "failed port must not be deleted")
+	})
+
+	t.Run("malformed data", func(t *testing.T) {
+		svc := newService(t)
+		report, err := ports.Import(ctx, svc, strings.NewReader(`{ "DEHAM": { "name": "Hamburg" }, 1: {} }`),
+			ports.ImportOptions{Mode: ports.ImportReplace})
+		require.Error(t, err)
+		require.Equal(t, []string{"DEHAM"}, report.Created, "ports imported so far must be reported")
+		require.Empty(t, report.Deleted, "ports must not be deleted when data is not fully read")
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		svc := newService(t)
+		report, err := ports.Import(ctx, svc, strings.NewReader(data), ports.ImportOptions{
+			Mode:     ports.ImportReplace,
+			ReadMode: ports.ReadStrict,
+			Validate: func(port ports.PortWithID) error {
+				if port.ID == "PLGDY" {
+					return errors.New("validation error")
+				}
+				return nil
+			},
+		})
+		var readErr *ports.ReadError
+		require.ErrorAs(t, err, &readErr)
+		require.Equal(t, "PLGDY", readErr.ID)
+		require.Equal(t, []string{"PLGDN"}, report.Skipped)
+		require.Len(t, report.Failed, 1)
+		require.Empty(t, report.Created, "import must stop at the first failed port")
+		require.Empty(t, report.Deleted)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, err := ports.Import(ctx, newService(t), strings.NewReader(data), ports.ImportOptions{Mode: "merge"})
+		require.ErrorIs(t, err, ports.ErrInvalidImportMode)
+	})
+}
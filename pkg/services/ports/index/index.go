@@ -0,0 +1,142 @@
+// Package index provides sorted indexes of ports for storages which keep ports in memory.
+// Thanks to them a page of ports is found without copying and sorting all ports on every request.
+package index
+
+import (
+	"sort"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// entry is a single port in a sorted index.
+type entry struct {
+	key string
+	id  string
+}
+
+// less compares entries by a key, and then by an ID.
+func (e entry) less(other entry) bool {
+	if e.key != other.key {
+		return e.key < other.key
+	}
+
+	return e.id < other.id
+}
+
+// NewIndex creates empty indexes for all sort fields.
+func NewIndex() *Index {
+	idx := &Index{
+		sorted: make(map[ports.SortField][]entry, len(ports.SortFields)),
+	}
+	for _, field := range ports.SortFields {
+		idx.sorted[field] = nil
+	}
+
+	return idx
+}
+
+// Index keeps port's IDs sorted by every sort field.
+// It is not safe for concurrent use, so a caller must synchronize access to it together with ports.
+type Index struct {
+	// sorted contains entries sorted by a key and an ID for each sort field.
+	sorted map[ports.SortField][]entry
+}
+
+// Put adds a port to indexes.
+// When a port already exists, then its previous version must be provided, so it can be replaced.
+func (idx *Index) Put(ID string, previous *ports.Port, port ports.Port) {
+	for field, entries := range idx.sorted {
+		if previous != nil {
+			entries = remove(entries, entry{key: field.Key(ID, *previous), id: ID})
+		}
+		idx.sorted[field] = insert(entries, entry{key: field.Key(ID, port), id: ID})
+	}
+}
+
+// Remove removes a port from indexes.
+func (idx *Index) Remove(ID string, port ports.Port) {
+	for field, entries := range idx.sorted {
+		idx.sorted[field] = remove(entries, entry{key: field.Key(ID, port), id: ID})
+	}
+}
+
+// List returns a page of ports which match given options.
+// It iterates over a sorted index from a cursor until a page is full, and fetches ports by get function.
+func (idx *Index) List(options ports.ListOptions, get func(ID string) ports.Port) (ports.PortList, error) {
+	options = options.Normalize()
+	entries, ok := idx.sorted[options.SortBy]
+	if !ok {
+		return ports.PortList{}, ports.ErrInvalidSortField
+	}
+
+	// start is a position of the first entry in ascending order.
+	start := 0
+	// end is a position after the last entry in ascending order.
+	end := len(entries)
+	if len(options.Cursor) > 0 {
+		cursor, err := ports.ParseCursor(options)
+		if err != nil {
+			return ports.PortList{}, err
+		}
+
+		last := entry{key: cursor.Key, id: cursor.ID}
+		if options.Descending {
+			// Entries which are not less than the cursor have been already returned.
+			end = sort.Search(len(entries), func(i int) bool {
+				return !entries[i].less(last)
+			})
+		} else {
+			// Entries which are not greater than the cursor have been already returned.
+			start = sort.Search(len(entries), func(i int) bool {
+				return last.less(entries[i])
+			})
+		}
+	}
+
+	var list ports.PortList
+	for i := 0; i < end-start; i++ {
+		e := entries[start+i]
+		if options.Descending {
+			e = entries[end-1-i]
+		}
+
+		port := get(e.id)
+		if !options.Filter.Match(port) {
+			continue
+		}
+
+		if len(list.Ports) == options.Limit {
+			last := list.Ports[len(list.Ports)-1]
+			list.NextCursor = ports.NewCursor(options, last.ID, last.Port).String()
+			break
+		}
+		list.Ports = append(list.Ports, ports.PortWithID{Port: port, ID: e.id})
+	}
+
+	return list, nil
+}
+
+// insert inserts an entry into sorted entries.
+func insert(entries []entry, e entry) []entry {
+	i := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].less(e)
+	})
+
+	entries = append(entries, entry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = e
+
+	return entries
+}
+
+// remove removes an entry from sorted entries.
+func remove(entries []entry, e entry) []entry {
+	i := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].less(e)
+	})
+	if i == len(entries) || entries[i] != e {
+		return entries
+	}
+
+	return append(entries[:i], entries[i+1:]...)
+}
@@ -10,12 +10,18 @@ var (
 	ErrPortNotFound = errors.New("port not found")
 	// ErrPortAlreadyExist is returned by PortService methods when port already exist.
 	ErrPortAlreadyExist = errors.New("port already exist")
+	// ErrRevisionMismatch is returned by PortService methods when port has a different revision than expected.
+	ErrRevisionMismatch = errors.New("port revision mismatch")
 )
 
 // Port describes port specific information.
 type Port struct {
+	// Alias is a list of alternative names of a port.
+	Alias []string
 	// City is a city of a port.
 	City string
+	// Code is a code of a port.
+	Code string
 	// Coordinates is a coordinates of a port.
 	Coordinates []float64
 	// Country is a country of a port.
@@ -24,8 +30,21 @@ type Port struct {
 	Name string
 	// Province is a province of a port.
 	Province string
+	// Regions is a list of regions of a port.
+	Regions []string
+	// Timezone is an IANA time zone name of a port.
+	Timezone string
+	// Unlocs is a list of UN/LOCODEs of a port.
+	Unlocs []string
+	// Revision is set by a port's service every time a port is stored, and it is ignored in ports from callers.
+	// Revisions grow across all ports of a service, so a port never gets the same revision again,
+	// even when it is deleted and created again.
+	Revision uint64
 }
 
+// ModifyFunc returns a modified copy of a port.
+type ModifyFunc func(port Port) (Port, error)
+
 // PortService is a port service interface.
 type PortService interface {
 	// Create creates a new port entry.
@@ -34,4 +53,67 @@ type PortService interface {
 	Get(_ context.Context, ID string) (Port, error)
 	// Update updates an existing port.
 	Update(ctx context.Context, ID string, port Port) error
+	// UpdateIfRevision updates an existing port only when it has a given revision.
+	// ErrRevisionMismatch is returned when port has been changed in the meantime.
+	UpdateIfRevision(ctx context.Context, ID string, revision uint64, port Port) error
+	// Modify reads an existing port, modifies it and stores the result atomically, so concurrent changes are not lost.
+	// When modify function returns an error, then the port is not changed, and the error is returned.
+	Modify(ctx context.Context, ID string, modify ModifyFunc) (Port, error)
+	// Delete deletes an existing port.
+	Delete(ctx context.Context, ID string) error
+	// List returns a page of ports which match given options.
+	List(ctx context.Context, options ListOptions) (PortList, error)
+}
+
+// ReturningService is implemented by port's services which return ports of their changes, so a change is described
+// exactly, even when the same port is changed concurrently by other writers, e.g. other instances of the server.
+type ReturningService interface {
+	// CreateReturning creates a new port entry, and it returns the stored port with its revision.
+	CreateReturning(ctx context.Context, ID string, port Port) (Port, error)
+	// DeleteReturning deletes an existing port, and it returns the deleted port.
+	DeleteReturning(ctx context.Context, ID string) (Port, error)
+}
+
+// CreateReturning creates a port, and it returns the stored port. When a service does not implement
+// ReturningService, then a port is read after it is created, so it can be already changed by someone else.
+func CreateReturning(ctx context.Context, svc PortService, ID string, port Port) (Port, error) {
+	if returning, ok := svc.(ReturningService); ok {
+		return returning.CreateReturning(ctx, ID, port)
+	}
+
+	if err := svc.Create(ctx, ID, port); err != nil {
+		return Port{}, err
+	}
+	if stored, err := svc.Get(ctx, ID); err == nil {
+		return stored, nil
+	}
+
+	return port, nil
+}
+
+// DeleteReturning deletes a port, and it returns the deleted port. When a service does not implement
+// ReturningService, then a port is read before it is deleted, so it can be changed by someone else in the meantime.
+func DeleteReturning(ctx context.Context, svc PortService, ID string) (Port, error) {
+	if returning, ok := svc.(ReturningService); ok {
+		return returning.DeleteReturning(ctx, ID)
+	}
+
+	port, err := svc.Get(ctx, ID)
+	if err != nil {
+		return Port{}, err
+	}
+
+	return port, svc.Delete(ctx, ID)
+}
+
+// Counter is implemented by port's services which can count their ports.
+type Counter interface {
+	// Count returns a number of stored ports.
+	Count(ctx context.Context) (int, error)
+}
+
+// Pinger is implemented by port's services which depend on a storage which can become unavailable.
+type Pinger interface {
+	// Ping returns an error when a storage is not available.
+	Ping(ctx context.Context) error
 }
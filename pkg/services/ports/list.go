@@ -0,0 +1,199 @@
+package ports
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	// DefaultListLimit is a number of ports on a single page when a caller does not provide a limit.
+	DefaultListLimit = 50
+	// MaxListLimit is a maximum number of ports on a single page.
+	MaxListLimit = 1000
+)
+
+var (
+	// ErrInvalidCursor is returned by PortService.List when a cursor is malformed or it does not match list's options.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSortField is returned by PortService.List when a sort field is not supported.
+	ErrInvalidSortField = errors.New("invalid sort field")
+)
+
+// SortField describes by which port's property a list is sorted.
+// Ports with the same value of a property are always sorted by their IDs.
+type SortField string
+
+const (
+	// SortByID sorts ports by their IDs.
+	SortByID SortField = "id"
+	// SortByName sorts ports by their names.
+	SortByName SortField = "name"
+	// SortByCountry sorts ports by their countries.
+	SortByCountry SortField = "country"
+	// SortByProvince sorts ports by their provinces.
+	SortByProvince SortField = "province"
+	// SortByCity sorts ports by their cities.
+	SortByCity SortField = "city"
+)
+
+// SortFields contains all supported sort fields.
+var SortFields = []SortField{SortByID, SortByName, SortByCountry, SortByProvince, SortByCity}
+
+// Valid checks whether a sort field is supported.
+func (f SortField) Valid() bool {
+	for _, field := range SortFields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Key returns a value of port's property by which ports are sorted.
+func (f SortField) Key(ID string, port Port) string {
+	switch f {
+	case SortByName:
+		return port.Name
+	case SortByCountry:
+		return port.Country
+	case SortByProvince:
+		return port.Province
+	case SortByCity:
+		return port.City
+	default:
+		return ID
+	}
+}
+
+// ListFilter describes which ports are returned by PortService.List.
+// Empty properties are not taken into account. All properties are compared case-insensitively.
+type ListFilter struct {
+	// Country must be equal to port's country.
+	Country string
+	// Province must be equal to port's province.
+	Province string
+	// City must be equal to port's city.
+	City string
+	// NamePrefix must be a prefix of port's name.
+	NamePrefix string
+	// NameContains must be a substring of port's name.
+	NameContains string
+}
+
+// Match checks whether a port matches a filter.
+func (f ListFilter) Match(port Port) bool {
+	if len(f.Country) > 0 && !strings.EqualFold(f.Country, port.Country) {
+		return false
+	}
+
+	if len(f.Province) > 0 && !strings.EqualFold(f.Province, port.Province) {
+		return false
+	}
+
+	if len(f.City) > 0 && !strings.EqualFold(f.City, port.City) {
+		return false
+	}
+
+	name := strings.ToLower(port.Name)
+	if len(f.NamePrefix) > 0 && !strings.HasPrefix(name, strings.ToLower(f.NamePrefix)) {
+		return false
+	}
+
+	if len(f.NameContains) > 0 && !strings.Contains(name, strings.ToLower(f.NameContains)) {
+		return false
+	}
+
+	return true
+}
+
+// ListOptions describes which page of ports is returned by PortService.List.
+type ListOptions struct {
+	// Filter describes which ports are returned.
+	Filter ListFilter
+	// SortBy describes order of ports. Ports are sorted by ID when it is empty.
+	SortBy SortField
+	// Descending reverses order of ports.
+	Descending bool
+	// Limit is a maximum number of ports on a page. DefaultListLimit is used when it is not positive.
+	Limit int
+	// Cursor is returned with a previous page, and it points where a next page starts.
+	// The first page is returned when it is empty.
+	Cursor string
+}
+
+// Normalize sets default values of options.
+func (o ListOptions) Normalize() ListOptions {
+	if len(o.SortBy) == 0 {
+		o.SortBy = SortByID
+	}
+
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	} else if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+
+	return o
+}
+
+// PortList is a single page of ports.
+type PortList struct {
+	// Ports on a page.
+	Ports []PortWithID
+	// NextCursor points to a next page. It is empty for the last page.
+	NextCursor string
+}
+
+// Cursor points to the last port on a page.
+// Ports are sorted by a key and ID, so a next page starts after the last port even when ports are changed.
+type Cursor struct {
+	// SortBy is a sort field of a list.
+	SortBy SortField `json:"s"`
+	// Descending is an order of a list.
+	Descending bool `json:"d,omitempty"`
+	// Key is a value of a sort field of the last port.
+	Key string `json:"k"`
+	// ID is an ID of the last port.
+	ID string `json:"i"`
+}
+
+// NewCursor creates a cursor which points to a given port.
+func NewCursor(options ListOptions, ID string, port Port) Cursor {
+	return Cursor{
+		SortBy:     options.SortBy,
+		Descending: options.Descending,
+		Key:        options.SortBy.Key(ID, port),
+		ID:         ID,
+	}
+}
+
+// String encodes a cursor, so it can be sent to a caller.
+func (c Cursor) String() string {
+	b, _ := json.Marshal(c) // nolint: errchkjson
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a cursor for given options.
+// ErrInvalidCursor is returned when a cursor has been created for a different order.
+func ParseCursor(options ListOptions) (Cursor, error) {
+	var cursor Cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(options.Cursor)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	if cursor.SortBy != options.SortBy || cursor.Descending != options.Descending {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
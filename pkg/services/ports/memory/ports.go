@@ -3,14 +3,21 @@ package memory
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/geo"
+	"github.com/informalict/ports/pkg/services/ports/index"
+	"github.com/informalict/ports/pkg/services/ports/watch"
 )
 
 // NewPortMemory creates port's memory storage.
 func NewPortMemory() *portMemory {
 	return &portMemory{
 		ports: make(map[string]ports.Port),
+		index: index.NewIndex(),
+		grid:  geo.NewGrid(),
+		hub:   watch.NewHub(watch.DefaultCapacity, 0),
 	}
 }
 
@@ -19,19 +26,35 @@ type portMemory struct {
 	mutex sync.RWMutex
 	// ports stores ports.
 	ports map[string]ports.Port
+	// index keeps ports sorted, so they can be listed.
+	index *index.Index
+	// grid keeps ports by their locations, so they can be searched by coordinates.
+	grid *geo.Grid
+	// revision is the last revision of any port.
+	revision uint64
+	// size is a number of ports, and it is read without the mutex, so counting does not block other actions.
+	size atomic.Int64
+	// hub sends changes to watchers, and it never waits for them while the mutex is held.
+	hub *watch.Hub
 }
 
 // Create creates a port in memory with a given port ID.
-func (p *portMemory) Create(_ context.Context, ID string, port ports.Port) error {
+func (p *portMemory) Create(ctx context.Context, ID string, port ports.Port) error {
+	_, err := p.CreateReturning(ctx, ID, port)
+
+	return err
+}
+
+// CreateReturning creates a port in memory with a given port ID, and it returns the stored port.
+func (p *portMemory) CreateReturning(_ context.Context, ID string, port ports.Port) (ports.Port, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	if _, ok := p.ports[ID]; ok {
-		return ports.ErrPortAlreadyExist
+		return ports.Port{}, ports.ErrPortAlreadyExist
 	}
-	p.ports[ID] = port
 
-	return nil
+	return p.put(ID, nil, port), nil
 }
 
 // Get returns port for a given port's ID.
@@ -52,11 +75,157 @@ func (p *portMemory) Update(_ context.Context, ID string, port ports.Port) error
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if _, ok := p.ports[ID]; !ok {
+	previous, ok := p.ports[ID]
+	if !ok {
 		return ports.ErrPortNotFound
 	}
+	p.put(ID, &previous, port)
 
-	p.ports[ID] = port
+	return nil
+}
+
+// UpdateIfRevision updates an existing port only when it has a given revision.
+func (p *portMemory) UpdateIfRevision(_ context.Context, ID string, revision uint64, port ports.Port) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, ok := p.ports[ID]
+	if !ok {
+		return ports.ErrPortNotFound
+	}
+
+	if previous.Revision != revision {
+		return ports.ErrRevisionMismatch
+	}
+	p.put(ID, &previous, port)
 
 	return nil
 }
+
+// Modify reads an existing port, modifies it and stores the result atomically.
+// When port does not exist then error is returned.
+func (p *portMemory) Modify(_ context.Context, ID string, modify ports.ModifyFunc) (ports.Port, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, ok := p.ports[ID]
+	if !ok {
+		return ports.Port{}, ports.ErrPortNotFound
+	}
+
+	port, err := modify(previous)
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	return p.put(ID, &previous, port), nil
+}
+
+// Delete deletes an existing port.
+// When port does not exist then error is returned.
+func (p *portMemory) Delete(ctx context.Context, ID string) error {
+	_, err := p.DeleteReturning(ctx, ID)
+
+	return err
+}
+
+// DeleteReturning deletes an existing port, and it returns the deleted port.
+// When port does not exist then error is returned.
+func (p *portMemory) DeleteReturning(_ context.Context, ID string) (ports.Port, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	port, ok := p.ports[ID]
+	if !ok {
+		return ports.Port{}, ports.ErrPortNotFound
+	}
+
+	p.revision++
+	delete(p.ports, ID)
+	p.size.Add(-1)
+	p.index.Remove(ID, port)
+	p.grid.Remove(ID, port)
+	p.hub.Publish(ports.WatchEvent{Revision: p.revision, Action: ports.ActionDelete, PortID: ID, Port: port})
+
+	return port, nil
+}
+
+// put stores a port with a next revision and returns it.
+// When a port already exists, then its previous version must be provided. The caller must hold the mutex.
+func (p *portMemory) put(ID string, previous *ports.Port, port ports.Port) ports.Port {
+	p.revision++
+	port.Revision = p.revision
+
+	p.ports[ID] = port
+	action := ports.ActionUpdate
+	if previous == nil {
+		p.size.Add(1)
+		action = ports.ActionCreate
+	}
+	p.index.Put(ID, previous, port)
+	p.grid.Put(ID, previous, port)
+	p.hub.Publish(ports.WatchEvent{Revision: port.Revision, Action: action, PortID: ID, Port: port})
+
+	return port
+}
+
+// Count returns a number of ports in memory.
+func (p *portMemory) Count(_ context.Context) (int, error) {
+	return int(p.size.Load()), nil
+}
+
+// Watch returns a channel with changes whose revisions are greater than fromRevision.
+func (p *portMemory) Watch(ctx context.Context, fromRevision uint64) (<-chan ports.WatchEvent, error) {
+	return p.hub.Watch(ctx, fromRevision)
+}
+
+// List returns a page of ports which match given options.
+func (p *portMemory) List(_ context.Context, options ports.ListOptions) (ports.PortList, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.index.List(options, p.get)
+}
+
+// Nearest returns at most k ports which are the nearest to a point.
+func (p *portMemory) Nearest(_ context.Context, point ports.Point, k int) ([]ports.PortWithDistance, error) {
+	if !point.Valid() {
+		return nil, ports.ErrInvalidCoordinates
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return geo.WithPorts(p.grid.Nearest(point, k), p.get), nil
+}
+
+// WithinRadius returns ports which are not further from a point than a radius in kilometers.
+func (p *portMemory) WithinRadius(_ context.Context, point ports.Point, radius float64) ([]ports.PortWithDistance, error) {
+	if !point.Valid() {
+		return nil, ports.ErrInvalidCoordinates
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return geo.WithPorts(p.grid.WithinRadius(point, radius), p.get), nil
+}
+
+// WithinBoundingBox returns ports inside a bounding box, and distance is measured from a given point.
+func (p *portMemory) WithinBoundingBox(
+	_ context.Context, box ports.BoundingBox, from ports.Point,
+) ([]ports.PortWithDistance, error) {
+	if !box.Valid() || !from.Valid() {
+		return nil, ports.ErrInvalidCoordinates
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return geo.WithPorts(p.grid.WithinBoundingBox(box, from), p.get), nil
+}
+
+// get returns a port which exists. The caller must hold the mutex.
+func (p *portMemory) get(ID string) ports.Port {
+	return p.ports[ID]
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/portstest"
+)
+
+func TestPortMemory(t *testing.T) {
+	portstest.TestPortService(t, func(t *testing.T) ports.PortService {
+		return NewPortMemory()
+	})
+}
@@ -0,0 +1,579 @@
+// Package portstest provides tests which every implementation of ports.PortService must pass.
+package portstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// NewPortService creates an empty port's service for a single test.
+type NewPortService func(t *testing.T) ports.PortService
+
+// TestPortService runs all tests for a port's service.
+func TestPortService(t *testing.T, newService NewPortService) {
+	t.Run("create and get", func(t *testing.T) {
+		testCreateAndGet(t, newService(t))
+	})
+	t.Run("update", func(t *testing.T) {
+		testUpdate(t, newService(t))
+	})
+	t.Run("modify", func(t *testing.T) {
+		testModify(t, newService(t))
+	})
+	t.Run("concurrent modify", func(t *testing.T) {
+		testConcurrentModify(t, newService(t))
+	})
+	t.Run("delete", func(t *testing.T) {
+		testDelete(t, newService(t))
+	})
+	t.Run("revision", func(t *testing.T) {
+		testRevision(t, newService(t))
+	})
+	t.Run("concurrent create", func(t *testing.T) {
+		testConcurrentCreate(t, newService(t))
+	})
+	t.Run("list", func(t *testing.T) {
+		testList(t, newService(t))
+	})
+	t.Run("geo", func(t *testing.T) {
+		svc := newService(t)
+		geoSvc, ok := svc.(ports.GeoService)
+		if !ok {
+			t.Skip("port's service does not implement ports.GeoService")
+		}
+		testGeo(t, svc, geoSvc)
+	})
+	t.Run("count", func(t *testing.T) {
+		svc := newService(t)
+		counter, ok := svc.(ports.Counter)
+		if !ok {
+			t.Skip("port's service does not implement ports.Counter")
+		}
+		testCount(t, svc, counter)
+	})
+	t.Run("watch", func(t *testing.T) {
+		svc := newService(t)
+		watcher, ok := svc.(ports.Watcher)
+		if !ok {
+			t.Skip("port's service does not implement ports.Watcher")
+		}
+		testWatch(t, svc, watcher)
+	})
+	t.Run("returning", func(t *testing.T) {
+		svc := newService(t)
+		returning, ok := svc.(ports.ReturningService)
+		if !ok {
+			t.Skip("port's service does not implement ports.ReturningService")
+		}
+		testReturning(t, svc, returning)
+	})
+}
+
+// testReturning tests for ports which are returned by created and deleted ports.
+func testReturning(t *testing.T, svc ports.PortService, returning ports.ReturningService) {
+	ctx := context.Background()
+
+	created, err := returning.CreateReturning(ctx, "test", ValidPort("test"))
+	require.NoError(t, err)
+	stored, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	require.NotZero(t, created.Revision)
+	require.Equal(t, stored, created)
+	_, err = returning.CreateReturning(ctx, "test", ValidPort("test"))
+	require.ErrorIs(t, err, ports.ErrPortAlreadyExist)
+
+	deleted, err := returning.DeleteReturning(ctx, "test")
+	require.NoError(t, err)
+	require.Equal(t, stored, deleted)
+	_, err = returning.DeleteReturning(ctx, "test")
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+}
+
+// testWatch tests for watching every kind of change, and for resuming from a revision.
+func testWatch(t *testing.T, svc ports.PortService, watcher ports.Watcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// receive returns actions, IDs and revisions of a given number of changes.
+	receive := func(events <-chan ports.WatchEvent, count int) []ports.WatchEvent {
+		t.Helper()
+		received := make([]ports.WatchEvent, 0, count)
+		for len(received) < count {
+			select {
+			case event, ok := <-events:
+				require.True(t, ok, "watcher must not be closed")
+				received = append(received, ports.WatchEvent{
+					Action: event.Action, PortID: event.PortID, Revision: event.Revision,
+				})
+				if event.Action != ports.ActionDelete {
+					require.Equal(t, event.Revision, event.Port.Revision, "port must have revision of a change")
+				}
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "change has not been received")
+			}
+		}
+
+		return received
+	}
+
+	events, err := watcher.Watch(ctx, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Create(ctx, "first", ValidPort("first")))
+	created, err := svc.Get(ctx, "first")
+	require.NoError(t, err)
+	require.NoError(t, svc.Update(ctx, "first", ValidPort("updated")))
+	modified, err := svc.Modify(ctx, "first", func(port ports.Port) (ports.Port, error) {
+		return ValidPort("modified"), nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.Delete(ctx, "first"))
+
+	expected := []ports.WatchEvent{
+		{Action: ports.ActionCreate, PortID: "first", Revision: created.Revision},
+		{Action: ports.ActionUpdate, PortID: "first", Revision: created.Revision + 1},
+		{Action: ports.ActionUpdate, PortID: "first", Revision: modified.Revision},
+		{Action: ports.ActionDelete, PortID: "first", Revision: modified.Revision + 1},
+	}
+	require.Equal(t, expected, receive(events, 4))
+
+	resumed, err := watcher.Watch(ctx, created.Revision)
+	require.NoError(t, err)
+	require.Equal(t, expected[1:], receive(resumed, 3))
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond, "watcher must be closed when context is canceled")
+}
+
+// testCount tests for counting ports after every kind of change.
+func testCount(t *testing.T, svc ports.PortService, counter ports.Counter) {
+	ctx := context.Background()
+	requireCount := func(expected int) {
+		t.Helper()
+		count, err := counter.Count(ctx)
+		require.NoError(t, err)
+		require.Equal(t, expected, count)
+	}
+
+	requireCount(0)
+	require.NoError(t, svc.Create(ctx, "first", ValidPort("first")))
+	require.NoError(t, svc.Create(ctx, "second", ValidPort("second")))
+	require.ErrorIs(t, svc.Create(ctx, "second", ValidPort("second")), ports.ErrPortAlreadyExist)
+	requireCount(2)
+
+	require.NoError(t, svc.Update(ctx, "first", ValidPort("updated")))
+	_, err := svc.Modify(ctx, "second", func(port ports.Port) (ports.Port, error) {
+		return ValidPort("modified"), nil
+	})
+	require.NoError(t, err)
+	requireCount(2)
+
+	require.NoError(t, svc.Delete(ctx, "first"))
+	require.ErrorIs(t, svc.Delete(ctx, "first"), ports.ErrPortNotFound)
+	requireCount(1)
+}
+
+// ValidPort returns a port with all properties set.
+func ValidPort(name string) ports.Port {
+	return ports.Port{
+		Alias:       []string{name + "_alias"},
+		City:        "city",
+		Code:        "52000",
+		Coordinates: []float64{55.5136433, 25.4052165},
+		Country:     "country",
+		Name:        name,
+		Province:    "province",
+		Regions:     []string{"region"},
+		Timezone:    "Asia/Dubai",
+		Unlocs:      []string{"AEAJM"},
+	}
+}
+
+// RequireEqualPort checks whether ports are equal without their revisions, which are set by a service.
+func RequireEqualPort(t *testing.T, expected, actual ports.Port, msgAndArgs ...interface{}) {
+	t.Helper()
+
+	expected.Revision = 0
+	actual.Revision = 0
+	require.Equal(t, expected, actual, msgAndArgs...)
+}
+
+func testCreateAndGet(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+
+	_, err := svc.Get(ctx, "test")
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+	port := ValidPort("test")
+	require.NoError(t, svc.Create(ctx, "test", port))
+
+	svcPort, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	RequireEqualPort(t, port, svcPort)
+
+	err = svc.Create(ctx, "test", ValidPort("other"))
+	require.ErrorIs(t, err, ports.ErrPortAlreadyExist)
+
+	svcPort, err = svc.Get(ctx, "test")
+	require.NoError(t, err)
+	RequireEqualPort(t, port, svcPort, "failed create must not change an existing port")
+}
+
+func testUpdate(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+
+	err := svc.Update(ctx, "test", ValidPort("test"))
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+	require.NoError(t, svc.Create(ctx, "test", ValidPort("test")))
+
+	port := ValidPort("new_test")
+	port.Coordinates = []float64{1, 2}
+	require.NoError(t, svc.Update(ctx, "test", port))
+
+	svcPort, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	RequireEqualPort(t, port, svcPort)
+}
+
+func testModify(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+	rename := func(port ports.Port) (ports.Port, error) {
+		port.Name = "new_" + port.Name
+		return port, nil
+	}
+
+	_, err := svc.Modify(ctx, "test", rename)
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+	require.NoError(t, svc.Create(ctx, "test", ValidPort("test")))
+	expected := ValidPort("test")
+	expected.Name = "new_test"
+
+	port, err := svc.Modify(ctx, "test", rename)
+	require.NoError(t, err)
+	RequireEqualPort(t, expected, port)
+
+	svcPort, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	RequireEqualPort(t, expected, svcPort)
+
+	errModify := errors.New("modify error")
+	_, err = svc.Modify(ctx, "test", func(port ports.Port) (ports.Port, error) {
+		port.Name = "failed"
+		return port, errModify
+	})
+	require.ErrorIs(t, err, errModify)
+
+	svcPort, err = svc.Get(ctx, "test")
+	require.NoError(t, err)
+	RequireEqualPort(t, expected, svcPort, "failed modification must not change a port")
+}
+
+func testConcurrentModify(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+	const workers = 20
+
+	port := ValidPort("test")
+	port.Alias = nil
+	require.NoError(t, svc.Create(ctx, "test", port))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := svc.Modify(ctx, "test", func(port ports.Port) (ports.Port, error) {
+				port.Alias = append(append([]string{}, port.Alias...), fmt.Sprintf("alias_%d", i))
+				return port, nil
+			})
+			// require can not be used outside of a test's goroutine.
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	port, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, port.Alias, workers, "every modification must be applied")
+}
+
+func testDelete(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+
+	err := svc.Delete(ctx, "test")
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+	require.NoError(t, svc.Create(ctx, "test", ValidPort("test")))
+	require.NoError(t, svc.Create(ctx, "other", ValidPort("other")))
+	require.NoError(t, svc.Delete(ctx, "test"))
+
+	_, err = svc.Get(ctx, "test")
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+	err = svc.Update(ctx, "test", ValidPort("test"))
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+	err = svc.Delete(ctx, "test")
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+	list, err := svc.List(ctx, ports.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Ports, 1)
+	require.Equal(t, "other", list.Ports[0].ID)
+
+	// A deleted port can be created again.
+	require.NoError(t, svc.Create(ctx, "test", ValidPort("new_test")))
+	port, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	RequireEqualPort(t, ValidPort("new_test"), port)
+}
+
+func testRevision(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+
+	err := svc.UpdateIfRevision(ctx, "test", 1, ValidPort("test"))
+	require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+	require.NoError(t, svc.Create(ctx, "test", ValidPort("test")))
+	created, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	require.NotZero(t, created.Revision)
+
+	// Revisions grow across all ports.
+	require.NoError(t, svc.Create(ctx, "other", ValidPort("other")))
+	other, err := svc.Get(ctx, "other")
+	require.NoError(t, err)
+	require.Greater(t, other.Revision, created.Revision)
+
+	require.NoError(t, svc.UpdateIfRevision(ctx, "test", created.Revision, ValidPort("updated")))
+	updated, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	require.Greater(t, updated.Revision, other.Revision)
+	RequireEqualPort(t, ValidPort("updated"), updated)
+
+	err = svc.UpdateIfRevision(ctx, "test", created.Revision, ValidPort("stale"))
+	require.ErrorIs(t, err, ports.ErrRevisionMismatch)
+
+	modified, err := svc.Modify(ctx, "test", func(port ports.Port) (ports.Port, error) {
+		require.Equal(t, updated.Revision, port.Revision)
+		port.Name = "modified"
+		return port, nil
+	})
+	require.NoError(t, err)
+	require.Greater(t, modified.Revision, updated.Revision)
+
+	svcPort, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	require.Equal(t, modified, svcPort)
+
+	// A revision is never reused, even when a deleted port is created again.
+	require.NoError(t, svc.Delete(ctx, "test"))
+	require.NoError(t, svc.Create(ctx, "test", ValidPort("test")))
+	recreated, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	require.Greater(t, recreated.Revision, modified.Revision+1)
+}
+
+func testConcurrentCreate(t *testing.T, svc ports.PortService) {
+	ctx := context.Background()
+	const workers = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- svc.Create(ctx, "test", ValidPort(fmt.Sprintf("test_%d", i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		require.ErrorIs(t, err, ports.ErrPortAlreadyExist)
+	}
+	require.Equal(t, 1, created, "only one port can be created for the same ID")
+}
+
+func testList(t *testing.T, svc ports.PortService) { // nolint: funlen
+	ctx := context.Background()
+
+	list, err := svc.List(ctx, ports.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, list.Ports)
+	require.Empty(t, list.NextCursor)
+
+	type location struct {
+		name, country, city string
+	}
+	locations := map[string]location{
+		"PLGDN": {"Gdansk", "Poland", "Gdansk"},
+		"PLGDY": {"Gdynia", "Poland", "Gdynia"},
+		"PLSZZ": {"Szczecin", "Poland", "Szczecin"},
+		"DEHAM": {"Hamburg", "Germany", "Hamburg"},
+		"DEBRV": {"Bremerhaven", "Germany", "Bremen"},
+		"NLRTM": {"Rotterdam", "Netherlands", "Rotterdam"},
+	}
+	for ID, l := range locations {
+		port := ValidPort(l.name)
+		port.Country = l.country
+		port.City = l.city
+		require.NoError(t, svc.Create(ctx, ID, port))
+	}
+
+	// listIDs fetches all pages and returns port's IDs.
+	listIDs := func(t *testing.T, options ports.ListOptions) []string {
+		var IDs []string
+		for {
+			list, err := svc.List(ctx, options)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(list.Ports), options.Limit)
+			for _, port := range list.Ports {
+				IDs = append(IDs, port.ID)
+			}
+
+			if len(list.NextCursor) == 0 {
+				return IDs
+			}
+			options.Cursor = list.NextCursor
+		}
+	}
+
+	t.Run("sort by ID", func(t *testing.T) {
+		IDs := listIDs(t, ports.ListOptions{Limit: 4})
+		require.Equal(t, []string{"DEBRV", "DEHAM", "NLRTM", "PLGDN", "PLGDY", "PLSZZ"}, IDs)
+	})
+
+	t.Run("sort by name descending", func(t *testing.T) {
+		IDs := listIDs(t, ports.ListOptions{Limit: 1, SortBy: ports.SortByName, Descending: true})
+		require.Equal(t, []string{"PLSZZ", "NLRTM", "DEHAM", "PLGDY", "PLGDN", "DEBRV"}, IDs)
+	})
+
+	t.Run("sort by country", func(t *testing.T) {
+		IDs := listIDs(t, ports.ListOptions{Limit: 2, SortBy: ports.SortByCountry})
+		require.Equal(t, []string{"DEBRV", "DEHAM", "NLRTM", "PLGDN", "PLGDY", "PLSZZ"}, IDs)
+	})
+
+	t.Run("filter by country and name prefix", func(t *testing.T) {
+		IDs := listIDs(t, ports.ListOptions{
+			Limit:  1,
+			Filter: ports.ListFilter{Country: "poland", NamePrefix: "gd"},
+		})
+		require.Equal(t, []string{"PLGDN", "PLGDY"}, IDs)
+	})
+
+	t.Run("filter by city and name substring", func(t *testing.T) {
+		IDs := listIDs(t, ports.ListOptions{Limit: 10, Filter: ports.ListFilter{City: "Bremen", NameContains: "HAVEN"}})
+		require.Equal(t, []string{"DEBRV"}, IDs)
+
+		IDs = listIDs(t, ports.ListOptions{Limit: 10, Filter: ports.ListFilter{NameContains: "%"}})
+		require.Empty(t, IDs)
+	})
+
+	t.Run("cursor is stable when ports are changed", func(t *testing.T) {
+		options := ports.ListOptions{Limit: 2, SortBy: ports.SortByName}
+		list, err := svc.List(ctx, options)
+		require.NoError(t, err)
+		require.Len(t, list.Ports, 2)
+
+		// Moves the first port to the end of the list.
+		port := list.Ports[0].Port
+		port.Name = "Zeebrugge"
+		require.NoError(t, svc.Update(ctx, list.Ports[0].ID, port))
+
+		options.Cursor = list.NextCursor
+		IDs := listIDs(t, options)
+		require.Equal(t, []string{"PLGDY", "DEHAM", "NLRTM", "PLSZZ", list.Ports[0].ID}, IDs)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := svc.List(ctx, ports.ListOptions{Cursor: "invalid"})
+		require.ErrorIs(t, err, ports.ErrInvalidCursor)
+
+		list, err := svc.List(ctx, ports.ListOptions{Limit: 1})
+		require.NoError(t, err)
+		_, err = svc.List(ctx, ports.ListOptions{Limit: 1, SortBy: ports.SortByName, Cursor: list.NextCursor})
+		require.ErrorIs(t, err, ports.ErrInvalidCursor)
+	})
+
+	t.Run("invalid sort field", func(t *testing.T) {
+		_, err := svc.List(ctx, ports.ListOptions{SortBy: "coordinates"})
+		require.ErrorIs(t, err, ports.ErrInvalidSortField)
+	})
+}
+
+func testGeo(t *testing.T, svc ports.PortService, geoSvc ports.GeoService) {
+	ctx := context.Background()
+
+	locations := map[string][]float64{
+		"PLGDN": {18.6466, 54.352},
+		"PLGDY": {18.5305, 54.5189},
+		"DEHAM": {9.9937, 53.5511},
+		"NZAKL": {174.7633, -36.8485},
+	}
+	for ID, coordinates := range locations {
+		port := ValidPort(ID)
+		port.Coordinates = coordinates
+		require.NoError(t, svc.Create(ctx, ID, port))
+	}
+	// A port without coordinates is never found.
+	noCoordinates := ValidPort("none")
+	noCoordinates.Coordinates = nil
+	require.NoError(t, svc.Create(ctx, "NONE", noCoordinates))
+
+	foundIDs := func(found []ports.PortWithDistance) []string {
+		IDs := make([]string, 0, len(found))
+		for _, port := range found {
+			IDs = append(IDs, port.ID)
+		}
+
+		return IDs
+	}
+
+	sopot := ports.Point{Lat: 54.4418, Lon: 18.5601}
+
+	found, err := geoSvc.Nearest(ctx, sopot, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PLGDY", "PLGDN", "DEHAM"}, foundIDs(found))
+	require.InDelta(t, 8.75, found[0].Distance, 0.1)
+	require.Equal(t, ValidPort("PLGDY").Name, found[0].Name)
+
+	found, err = geoSvc.WithinRadius(ctx, sopot, 20)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PLGDY", "PLGDN"}, foundIDs(found))
+
+	box := ports.BoundingBox{MinLat: 50, MinLon: 5, MaxLat: 55, MaxLon: 18.6}
+	found, err = geoSvc.WithinBoundingBox(ctx, box, sopot)
+	require.NoError(t, err)
+	require.Equal(t, []string{"PLGDY", "DEHAM"}, foundIDs(found))
+
+	// Moved and deleted ports are found in their new locations only.
+	moved := ValidPort("PLGDY")
+	moved.Coordinates = locations["NZAKL"]
+	require.NoError(t, svc.Update(ctx, "PLGDY", moved))
+	require.NoError(t, svc.Delete(ctx, "PLGDN"))
+
+	found, err = geoSvc.Nearest(ctx, sopot, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"DEHAM", "NZAKL", "PLGDY"}, foundIDs(found))
+
+	_, err = geoSvc.Nearest(ctx, ports.Point{Lat: 91}, 1)
+	require.ErrorIs(t, err, ports.ErrInvalidCoordinates)
+}
@@ -1,8 +1,10 @@
 package ports
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -13,40 +15,217 @@ type PortWithID struct {
 	ID string
 }
 
+// ReadMode describes what happens when an entry is rejected by ReadPortsWithOptions.
+type ReadMode string
+
+const (
+	// ReadLenient skips rejected entries, and reads all valid ones.
+	ReadLenient ReadMode = "lenient"
+	// ReadStrict stops reading at the first rejected entry.
+	ReadStrict ReadMode = "strict"
+)
+
+// Valid checks whether a read mode is supported.
+func (m ReadMode) Valid() bool {
+	return m == ReadLenient || m == ReadStrict
+}
+
+// ReadError describes an entry which has been rejected, because it can not be decoded, or it is not valid.
+type ReadError struct {
+	// ID is port's ID. It is empty when an entry is broken before its ID.
+	ID string
+	// Offset is a byte offset where an entry starts.
+	Offset int64
+	// Line is a line number where an entry starts, and it is counted from 1.
+	Line int
+	// Err is a reason why an entry has been rejected.
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	if len(e.ID) == 0 {
+		return fmt.Sprintf("line %d (offset %d): %s", e.Line, e.Offset, e.Err)
+	}
+
+	return fmt.Sprintf("port \"%s\" at line %d (offset %d): %s", e.ID, e.Line, e.Offset, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// ReadOptions describes how ports are read by ReadPortsWithOptions.
+type ReadOptions struct {
+	// Mode describes what happens when an entry is rejected. ReadLenient is used when it is empty.
+	Mode ReadMode
+	// Normalize is applied to every decoded port before it is validated. Ports are not changed when it is nil.
+	Normalize func(port Port) Port
+	// Validate checks every decoded port, and a port is rejected when it returns an error.
+	// Ports are not validated when it is nil.
+	Validate func(port PortWithID) error
+	// OnError is called for every rejected entry, before it is added to a summary.
+	OnError func(err *ReadError)
+}
+
+// ReadSummary describes results of ReadPortsWithOptions.
+type ReadSummary struct {
+	// Read is a number of ports which have been sent to the channel.
+	Read int
+	// Rejected contains all rejected entries in order of their appearance.
+	Rejected []*ReadError
+}
+
 // ReadPorts reads port's data from a given reader and sends it to the channel.
 // When iterating JSON data is faster than sending to the channel then it will hang until caller receives data.
 // A caller can provide buffered channel, so it can control how many messages are in a memory.
 // A reader must provide data in valid format `{ "portID1": {}, "portID2": {}, ... }`.
+// Entries which can not be decoded are skipped. Use ReadPortsWithOptions to validate ports or to find rejected entries.
 func ReadPorts(ctx context.Context, reader io.Reader, channel chan<- PortWithID) error {
-	decoder := json.NewDecoder(reader)
+	_, err := ReadPortsWithOptions(ctx, reader, channel, ReadOptions{})
+
+	return err
+}
+
+// ReadPortsWithOptions works the same as ReadPorts, and it validates ports and reports rejected entries.
+// In ReadStrict mode the first rejected entry is returned as *ReadError.
+// Malformed JSON can not be read any further, so it is returned as *ReadError in both modes,
+// and a summary describes entries which have been read so far.
+func ReadPortsWithOptions(
+	ctx context.Context, reader io.Reader, channel chan<- PortWithID, options ReadOptions,
+) (ReadSummary, error) {
+	var summary ReadSummary
+	if len(options.Mode) == 0 {
+		options.Mode = ReadLenient
+	}
+	if !options.Mode.Valid() {
+		return summary, fmt.Errorf("read mode \"%s\" is not supported", options.Mode)
+	}
+
+	lines := &lineReader{reader: reader}
+	decoder := json.NewDecoder(lines)
+	// reject creates an error for an entry which starts at a given offset.
+	reject := func(ID string, offset int64, err error) *ReadError {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// A syntax error can be far away from a start of an entry, so it is reported where it is.
+			offset = syntaxErr.Offset
+		}
+
+		return &ReadError{ID: ID, Offset: offset, Line: lines.lineAt(offset), Err: err}
+	}
+
 	// Go to the first entry in a map.
-	if _, err := decoder.Token(); err != nil {
-		return err
+	if token, err := decoder.Token(); err != nil {
+		return summary, reject("", decoder.InputOffset(), err)
+	} else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return summary, reject("", 0, errors.New("ports must be a JSON object"))
 	}
 
-	var portID string
-	var validID bool
 	for decoder.More() {
 		if ctx.Err() != nil {
 			// A caller triggered cancellation.
-			return ctx.Err()
+			return summary, ctx.Err()
 		}
 
+		offset := entryOffset(lines, decoder.InputOffset())
 		// Get port ID for a next entry.
-		if v, err := decoder.Token(); err != nil {
-			return err
-		} else {
-			if portID, validID = v.(string); !validID {
-				return fmt.Errorf("string type is expected for port keys, but got \"%T\"", v)
+		v, err := decoder.Token()
+		if err != nil {
+			return summary, reject("", offset, err)
+		}
+		portID, validID := v.(string)
+		if !validID {
+			return summary, reject("", offset, fmt.Errorf("string type is expected for port keys, but got \"%T\"", v))
+		}
+
+		port := PortWithID{ID: portID}
+		err = decoder.Decode(&port.Port)
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// The rest of data can not be decoded.
+			return summary, reject(portID, offset, err)
+		}
+		if err == nil && options.Normalize != nil {
+			port.Port = options.Normalize(port.Port)
+		}
+		if err == nil && options.Validate != nil {
+			err = options.Validate(port)
+		}
+		if err != nil {
+			readErr := reject(portID, offset, err)
+			if options.OnError != nil {
+				options.OnError(readErr)
+			}
+			summary.Rejected = append(summary.Rejected, readErr)
+
+			if options.Mode == ReadStrict {
+				return summary, readErr
 			}
+			continue
+		}
+
+		channel <- port
+		summary.Read++
+	}
+
+	// Check the end of a map.
+	if _, err := decoder.Token(); err != nil {
+		return summary, reject("", decoder.InputOffset(), err)
+	}
+
+	return summary, nil
+}
+
+// entryOffset returns an offset where a next entry starts. Decoder's offset points before a comma and whitespaces.
+func entryOffset(lines *lineReader, offset int64) int64 {
+	for {
+		b, ok := lines.byteAt(offset)
+		if !ok || (b != ',' && b != ' ' && b != '\t' && b != '\n' && b != '\r') {
+			return offset
 		}
+		offset++
+	}
+}
+
+// lineReader counts lines of read data, so a line can be found for an offset.
+// Offsets must be asked in a non-decreasing order, and only data after the last asked offset is kept in memory.
+type lineReader struct {
+	reader io.Reader
+	// pending contains read data from pendingOffset.
+	pending       []byte
+	pendingOffset int64
+	// lines is a number of lines before pendingOffset.
+	lines int
+}
 
-		var port PortWithID
-		if err := decoder.Decode(&port.Port); err == nil {
-			port.ID = portID
-			channel <- port
+func (l *lineReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.pending = append(l.pending, p[:n]...)
+
+	return n, err
+}
+
+// lineAt returns a line number of an offset, and it forgets data before this offset.
+func (l *lineReader) lineAt(offset int64) int {
+	if skip := offset - l.pendingOffset; skip > 0 {
+		if skip > int64(len(l.pending)) {
+			skip = int64(len(l.pending))
 		}
+		l.lines += bytes.Count(l.pending[:skip], []byte("\n"))
+		l.pending = l.pending[skip:]
+		l.pendingOffset += skip
+	}
+
+	return l.lines + 1
+}
+
+// byteAt returns a byte at an offset, and it forgets data before this offset.
+// False is returned when data at an offset has not been read yet.
+func (l *lineReader) byteAt(offset int64) (byte, bool) {
+	l.lineAt(offset)
+	if offset != l.pendingOffset || len(l.pending) == 0 {
+		return 0, false
 	}
 
-	return nil
+	return l.pending[0], true
 }
@@ -3,6 +3,9 @@ package ports
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -28,16 +31,14 @@ func TestReadPorts(t *testing.T) {
 	})
 
 	t.Run("get port data sub object", func(t *testing.T) {
-		channel := make(chan PortWithID)
+		// A port is buffered, so it is received after reading has finished.
+		channel := make(chan PortWithID, 1)
 		data := `{ "portID": { "name": "portName", "coordinates": [1.0, 2.0] } }`
 		reader := bytes.NewReader([]byte(data))
 
-		var port PortWithID
-		go func() {
-			port = <-channel
-		}()
 		err := ReadPorts(context.Background(), reader, channel)
 		require.NoError(t, err)
+		port := <-channel
 		expectedPort := PortWithID{
 			Port: Port{
 				Coordinates: []float64{1, 2},
@@ -48,5 +49,127 @@ func TestReadPorts(t *testing.T) {
 		require.Equal(t, expectedPort, port)
 	})
 
+	t.Run("get port data with all properties", func(t *testing.T) {
+		// A port is buffered, so it is received after reading has finished.
+		channel := make(chan PortWithID, 1)
+		data := `{ "AEAJM": { "name": "Ajman", "city": "Ajman", "country": "United Arab Emirates",
+			"alias": ["Ajman Port"], "regions": ["Gulf"], "coordinates": [55.5136433, 25.4052165],
+			"province": "Ajman", "timezone": "Asia/Dubai", "unlocs": ["AEAJM"], "code": "52000" } }`
+		reader := bytes.NewReader([]byte(data))
+
+		err := ReadPorts(context.Background(), reader, channel)
+		require.NoError(t, err)
+		port := <-channel
+		expectedPort := PortWithID{
+			Port: Port{
+				Alias:       []string{"Ajman Port"},
+				City:        "Ajman",
+				Code:        "52000",
+				Coordinates: []float64{55.5136433, 25.4052165},
+				Country:     "United Arab Emirates",
+				Name:        "Ajman",
+				Province:    "Ajman",
+				Regions:     []string{"Gulf"},
+				Timezone:    "Asia/Dubai",
+				Unlocs:      []string{"AEAJM"},
+			},
+			ID: "AEAJM",
+		}
+		require.Equal(t, expectedPort, port)
+	})
+
 	// TODO test for context interruption.
 }
+
+func TestReadPortsWithOptions(t *testing.T) { // nolint: funlen
+	data := `{
+  "VALID1": { "name": "valid", "coordinates": [1.0, 2.0] },
+  "BROKEN": { "name": 1 },
+  "INVALID": { "coordinates": [1.0, 2.0] },
+  "VALID2": { "name": "valid", "coordinates": [1.0, 2.0] }
+}`
+	validate := func(port PortWithID) error {
+		if len(port.Name) == 0 {
+			return errors.New("name can not be empty")
+		}
+		return nil
+	}
+
+	// readIDs reads ports, and returns their IDs.
+	readIDs := func(data string, options ReadOptions) ([]string, ReadSummary, error) {
+		channel := make(chan PortWithID, 10)
+		summary, err := ReadPortsWithOptions(context.Background(), strings.NewReader(data), channel, options)
+		close(channel)
+
+		var IDs []string
+		for port := range channel {
+			IDs = append(IDs, port.ID)
+		}
+
+		return IDs, summary, err
+	}
+
+	t.Run("lenient mode", func(t *testing.T) {
+		var reported []string
+		IDs, summary, err := readIDs(data, ReadOptions{
+			Validate: validate,
+			OnError: func(err *ReadError) {
+				reported = append(reported, err.ID)
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"VALID1", "VALID2"}, IDs)
+		require.Equal(t, 2, summary.Read)
+		require.Equal(t, []string{"BROKEN", "INVALID"}, reported)
+
+		require.Len(t, summary.Rejected, 2)
+		broken := summary.Rejected[0]
+		require.Equal(t, "BROKEN", broken.ID)
+		require.Equal(t, 3, broken.Line)
+		require.Equal(t, int64(strings.Index(data, `"BROKEN"`)), broken.Offset)
+		var typeErr *json.UnmarshalTypeError
+		require.ErrorAs(t, broken, &typeErr)
+
+		invalid := summary.Rejected[1]
+		require.Equal(t, "INVALID", invalid.ID)
+		require.Equal(t, 4, invalid.Line)
+		require.EqualError(t, invalid.Err, "name can not be empty")
+	})
+
+	t.Run("without validation", func(t *testing.T) {
+		IDs, summary, err := readIDs(data, ReadOptions{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"VALID1", "INVALID", "VALID2"}, IDs)
+		require.Len(t, summary.Rejected, 1)
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		IDs, summary, err := readIDs(data, ReadOptions{Mode: ReadStrict, Validate: validate})
+		var readErr *ReadError
+		require.ErrorAs(t, err, &readErr)
+		require.Equal(t, "BROKEN", readErr.ID)
+		require.Equal(t, []string{"VALID1"}, IDs)
+		require.Equal(t, 1, summary.Read)
+	})
+
+	t.Run("malformed data", func(t *testing.T) {
+		IDs, _, err := readIDs("{\n\"VALID\": { \"name\": \"valid\" },\n\"TORN\": { \"name\" \"torn\" }\n}",
+			ReadOptions{})
+		var readErr *ReadError
+		require.ErrorAs(t, err, &readErr)
+		require.Equal(t, "TORN", readErr.ID)
+		require.Equal(t, 3, readErr.Line)
+		require.Equal(t, []string{"VALID"}, IDs)
+
+		_, _, err = readIDs(`{ "VALID": { "name": "valid" }`, ReadOptions{})
+		require.Error(t, err, "incomplete data must not be read as a complete one")
+
+		_, _, err = readIDs(`[]`, ReadOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, _, err := readIDs(data, ReadOptions{Mode: "fast"})
+		require.Error(t, err)
+	})
+}
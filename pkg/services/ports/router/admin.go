@@ -0,0 +1,70 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/informalict/ports/pkg/problem"
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// Reloader reloads ports from a seed file.
+type Reloader interface {
+	// Reload applies changes of a seed file to a port's service.
+	Reload(ctx context.Context) (ports.ImportReport, error)
+}
+
+// adminRouter describes HTTP router for administrative actions.
+type adminRouter struct {
+	reloader Reloader
+	logger   *slog.Logger
+}
+
+// NewAdminRouter returns a new router for administrative actions.
+func NewAdminRouter(reloader Reloader, logger *slog.Logger) http.Handler {
+	ar := &adminRouter{
+		reloader: reloader,
+		logger:   logger,
+	}
+
+	router := newRouter()
+	handle(router, http.MethodPost, "/admin/reload", ar.Reload)
+
+	return router
+}
+
+// Reload is an HTTP handler which reloads ports from a seed file, and returns a report for every changed port.
+// 422 is returned when a seed file is not valid, and then no port is changed.
+func (ar *adminRouter) Reload(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// A reload is not canceled when a client is gone, so it is never left half-applied.
+	report, err := ar.reloader.Reload(context.Background())
+	status := http.StatusOK
+	if err != nil {
+		var readErr *ports.ReadError
+		if errors.As(err, &readErr) {
+			status = http.StatusUnprocessableEntity
+		} else {
+			status = http.StatusInternalServerError
+		}
+
+		ar.logger.ErrorContext(r.Context(), "failed to reload seed file", "error", err)
+	}
+
+	b, err := json.Marshal(convertToAPIImportReport(report, err))
+	if err != nil {
+		ar.logger.ErrorContext(r.Context(), "failed to marshal reload report", "error", err)
+		problem.Error(w, r, "failed to serialize reload report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		ar.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+	}
+}
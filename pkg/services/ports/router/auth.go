@@ -0,0 +1,41 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/informalict/ports/pkg/auth"
+)
+
+// RequiredRole returns a role which is required for a request to the ports server:
+//   - reads of ports, their history and the audit log require auth.RoleReader,
+//   - creating, updating, patching and reverting ports require auth.RoleEditor,
+//   - deleting and importing ports, managing webhooks and administrative actions require auth.RoleAdmin.
+//
+// Other endpoints, such as probes and metrics, are public.
+func RequiredRole(r *http.Request) auth.Role {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/admin/"),
+		path == apiV1Prefix+"webhooks" || strings.HasPrefix(path, apiV1Prefix+"webhooks/"),
+		path == apiV1Prefix+"ports:import":
+		return auth.RoleAdmin
+	case !strings.HasPrefix(path, apiV1Prefix):
+		return auth.RoleNone
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return auth.RoleReader
+	case http.MethodDelete:
+		return auth.RoleAdmin
+	default:
+		return auth.RoleEditor
+	}
+}
+
+// StreamedBody returns whether a handler streams a request's body instead of reading it into memory. Only imports
+// are streamed, and bodies of other requests are limited.
+func StreamedBody(r *http.Request) bool {
+	return r.Method == http.MethodPost && r.URL.Path == apiV1Prefix+"ports:import"
+}
@@ -0,0 +1,323 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/problem"
+)
+
+const (
+	// DefaultMaxBodyBytes is a default limit of a size of a JSON body, other than an import.
+	DefaultMaxBodyBytes = 1 << 20
+	// jsonContentType is a content type of JSON bodies.
+	jsonContentType = "application/json"
+)
+
+// Options describes how routers handle requests.
+type Options struct {
+	// MaxBodyBytes limits a size of a JSON body, and 413 is returned for a larger one. Imports are streamed,
+	// so they are not limited. When it is zero, only strict bodies are limited by DefaultMaxBodyBytes, because
+	// they are kept in memory.
+	MaxBodyBytes int64
+	// StrictJSON rejects JSON bodies with unknown fields, so a mistyped field is not ignored silently.
+	StrictJSON bool
+}
+
+// DefaultOptions returns options which are used by the server by default.
+func DefaultOptions() Options {
+	return Options{
+		MaxBodyBytes: DefaultMaxBodyBytes,
+		StrictJSON:   true,
+	}
+}
+
+// bodyError describes why a request's body can not be decoded.
+type bodyError struct {
+	// status is 400, 413 or 415.
+	status int
+	// path is a JSON path of an offending field, or empty when a body is not valid as a whole.
+	path string
+	// message describes a problem.
+	message string
+	// cause is an error of a reader of a body, e.g. of a body which does not match its credentials.
+	cause error
+}
+
+func (e *bodyError) Error() string {
+	if len(e.path) > 0 {
+		return fmt.Sprintf("%s: %s", e.path, e.message)
+	}
+
+	return e.message
+}
+
+func (e *bodyError) Unwrap() error {
+	return e.cause
+}
+
+// writeBodyError sends a problem of a body with its status, or 400 for any other error. 401 is returned when
+// a body does not match its credentials.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		problem.Error(w, r, auth.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var bodyErr *bodyError
+	if errors.As(err, &bodyErr) && bodyErr.status != http.StatusBadRequest {
+		problem.Error(w, r, bodyErr.Error(), bodyErr.status)
+		return
+	}
+
+	writeInvalidRequest(w, r, err)
+}
+
+// writeInvalidRequest sends a problem of a request which is not valid with 400. The problem lists invalid
+// fields when an error names them.
+func writeInvalidRequest(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		validationErrs api.ValidationErrors
+		bodyErr        *bodyError
+	)
+	switch {
+	case errors.As(err, &validationErrs):
+		problem.Write(w, problem.Invalid(r, err.Error(), validationErrs...))
+	case errors.As(err, &bodyErr) && len(bodyErr.path) > 0:
+		problem.Write(w, problem.Invalid(r, err.Error(), api.FieldError{Field: bodyErr.path, Message: bodyErr.message}))
+	default:
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// decodeJSONBody decodes a JSON object from a request's body with a size limit. 415 is returned when
+// the body is not `application/json`.
+func decodeJSONBody(r *http.Request, options Options, v interface{}) error {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || contentType != jsonContentType {
+		return &bodyError{
+			status: http.StatusUnsupportedMediaType,
+			message: fmt.Sprintf("content type \"%s\" is not supported, use \"%s\"",
+				r.Header.Get("Content-Type"), jsonContentType),
+		}
+	}
+
+	maxBytes := options.MaxBodyBytes
+	if maxBytes <= 0 && options.StrictJSON {
+		maxBytes = DefaultMaxBodyBytes
+	}
+
+	body := r.Body
+	if maxBytes > 0 {
+		body = http.MaxBytesReader(nil, r.Body, maxBytes)
+	}
+
+	return decodeJSON(body, options.StrictJSON, v)
+}
+
+// decodeJSON decodes a single JSON object. Errors name a JSON path of an offending field. A strict body is
+// read whole, so a reader must limit its size.
+func decodeJSON(r io.Reader, strict bool, v interface{}) error {
+	var body []byte
+	if strict {
+		var err error
+		if body, err = io.ReadAll(r); err != nil {
+			return convertDecodeError(err)
+		}
+		r = bytes.NewReader(body)
+	}
+
+	decoder := json.NewDecoder(r)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		var (
+			syntaxErr *json.SyntaxError
+			typeErr   *json.UnmarshalTypeError
+		)
+		if strict && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+			// The decoder does not have a type of an error of an unknown field, so the field is found in the body.
+			if path, ok := unknownFieldPath(body, reflect.TypeOf(v)); ok {
+				return &bodyError{status: http.StatusBadRequest, path: path, message: "unknown field"}
+			}
+		}
+
+		return convertDecodeError(err)
+	}
+
+	// Only white spaces can follow an object.
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return convertDecodeError(err)
+		}
+
+		return &bodyError{status: http.StatusBadRequest, message: "body must contain a single JSON object"}
+	}
+
+	return nil
+}
+
+// convertDecodeError converts an error of a JSON decoder to an error of a body.
+func convertDecodeError(err error) *bodyError {
+	var (
+		maxBytesErr *http.MaxBytesError
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &bodyError{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("body is larger than %d bytes", maxBytesErr.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return &bodyError{status: http.StatusBadRequest, message: "body must be a JSON object"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &bodyError{status: http.StatusBadRequest, message: "body is not a complete JSON object"}
+	case errors.As(err, &syntaxErr):
+		return &bodyError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("malformed JSON at offset %d: %s", syntaxErr.Offset, syntaxErr.Error()),
+		}
+	case errors.As(err, &typeErr):
+		if len(typeErr.Field) == 0 {
+			return &bodyError{status: http.StatusBadRequest, message: "body must be a JSON object"}
+		}
+
+		return &bodyError{
+			status:  http.StatusBadRequest,
+			path:    jsonPath(typeErr.Field),
+			message: fmt.Sprintf("%s can not be decoded into %s", typeErr.Value, describeType(typeErr.Type.String())),
+		}
+	default:
+		return &bodyError{status: http.StatusBadRequest, message: err.Error(), cause: err}
+	}
+}
+
+// unknownFieldPath returns a JSON path of the first field of a body which is not a field of a type where it
+// is, e.g. `$.port.contry`. It returns false when a body does not have unknown fields or is not valid JSON.
+func unknownFieldPath(body []byte, t reflect.Type) (string, bool) {
+	return findUnknownField(body, t, "$")
+}
+
+// findUnknownField looks for an unknown field in a JSON value of a type. Objects and arrays are decoded only
+// one level at a time, so their members are checked against types of their fields.
+func findUnknownField(value json.RawMessage, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return "", false
+		}
+
+		// Keys are sorted, so the same field is found every time.
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			var fieldType reflect.Type
+			if t.Kind() == reflect.Map {
+				fieldType = t.Elem()
+			} else {
+				field, ok := structField(t, key)
+				if !ok {
+					return path + "." + key, true
+				}
+				fieldType = field.Type
+			}
+
+			if found, ok := findUnknownField(object[key], fieldType, path+"."+key); ok {
+				return found, true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(value, &items); err != nil {
+			return "", false
+		}
+
+		for i, item := range items {
+			if found, ok := findUnknownField(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); ok {
+				return found, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// structField returns a field of a struct which is decoded from a JSON key. Keys are matched without regard
+// to a case of letters, like the JSON decoder does.
+func structField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// jsonPath returns a JSON path of a field from a dotted path of the JSON decoder, whose indices of arrays
+// are written in brackets.
+func jsonPath(field string) string {
+	var path strings.Builder
+	path.WriteString("$")
+	for _, name := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(name); err == nil {
+			fmt.Fprintf(&path, "[%s]", name)
+		} else {
+			path.WriteString("." + name)
+		}
+	}
+
+	return path.String()
+}
+
+// describeType describes a Go type of a field in terms of JSON.
+func describeType(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return "an array of " + describeType(strings.TrimPrefix(goType, "[]")) + "s"
+	case goType == "string":
+		return "a string"
+	case strings.HasPrefix(goType, "float"), strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "a number"
+	case strings.HasPrefix(goType, "map["), strings.Contains(goType, "."):
+		return "an object"
+	default:
+		return goType
+	}
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// errPreconditionFailed is returned when a port does not match If-Match header.
+var errPreconditionFailed = errors.New("port has been changed, or it does not exist")
+
+// formatETag returns a strong entity tag for port's revision.
+func formatETag(revision uint64) string {
+	return `"` + strconv.FormatUint(revision, 10) + `"`
+}
+
+// entityTags describes a value of If-Match or If-None-Match header.
+type entityTags struct {
+	// any is true for `*` which matches any existing port.
+	any bool
+	// revisions are revisions of ports from strong entity tags.
+	revisions []uint64
+	// weakRevisions are revisions of ports from weak entity tags, e.g. `W/"1"`.
+	weakRevisions []uint64
+}
+
+// parseEntityTags parses a header with a list of entity tags.
+// False is returned when a header is not provided.
+// Tags which are not created by formatETag are skipped, because they never match any port.
+func parseEntityTags(header http.Header, name string) (entityTags, bool) {
+	values := header.Values(name)
+	if len(values) == 0 {
+		return entityTags{}, false
+	}
+
+	var tags entityTags
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				tags.any = true
+				continue
+			}
+
+			weak := strings.HasPrefix(tag, "W/")
+			tag = strings.TrimPrefix(tag, "W/")
+			if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+				continue
+			}
+
+			revision, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+			if err != nil {
+				continue
+			}
+
+			if weak {
+				tags.weakRevisions = append(tags.weakRevisions, revision)
+			} else {
+				tags.revisions = append(tags.revisions, revision)
+			}
+		}
+	}
+
+	return tags, true
+}
+
+// matchStrong checks whether a port's revision matches tags with the strong comparison, which is used by If-Match.
+func (t entityTags) matchStrong(revision uint64) bool {
+	return t.any || containsRevision(t.revisions, revision)
+}
+
+// matchWeak checks whether a port's revision matches tags with the weak comparison, which is used by If-None-Match.
+func (t entityTags) matchWeak(revision uint64) bool {
+	return t.matchStrong(revision) || containsRevision(t.weakRevisions, revision)
+}
+
+// checkIfMatch returns a function which fails modification of a port which does not match If-Match header.
+func (t entityTags) checkIfMatch(modify ports.ModifyFunc) ports.ModifyFunc {
+	return func(port ports.Port) (ports.Port, error) {
+		if !t.matchStrong(port.Revision) {
+			return ports.Port{}, errPreconditionFailed
+		}
+
+		return modify(port)
+	}
+}
+
+// containsRevision checks whether revisions contain a given revision.
+func containsRevision(revisions []uint64, revision uint64) bool {
+	for _, r := range revisions {
+		if r == revision {
+			return true
+		}
+	}
+
+	return false
+}
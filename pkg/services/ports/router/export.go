@@ -0,0 +1,364 @@
+package router
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/problem"
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// errNotAcceptable is returned when none of export formats is accepted by a client.
+var errNotAcceptable = errors.New("none of export formats is acceptable")
+
+// exportFormat describes a format of exported ports.
+type exportFormat struct {
+	// name is a value of `format` query parameter.
+	name string
+	// contentType is a media type of a response.
+	contentType string
+	// newEncoder creates an encoder which writes ports in this format.
+	newEncoder func(w io.Writer) portEncoder
+}
+
+// exportFormats are supported export formats. The first one is used when a client accepts any format.
+var exportFormats = []exportFormat{
+	{name: "json", contentType: "application/json", newEncoder: newJSONObjectEncoder},
+	{name: "ndjson", contentType: "application/x-ndjson", newEncoder: newNDJSONEncoder},
+	{name: "csv", contentType: "text/csv", newEncoder: newCSVEncoder},
+	{name: "geojson", contentType: "application/geo+json", newEncoder: newGeoJSONEncoder},
+}
+
+// portEncoder writes a stream of ports.
+type portEncoder interface {
+	// begin is called before the first port.
+	begin() error
+	// encode writes a single port.
+	encode(ID string, port api.Port) error
+	// end is called after the last port.
+	end() error
+}
+
+// ExportPorts is an HTTP handler which streams all ports.
+// A format is taken from `format` query parameter, or it is negotiated with Accept header.
+// Ports are fetched page by page, so a response is never kept in memory as a whole. An export is not a snapshot,
+// so a port which is changed during an export may be exported in any of its versions.
+func (pr *portRouter) ExportPorts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	format, err := negotiateExportFormat(r)
+	if err != nil {
+		if errors.Is(err, errNotAcceptable) {
+			problem.Error(w, r, err.Error(), http.StatusNotAcceptable)
+		} else {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		}
+
+		return
+	}
+
+	options := ports.ListOptions{Limit: ports.MaxListLimit}
+	list, err := pr.svc.List(r.Context(), options)
+	if err != nil {
+		pr.logger.ErrorContext(r.Context(), "failed to list ports", "error", err)
+		problem.Error(w, r, "failed to export ports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(http.StatusOK)
+
+	if err := exportPorts(r.Context(), pr.svc, list, format.newEncoder(w), w); err != nil {
+		// A status has been already sent, so a connection is broken, and a client does not get an incomplete export
+		// which looks like a complete one.
+		pr.logger.ErrorContext(r.Context(), "failed to export ports", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportPorts writes all ports starting from a given first page, and it flushes a response after every page.
+func exportPorts(
+	ctx context.Context, svc ports.PortService, list ports.PortList, encoder portEncoder, w http.ResponseWriter,
+) error {
+	if err := encoder.begin(); err != nil {
+		return err
+	}
+
+	options := ports.ListOptions{Limit: ports.MaxListLimit}
+	for {
+		for _, port := range list.Ports {
+			if err := encoder.encode(port.ID, ConvertToAPIPort(port.Port)); err != nil {
+				return err
+			}
+		}
+
+		if len(list.NextCursor) == 0 {
+			break
+		}
+
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		options.Cursor = list.NextCursor
+		var err error
+		if list, err = svc.List(ctx, options); err != nil {
+			return err
+		}
+	}
+
+	return encoder.end()
+}
+
+// negotiateExportFormat returns an export format from `format` query parameter or Accept header.
+// Media ranges in Accept header are taken in order of their quality.
+func negotiateExportFormat(r *http.Request) (exportFormat, error) {
+	if name := r.URL.Query().Get("format"); len(name) > 0 {
+		for _, format := range exportFormats {
+			if format.name == name {
+				return format, nil
+			}
+		}
+
+		return exportFormat{}, fmt.Errorf("export format \"%s\" is not supported", name)
+	}
+
+	accept := r.Header.Get("Accept")
+	if len(accept) == 0 {
+		return exportFormats[0], nil
+	}
+
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	var ranges []mediaRange
+	for _, value := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(value)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, accepted := range ranges {
+		for _, format := range exportFormats {
+			if matchMediaRange(accepted.mediaType, format.contentType) {
+				return format, nil
+			}
+		}
+	}
+
+	return exportFormat{}, errNotAcceptable
+}
+
+// matchMediaRange checks whether a media range from Accept header, e.g. `text/*`, matches a content type.
+func matchMediaRange(mediaRange, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+
+	return ok && strings.HasPrefix(contentType, prefix+"/")
+}
+
+// jsonObjectEncoder writes ports as a single JSON object keyed by port's IDs, the same as ports.ReadPorts reads.
+type jsonObjectEncoder struct {
+	w     io.Writer
+	empty bool
+}
+
+func newJSONObjectEncoder(w io.Writer) portEncoder {
+	return &jsonObjectEncoder{w: w, empty: true}
+}
+
+func (e *jsonObjectEncoder) begin() error {
+	_, err := io.WriteString(e.w, "{")
+
+	return err
+}
+
+func (e *jsonObjectEncoder) encode(ID string, port api.Port) error {
+	key, err := json.Marshal(ID)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(port)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n  "
+	if e.empty {
+		separator = "\n  "
+		e.empty = false
+	}
+
+	_, err = fmt.Fprintf(e.w, "%s%s: %s", separator, key, value)
+
+	return err
+}
+
+func (e *jsonObjectEncoder) end() error {
+	_, err := io.WriteString(e.w, "\n}\n")
+
+	return err
+}
+
+// ndjsonEncoder writes every port with its ID as a separate JSON line.
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) portEncoder {
+	return &ndjsonEncoder{encoder: json.NewEncoder(w)}
+}
+
+func (e *ndjsonEncoder) begin() error {
+	return nil
+}
+
+func (e *ndjsonEncoder) encode(ID string, port api.Port) error {
+	return e.encoder.Encode(api.PortWithID{ID: ID, Port: port})
+}
+
+func (e *ndjsonEncoder) end() error {
+	return nil
+}
+
+// csvSeparator separates values of lists in a single CSV field.
+const csvSeparator = ";"
+
+// csvHeader contains names of CSV columns.
+var csvHeader = []string{
+	"id", "name", "city", "province", "country", "code", "timezone", "longitude", "latitude", "alias", "regions", "unlocs",
+}
+
+// csvEncoder writes every port as a CSV record. Lists are joined by csvSeparator.
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) portEncoder {
+	return &csvEncoder{writer: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) begin() error {
+	return e.write(csvHeader)
+}
+
+func (e *csvEncoder) encode(ID string, port api.Port) error {
+	var longitude, latitude string
+	if len(port.Coordinates) == 2 {
+		longitude = strconv.FormatFloat(port.Coordinates[0], 'f', -1, 64)
+		latitude = strconv.FormatFloat(port.Coordinates[1], 'f', -1, 64)
+	}
+
+	return e.write([]string{
+		ID, port.Name, port.City, port.Province, port.Country, port.Code, port.Timezone, longitude, latitude,
+		strings.Join(port.Alias, csvSeparator),
+		strings.Join(port.Regions, csvSeparator),
+		strings.Join(port.Unlocs, csvSeparator),
+	})
+}
+
+func (e *csvEncoder) end() error {
+	return nil
+}
+
+// write writes a record, and it flushes it, so it is not buffered separately from a response.
+func (e *csvEncoder) write(record []string) error {
+	if err := e.writer.Write(record); err != nil {
+		return err
+	}
+	e.writer.Flush()
+
+	return e.writer.Error()
+}
+
+// geoJSONFeature is a port in a GeoJSON FeatureCollection (RFC 7946).
+type geoJSONFeature struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Geometry is null for a port without valid coordinates.
+	Geometry   *geoJSONPoint `json:"geometry"`
+	Properties api.Port      `json:"properties"`
+}
+
+// geoJSONPoint is a GeoJSON Point geometry.
+type geoJSONPoint struct {
+	Type string `json:"type"`
+	// Coordinates are in `[longitude, latitude]` order, the same as port's coordinates.
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// geoJSONEncoder writes ports as a GeoJSON FeatureCollection with a Point feature for every port.
+type geoJSONEncoder struct {
+	w     io.Writer
+	empty bool
+}
+
+func newGeoJSONEncoder(w io.Writer) portEncoder {
+	return &geoJSONEncoder{w: w, empty: true}
+}
+
+func (e *geoJSONEncoder) begin() error {
+	_, err := io.WriteString(e.w, `{"type":"FeatureCollection","features":[`)
+
+	return err
+}
+
+func (e *geoJSONEncoder) encode(ID string, port api.Port) error {
+	feature := geoJSONFeature{Type: "Feature", ID: ID}
+	if location, ok := ports.PortLocation(convertFromAPIPort(port)); ok {
+		feature.Geometry = &geoJSONPoint{Type: "Point", Coordinates: []float64{location.Lon, location.Lat}}
+	}
+	// Coordinates are already in a geometry.
+	port.Coordinates = nil
+	feature.Properties = port
+
+	b, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if e.empty {
+		separator = "\n"
+		e.empty = false
+	}
+
+	_, err = fmt.Fprintf(e.w, "%s%s", separator, b)
+
+	return err
+}
+
+func (e *geoJSONEncoder) end() error {
+	_, err := io.WriteString(e.w, "\n]}\n")
+
+	return err
+}
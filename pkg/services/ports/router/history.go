@@ -0,0 +1,256 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/problem"
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// maxRevertAttempts is the most number of times a deleted port is created again by a revert, when other requests
+// create and delete it in the meantime.
+const maxRevertAttempts = 3
+
+// PortHistory is an HTTP handler which returns a page of changes of a single port, from the oldest one.
+// Changes of a deleted port are still returned.
+func (pr *portRouter) PortHistory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
+
+	pr.writeEvents(w, r, id)
+}
+
+// AuditLog is an HTTP handler which returns a page of changes of all ports, from the oldest one.
+func (pr *portRouter) AuditLog(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	pr.writeEvents(w, r, "")
+}
+
+// writeEvents sends a page of events of a port, or of all ports when ID is empty.
+// A page is selected by `cursor` and `limit` query parameters.
+func (pr *portRouter) writeEvents(w http.ResponseWriter, r *http.Request, ID string) {
+	historySvc, ok := pr.svc.(ports.HistoryService)
+	if !ok {
+		problem.Error(w, r, "port's service does not record history", http.StatusNotImplemented)
+		return
+	}
+
+	options := ports.EventListOptions{
+		PortID: ID,
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	if limit := r.URL.Query().Get("limit"); len(limit) > 0 {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 || l > ports.MaxListLimit {
+			problem.Error(w, r, fmt.Sprintf("limit must be a number between 1 and %d", ports.MaxListLimit),
+				http.StatusBadRequest)
+			return
+		}
+		options.Limit = l
+	}
+
+	list, err := historySvc.Events(r.Context(), options)
+	if err != nil {
+		if errors.Is(err, ports.ErrInvalidCursor) {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pr.logger.ErrorContext(r.Context(), "failed to list audit events", "error", err)
+		problem.Error(w, r, "failed to list audit events", http.StatusInternalServerError)
+		return
+	}
+
+	apiList := api.AuditEventList{
+		Events:     make([]api.AuditEvent, 0, len(list.Events)),
+		NextCursor: list.NextCursor,
+	}
+	for _, event := range list.Events {
+		apiList.Events = append(apiList.Events, convertToAPIEvent(event))
+	}
+
+	b, err := json.Marshal(apiList)
+	if err != nil {
+		pr.logger.ErrorContext(r.Context(), "failed to marshal audit events", "error", err)
+		problem.Error(w, r, "failed to serialize audit events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		pr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// convertToAPIEvent converts internal event structure to client api structure.
+func convertToAPIEvent(event ports.Event) api.AuditEvent {
+	apiEvent := api.AuditEvent{
+		Sequence: event.Sequence,
+		PortID:   event.PortID,
+		Action:   string(event.Action),
+		Actor:    event.Actor,
+		Time:     event.Time,
+		Changes:  []api.AuditChange{},
+	}
+
+	if event.Before != nil {
+		before := ConvertToAPIPort(*event.Before)
+		apiEvent.Before = &before
+	}
+	if event.After != nil {
+		after := ConvertToAPIPort(*event.After)
+		apiEvent.After = &after
+	}
+	for _, change := range event.Changes() {
+		apiEvent.Changes = append(apiEvent.Changes, api.AuditChange{
+			Field:  change.Field,
+			Before: change.Before,
+			After:  change.After,
+		})
+	}
+
+	return apiEvent
+}
+
+// getPreviousPort sends a port with a revision from `revision` query parameter, or a port as it has been at time
+// from `asOf` query parameter in RFC 3339 format.
+func (pr *portRouter) getPreviousPort(w http.ResponseWriter, r *http.Request, ID string) {
+	historySvc, ok := pr.svc.(ports.HistoryService)
+	if !ok {
+		problem.Error(w, r, "port's service does not record history", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("revision") && query.Has("asOf") {
+		problem.Error(w, r, "only one of revision and asOf can be provided", http.StatusBadRequest)
+		return
+	}
+
+	var port ports.Port
+	var err error
+	if query.Has("revision") {
+		revision, parseErr := strconv.ParseUint(query.Get("revision"), 10, 64)
+		if parseErr != nil || revision == 0 {
+			problem.Error(w, r, "revision must be a positive number", http.StatusBadRequest)
+			return
+		}
+		port, err = ports.PortAtRevision(r.Context(), historySvc, ID, revision)
+	} else {
+		at, parseErr := time.Parse(time.RFC3339, query.Get("asOf"))
+		if parseErr != nil {
+			problem.Error(w, r, "asOf must be time in RFC 3339 format", http.StatusBadRequest)
+			return
+		}
+		port, err = ports.PortAsOf(r.Context(), historySvc, ID, at)
+	}
+
+	if err != nil {
+		if errors.Is(err, ports.ErrRevisionNotFound) || errors.Is(err, ports.ErrPortNotFound) {
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
+			return
+		} else if errors.Is(err, ports.ErrHistoryIncomplete) {
+			problem.Error(w, r, err.Error(), http.StatusConflict)
+			return
+		}
+
+		pr.logger.ErrorContext(r.Context(), "failed to get previous port", "error", err)
+		problem.Error(w, r, "failed to get previous port", http.StatusInternalServerError)
+		return
+	}
+
+	pr.writePort(w, r, http.StatusOK, port)
+}
+
+// RevertPort is an HTTP handler which restores a previous revision of a port as its new revision.
+// A deleted port is created again. If-Match header is checked against the current port. 409 is returned when
+// the previous revision may be missing in the history, or when other requests keep creating and deleting the port.
+// 422 is returned when the previous revision is not valid according to current rules of ports.
+func (pr *portRouter) RevertPort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
+
+	historySvc, ok := pr.svc.(ports.HistoryService)
+	if !ok {
+		problem.Error(w, r, "port's service does not record history", http.StatusNotImplemented)
+		return
+	}
+
+	var request api.RevertRequest
+	if err := decodeJSONBody(r, pr.options, &request); err != nil {
+		writeBodyError(w, r, err)
+		return
+	} else if request.Revision == 0 {
+		problem.Error(w, r, "revision of a port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	previous, err := ports.PortAtRevision(r.Context(), historySvc, id, request.Revision)
+	if err != nil {
+		if errors.Is(err, ports.ErrRevisionNotFound) {
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
+			return
+		} else if errors.Is(err, ports.ErrHistoryIncomplete) {
+			problem.Error(w, r, err.Error(), http.StatusConflict)
+			return
+		}
+
+		pr.logger.ErrorContext(r.Context(), "failed to get previous port", "error", err)
+		problem.Error(w, r, "failed to get previous port", http.StatusInternalServerError)
+		return
+	}
+
+	// A previous port may have been stored before rules of ports have been tightened, so it is checked again.
+	previous = NormalizePort(previous)
+	if err := ValidatePort(ports.PortWithID{ID: id, Port: previous}); err != nil {
+		problem.Error(w, r, fmt.Sprintf("revision %d of a port is not valid any more: %s", request.Revision, err),
+			http.StatusUnprocessableEntity)
+		return
+	}
+
+	modify := func(ports.Port) (ports.Port, error) {
+		return previous, nil
+	}
+	ifMatch, conditional := parseEntityTags(r.Header, "If-Match")
+	if conditional {
+		modify = ifMatch.checkIfMatch(modify)
+	}
+
+	// A modification and a creation are separate, so a port can be created or deleted by another request between
+	// them. Then the other one is tried again, a few times at most.
+	status := http.StatusOK
+	port, err := pr.svc.Modify(r.Context(), id, modify)
+	for attempt := 1; errors.Is(err, ports.ErrPortNotFound) && !conditional && attempt <= maxRevertAttempts; attempt++ {
+		status = http.StatusCreated
+		port, err = ports.CreateReturning(r.Context(), pr.svc, id, previous)
+		if errors.Is(err, ports.ErrPortAlreadyExist) {
+			status = http.StatusOK
+			port, err = pr.svc.Modify(r.Context(), id, modify)
+		}
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errPreconditionFailed), conditional && errors.Is(err, ports.ErrPortNotFound):
+			problem.Error(w, r, errPreconditionFailed.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, ports.ErrPortAlreadyExist), errors.Is(err, ports.ErrPortNotFound):
+			problem.Error(w, r, "port has been changed concurrently, try again", http.StatusConflict)
+		default:
+			pr.logger.ErrorContext(r.Context(), "failed to revert a port", "error", err)
+			problem.Error(w, r, "failed to revert a port", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	pr.writePort(w, r, status, port)
+}
@@ -5,191 +5,687 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 
 	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/metrics"
+	"github.com/informalict/ports/pkg/problem"
 	"github.com/informalict/ports/pkg/services/ports"
 )
 
 const (
 	apiV1Prefix = "/api/v1/"
+	// defaultNearestPorts is a number of nearest ports when a caller does not provide it.
+	defaultNearestPorts = 10
 )
 
 // portRouter describes HTTP router for a port service.
 type portRouter struct {
-	svc ports.PortService
+	svc     ports.PortService
+	options Options
+	logger  *slog.Logger
 }
 
 // NewPortRouter returns a new port's router for a given port service.
-func NewPortRouter(svc ports.PortService) http.Handler {
+// Errors are logged with a request's context, so they carry request's details added by logging.Middleware.
+func NewPortRouter(svc ports.PortService, options Options, logger *slog.Logger) http.Handler {
 	pr := &portRouter{
-		svc,
+		svc:     svc,
+		options: options,
+		logger:  logger,
 	}
 
-	router := httprouter.New()
-	router.GET(apiV1Prefix+"ports/:id", pr.GetPort)
-	router.POST(apiV1Prefix+"ports/:id", pr.CreatePort)
-	router.PUT(apiV1Prefix+"ports/:id", pr.UpdatePort)
-
-	return router
+	router := newRouter()
+	// A port with empty ID does not exist, so it must not be redirected to a list of ports.
+	router.RedirectTrailingSlash = false
+	handle(router, http.MethodGet, apiV1Prefix+"ports", pr.ListPorts)
+	// Static paths can not be registered next to `:id` in httprouter, so they are dispatched by port's ID.
+	handle(router, http.MethodGet, apiV1Prefix+"ports/:id", dispatchReservedID(map[string]httprouter.Handle{
+		nearestID: pr.NearestPorts,
+		withinID:  pr.PortsWithin,
+	}, pr.GetPort))
+	handle(router, http.MethodPost, apiV1Prefix+"ports/:id", pr.CreatePort)
+	handle(router, http.MethodPut, apiV1Prefix+"ports/:id", pr.UpdatePort)
+	handle(router, http.MethodPatch, apiV1Prefix+"ports/:id", pr.PatchPort)
+	handle(router, http.MethodDelete, apiV1Prefix+"ports/:id", pr.DeletePort)
+	handle(router, http.MethodGet, apiV1Prefix+"ports/:id/history", pr.PortHistory)
+	handle(router, http.MethodPost, apiV1Prefix+"ports/:id/revert", pr.RevertPort)
+	handle(router, http.MethodGet, apiV1Prefix+"audit", pr.AuditLog)
+
+	// Custom methods of the ports collection can not be registered in httprouter, because `:` starts a parameter.
+	return &actionRouter{
+		actions: map[string]map[string]httprouter.Handle{
+			apiV1Prefix + "ports:import": {http.MethodPost: pr.ImportPorts},
+			apiV1Prefix + "ports:export": {http.MethodGet: pr.ExportPorts},
+			apiV1Prefix + "ports:watch":  {http.MethodGet: pr.WatchPorts},
+		},
+		next: router,
+	}
 }
 
-// UpdatePort updates a port in a storage.
+// UpdatePort updates a port in a storage, and it responds with 204.
+// 412 is returned when If-Match header is provided, and it does not match port's ETag.
 func (pr *portRouter) UpdatePort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
 	if len(id) == 0 {
-		http.Error(w, "id of a port must be provided", http.StatusBadRequest)
+		problem.Error(w, r, "id of a port must be provided", http.StatusBadRequest)
 		return
 	}
 
-	apiPort, err := ParseRequestPort(r.Body)
-	if err != nil {
-		// It should be error log level.
-		log.Println(fmt.Sprintf("failed to parse input port's data: %s\n", err))
-		http.Error(w, "failed to parse input port's data", http.StatusInternalServerError)
+	var apiPort api.Port
+	if err := decodeJSONBody(r, pr.options, &apiPort); err != nil {
+		pr.logger.DebugContext(r.Context(), "failed to parse input port's data", "error", err)
+		writeBodyError(w, r, err)
 		return
 	}
 
+	apiPort = apiPort.Normalize()
 	if err := apiPort.Validate(); err != nil {
-		// It should be error log level.
-		log.Println(fmt.Sprintf("failed to validate input port's data: %s\n", err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		pr.logger.DebugContext(r.Context(), "failed to validate input port's data", "error", err)
+		writeInvalidRequest(w, r, err)
 		return
 	}
 
 	port := convertFromAPIPort(apiPort)
-	if err := pr.svc.Update(r.Context(), id, port); err != nil {
+	if err := pr.update(r, id, port); err != nil {
 		if errors.Is(err, ports.ErrPortNotFound) {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
+		} else if errors.Is(err, errPreconditionFailed) {
+			problem.Error(w, r, err.Error(), http.StatusPreconditionFailed)
 		} else {
-			// It should be error log level.
-			log.Println(fmt.Sprintf("failed to update a port: %s\n", err))
-			http.Error(w, "failed to update a port", http.StatusInternalServerError)
+			pr.logger.ErrorContext(r.Context(), "failed to update a port", "error", err)
+			problem.Error(w, r, "failed to update a port", http.StatusInternalServerError)
 		}
 
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// CreatePort creates a new port in a storage.
-func (pr *portRouter) CreatePort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+// update updates a port in a storage.
+// When If-Match header is provided, then a port is updated only when its current ETag matches the header.
+func (pr *portRouter) update(r *http.Request, ID string, port ports.Port) error {
+	ifMatch, ok := parseEntityTags(r.Header, "If-Match")
+	if !ok {
+		return pr.svc.Update(r.Context(), ID, port)
+	}
+
+	var err error
+	if !ifMatch.any && len(ifMatch.revisions) == 1 {
+		err = pr.svc.UpdateIfRevision(r.Context(), ID, ifMatch.revisions[0], port)
+	} else {
+		_, err = pr.svc.Modify(r.Context(), ID, ifMatch.checkIfMatch(func(ports.Port) (ports.Port, error) {
+			return port, nil
+		}))
+	}
+
+	// A port which does not exist does not match If-Match header either.
+	if errors.Is(err, ports.ErrPortNotFound) || errors.Is(err, ports.ErrRevisionMismatch) {
+		return errPreconditionFailed
+	}
+
+	return err
+}
+
+// PatchPort applies a partial update to a port in a storage.
+// A body is a JSON Merge Patch (RFC 7396) for `application/merge-patch+json` content type,
+// or a JSON Patch (RFC 6902) for `application/json-patch+json` content type.
+// A patch is applied and validated atomically, so concurrent patches do not overwrite each other.
+func (pr *portRouter) PatchPort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
 	if len(id) == 0 {
-		http.Error(w, "id of a port must be provided", http.StatusBadRequest)
+		problem.Error(w, r, "id of a port must be provided", http.StatusBadRequest)
 		return
 	}
 
-	apiPort, err := ParseRequestPort(r.Body)
+	patch, err := parsePatch(r, pr.options.MaxBodyBytes)
 	if err != nil {
-		// It should be error log level.
-		log.Println(fmt.Sprintf("failed to parse input port's data: %s\n", err))
-		http.Error(w, "failed to parse input port's data", http.StatusBadRequest)
+		var (
+			unsupported unsupportedMediaTypeError
+			tooLarge    *http.MaxBytesError
+		)
+		if errors.As(err, &unsupported) {
+			problem.Error(w, r, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if errors.As(err, &tooLarge) {
+			writeBodyError(w, r, convertDecodeError(err))
+			return
+		}
+
+		pr.logger.DebugContext(r.Context(), "failed to parse port's patch", "error", err)
+		problem.Error(w, r, "failed to parse port's patch", http.StatusBadRequest)
 		return
 	}
 
+	modify := func(port ports.Port) (ports.Port, error) {
+		return applyPatch(port, patch, pr.options.StrictJSON)
+	}
+	ifMatch, conditional := parseEntityTags(r.Header, "If-Match")
+	if conditional {
+		modify = ifMatch.checkIfMatch(modify)
+	}
+
+	port, err := pr.svc.Modify(r.Context(), id, modify)
+	if err != nil {
+		var invalid invalidPatchError
+		switch {
+		case errors.Is(err, errPreconditionFailed), conditional && errors.Is(err, ports.ErrPortNotFound):
+			problem.Error(w, r, errPreconditionFailed.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, ports.ErrPortNotFound):
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
+		case errors.As(err, &invalid) && invalid.conflict:
+			problem.Error(w, r, err.Error(), http.StatusConflict)
+		case errors.As(err, &invalid):
+			writeInvalidRequest(w, r, err)
+		default:
+			pr.logger.ErrorContext(r.Context(), "failed to patch a port", "error", err)
+			problem.Error(w, r, "failed to patch a port", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	pr.writePort(w, r, http.StatusOK, port)
+}
+
+// CreatePort creates a new port in a storage, and it responds with 201 and a path of the port in Location header.
+func (pr *portRouter) CreatePort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
+	if len(id) == 0 {
+		problem.Error(w, r, "id of a port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := reservedIDs[id]; ok {
+		problem.Error(w, r, fmt.Sprintf("id \"%s\" of a port is reserved", id), http.StatusBadRequest)
+		return
+	}
+
+	var apiPort api.Port
+	if err := decodeJSONBody(r, pr.options, &apiPort); err != nil {
+		pr.logger.DebugContext(r.Context(), "failed to parse input port's data", "error", err)
+		writeBodyError(w, r, err)
+		return
+	}
+
+	apiPort = apiPort.Normalize()
 	if err := apiPort.Validate(); err != nil {
-		// It should be error log level.
-		log.Println(fmt.Sprintf("failed to validate input port's data: %s\n", err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		pr.logger.DebugContext(r.Context(), "failed to validate input port's data", "error", err)
+		writeInvalidRequest(w, r, err)
 		return
 	}
 
 	port := convertFromAPIPort(apiPort)
 	if err := pr.svc.Create(r.Context(), id, port); err != nil {
 		if errors.Is(err, ports.ErrPortAlreadyExist) {
-			http.Error(w, err.Error(), http.StatusConflict)
+			problem.Error(w, r, err.Error(), http.StatusConflict)
 		} else {
-			// It should be error log level.
-			log.Println(fmt.Sprintf("failed to create a new port: %s\n", err))
-			http.Error(w, "failed to create a new port", http.StatusInternalServerError)
+			pr.logger.ErrorContext(r.Context(), "failed to create a new port", "error", err)
+			problem.Error(w, r, "failed to create a new port", http.StatusInternalServerError)
 		}
 
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", r.URL.Path)
 	w.WriteHeader(http.StatusCreated)
+}
+
+// DeletePort deletes a port from a storage.
+func (pr *portRouter) DeletePort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
+	if len(id) == 0 {
+		problem.Error(w, r, "id of a port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	if err := pr.svc.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, ports.ErrPortNotFound) {
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
+		} else {
+			pr.logger.ErrorContext(r.Context(), "failed to delete a port", "error", err)
+			problem.Error(w, r, "failed to delete a port", http.StatusInternalServerError)
+		}
 
-	return
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetPort is an HTTP handler which fetches port from a port's service.
+// Port's revision is returned as ETag header, and 304 is returned when it matches If-None-Match header.
+// A previous state of a port is returned for `revision` or `asOf` query parameter.
 func (pr *portRouter) GetPort(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	id := p.ByName("id")
+	logging.SetPortID(r.Context(), id)
 	if len(id) == 0 {
-		http.Error(w, "id of a port must be provided", http.StatusBadRequest)
+		problem.Error(w, r, "id of a port must be provided", http.StatusBadRequest)
+		return
+	}
+
+	if query := r.URL.Query(); query.Has("revision") || query.Has("asOf") {
+		pr.getPreviousPort(w, r, id)
 		return
 	}
 
 	port, err := pr.svc.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, ports.ErrPortNotFound) {
-			// No logs or it can be debug log level.
-			http.Error(w, err.Error(), http.StatusNotFound)
+			pr.logger.DebugContext(r.Context(), "port is not found")
+			problem.Error(w, r, err.Error(), http.StatusNotFound)
 			return
 		}
 
-		// It should be error log level.
-		log.Println(fmt.Sprintf("failed to get port: %s\n", err))
-		http.Error(w, "failed to get port", http.StatusInternalServerError)
+		pr.logger.ErrorContext(r.Context(), "failed to get port", "error", err)
+		problem.Error(w, r, "failed to get port", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(port.Revision))
+	if ifNoneMatch, ok := parseEntityTags(r.Header, "If-None-Match"); ok && ifNoneMatch.matchWeak(port.Revision) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	pr.writePort(w, r, http.StatusOK, port)
+}
+
+// writePort sends a port with its revision as ETag header.
+func (pr *portRouter) writePort(w http.ResponseWriter, r *http.Request, status int, port ports.Port) {
 	b, err := json.Marshal(ConvertToAPIPort(port))
 	if err != nil {
-		// It should be error log level.
-		log.Println(fmt.Sprintf("failed to marhal port: %s", err))
-		http.Error(w, "failed to serialize a port", http.StatusInternalServerError)
+		pr.logger.ErrorContext(r.Context(), "failed to marshal port", "error", err)
+		problem.Error(w, r, "failed to serialize a port", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(port.Revision))
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		pr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// ListPorts is an HTTP handler which returns a page of ports.
+// Ports are filtered by query parameters `country`, `province`, `city`, `name` (prefix) and `nameContains`.
+// Query parameter `sort` is a sort field, and `-` prefix reverses order, e.g. `sort=-name`.
+// A next page is returned for `cursor` query parameter which is taken from a previous page.
+func (pr *portRouter) ListPorts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	options, err := parseListOptions(r)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := pr.svc.List(r.Context(), options)
+	if err != nil {
+		if errors.Is(err, ports.ErrInvalidCursor) || errors.Is(err, ports.ErrInvalidSortField) {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pr.logger.ErrorContext(r.Context(), "failed to list ports", "error", err)
+		problem.Error(w, r, "failed to list ports", http.StatusInternalServerError)
+		return
+	}
+
+	apiList := api.PortList{
+		Ports:      make([]api.PortWithID, 0, len(list.Ports)),
+		NextCursor: list.NextCursor,
+	}
+	for _, port := range list.Ports {
+		apiList.Ports = append(apiList.Ports, api.PortWithID{ID: port.ID, Port: ConvertToAPIPort(port.Port)})
+	}
+
+	b, err := json.Marshal(apiList)
+	if err != nil {
+		pr.logger.ErrorContext(r.Context(), "failed to marshal ports", "error", err)
+		problem.Error(w, r, "failed to serialize ports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		pr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// parseListOptions parses list's options from query parameters.
+func parseListOptions(r *http.Request) (ports.ListOptions, error) {
+	query := r.URL.Query()
+	options := ports.ListOptions{
+		Filter: ports.ListFilter{
+			Country:      query.Get("country"),
+			Province:     query.Get("province"),
+			City:         query.Get("city"),
+			NamePrefix:   query.Get("name"),
+			NameContains: query.Get("nameContains"),
+		},
+		Cursor: query.Get("cursor"),
+	}
+
+	if sort := query.Get("sort"); len(sort) > 0 {
+		options.Descending = strings.HasPrefix(sort, "-")
+		options.SortBy = ports.SortField(strings.TrimPrefix(sort, "-"))
+		if !options.SortBy.Valid() {
+			return options, fmt.Errorf("sort field \"%s\" is not supported", options.SortBy)
+		}
+	}
+
+	if limit := query.Get("limit"); len(limit) > 0 {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 || l > ports.MaxListLimit {
+			return options, fmt.Errorf("limit must be a number between 1 and %d", ports.MaxListLimit)
+		}
+		options.Limit = l
+	}
+
+	return options, nil
+}
+
+const (
+	// nearestID is a path of nearest ports search.
+	nearestID = "nearest"
+	// withinID is a path of ports search within an area.
+	withinID = "within"
+)
+
+// reservedIDs are IDs which are used by static paths next to `ports/:id`, so such ports can not be created.
+var reservedIDs = map[string]struct{}{
+	nearestID: {},
+	withinID:  {},
+}
+
+// newRouter returns a router which sends problems for paths and methods which are not routed.
+func newRouter() *httprouter.Router {
+	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, fmt.Sprintf("path %s is not found", r.URL.Path), http.StatusNotFound)
+	})
+	// Allow header is set by the router.
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+	})
+
+	return router
+}
+
+// handle registers a handler in a router, and it names a route of every request in metrics by the handler's path.
+func handle(router *httprouter.Router, method, path string, handler httprouter.Handle) {
+	router.Handle(method, path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.SetRoute(r.Context(), path)
+		handler(w, r, p)
+	})
+}
+
+// dispatchReservedID calls a handler for a reserved ID, and otherwise it calls a default handler.
+func dispatchReservedID(handlers map[string]httprouter.Handle, defaultHandler httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if handler, ok := handlers[p.ByName("id")]; ok {
+			// Reserved IDs are static paths, so they are routes on their own.
+			metrics.SetRoute(r.Context(), r.URL.Path)
+			handler(w, r, p)
+			return
+		}
+
+		defaultHandler(w, r, p)
+	}
+}
+
+// actionRouter dispatches custom methods of collections, e.g. `ports:import`, and other requests to a next handler.
+type actionRouter struct {
+	// actions contains handlers by a path and an HTTP method.
+	actions map[string]map[string]httprouter.Handle
+	next    http.Handler
+}
+
+// ServeHTTP calls a handler of a custom method for a path, and otherwise it calls a next handler.
+func (a *actionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handlers, ok := a.actions[r.URL.Path]
+	if !ok {
+		a.next.ServeHTTP(w, r)
+		return
+	}
+	metrics.SetRoute(r.Context(), r.URL.Path)
+
+	handler, ok := handlers[r.Method]
+	if !ok {
+		allowed := make([]string, 0, len(handlers))
+		for method := range handlers {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		problem.Error(w, r, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	handler(w, r, nil)
+}
+
+// NearestPorts is an HTTP handler which returns `k` ports which are the nearest to `lat` and `lon` query parameters.
+func (pr *portRouter) NearestPorts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	geoSvc, ok := pr.svc.(ports.GeoService)
+	if !ok {
+		problem.Error(w, r, "port's service does not support searching by coordinates", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	point, err := parsePoint(query.Get("lat"), query.Get("lon"))
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	k := defaultNearestPorts
+	if value := query.Get("k"); len(value) > 0 {
+		if k, err = strconv.Atoi(value); err != nil || k <= 0 || k > ports.MaxListLimit {
+			problem.Error(w, r, fmt.Sprintf("k must be a number between 1 and %d", ports.MaxListLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	found, err := geoSvc.Nearest(r.Context(), point, k)
+	pr.writeNearbyPorts(w, r, found, err)
+}
+
+// PortsWithin is an HTTP handler which returns ports within an area sorted by distance.
+// The area is a circle when `lat`, `lon` and `radius` (km) query parameters are provided,
+// or it is a bounding box `bbox=minLon,minLat,maxLon,maxLat`. Distance is measured from `lat` and `lon`
+// or from the center of a bounding box.
+func (pr *portRouter) PortsWithin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	geoSvc, ok := pr.svc.(ports.GeoService)
+	if !ok {
+		problem.Error(w, r, "port's service does not support searching by coordinates", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	if bbox := query.Get("bbox"); len(bbox) > 0 {
+		box, err := parseBoundingBox(bbox)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from := boundingBoxCenter(box)
+		if query.Has("lat") || query.Has("lon") {
+			if from, err = parsePoint(query.Get("lat"), query.Get("lon")); err != nil {
+				problem.Error(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		found, err := geoSvc.WithinBoundingBox(r.Context(), box, from)
+		pr.writeNearbyPorts(w, r, found, err)
+		return
+	}
+
+	point, err := parsePoint(query.Get("lat"), query.Get("lon"))
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	radius, err := strconv.ParseFloat(query.Get("radius"), 64)
+	if err != nil || radius <= 0 || math.IsInf(radius, 0) {
+		problem.Error(w, r, "radius must be a positive number of kilometers", http.StatusBadRequest)
+		return
+	}
+
+	found, err := geoSvc.WithinRadius(r.Context(), point, radius)
+	pr.writeNearbyPorts(w, r, found, err)
+}
+
+// writeNearbyPorts sends ports found by coordinates.
+func (pr *portRouter) writeNearbyPorts(w http.ResponseWriter, r *http.Request, found []ports.PortWithDistance, err error) {
+	if err != nil {
+		if errors.Is(err, ports.ErrInvalidCoordinates) {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pr.logger.ErrorContext(r.Context(), "failed to search ports", "error", err)
+		problem.Error(w, r, "failed to search ports", http.StatusInternalServerError)
+		return
+	}
+
+	nearby := api.NearbyPorts{
+		Ports: make([]api.PortWithDistance, 0, len(found)),
+	}
+	for _, port := range found {
+		nearby.Ports = append(nearby.Ports, api.PortWithDistance{
+			PortWithID: api.PortWithID{ID: port.ID, Port: ConvertToAPIPort(port.Port)},
+			Distance:   port.Distance,
+		})
+	}
+
+	b, err := json.Marshal(nearby)
+	if err != nil {
+		pr.logger.ErrorContext(r.Context(), "failed to marshal ports", "error", err)
+		problem.Error(w, r, "failed to serialize ports", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write(b); err != nil {
-		log.Println(err)
+		pr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
 	}
 }
 
+// parsePoint parses latitude and longitude in degrees.
+func parsePoint(lat, lon string) (ports.Point, error) {
+	var point ports.Point
+	var err error
+
+	if point.Lat, err = strconv.ParseFloat(lat, 64); err != nil {
+		return point, errors.New("lat must be a number between -90 and 90")
+	}
+
+	if point.Lon, err = strconv.ParseFloat(lon, 64); err != nil {
+		return point, errors.New("lon must be a number between -180 and 180")
+	}
+
+	if !point.Valid() {
+		return point, ports.ErrInvalidCoordinates
+	}
+
+	return point, nil
+}
+
+// parseBoundingBox parses a bounding box in `minLon,minLat,maxLon,maxLat` format, the same as in GeoJSON.
+func parseBoundingBox(bbox string) (ports.BoundingBox, error) {
+	var box ports.BoundingBox
+
+	values := strings.Split(bbox, ",")
+	if len(values) != 4 {
+		return box, errors.New("bbox must be in format minLon,minLat,maxLon,maxLat")
+	}
+
+	for i, value := range []*float64{&box.MinLon, &box.MinLat, &box.MaxLon, &box.MaxLat} {
+		var err error
+		if *value, err = strconv.ParseFloat(values[i], 64); err != nil {
+			return box, errors.New("bbox must be in format minLon,minLat,maxLon,maxLat")
+		}
+	}
+
+	if !box.Valid() {
+		return box, ports.ErrInvalidCoordinates
+	}
+
+	return box, nil
+}
+
+// boundingBoxCenter returns a center of a bounding box, which can cross the antimeridian.
+func boundingBoxCenter(box ports.BoundingBox) ports.Point {
+	maxLon := box.MaxLon
+	if box.MinLon > box.MaxLon {
+		maxLon += 360
+	}
+
+	center := ports.Point{Lat: (box.MinLat + box.MaxLat) / 2, Lon: (box.MinLon + maxLon) / 2}
+	if center.Lon > 180 {
+		center.Lon -= 360
+	}
+
+	return center
+}
+
 // ConvertToAPIPort converts internal port structure to client api structure.
 func ConvertToAPIPort(port ports.Port) api.Port {
 	return api.Port{
+		Alias:       port.Alias,
 		City:        port.City,
+		Code:        port.Code,
 		Coordinates: port.Coordinates,
 		Country:     port.Country,
 		Name:        port.Name,
 		Province:    port.Province,
+		Regions:     port.Regions,
+		Timezone:    port.Timezone,
+		Unlocs:      port.Unlocs,
 	}
 }
 
 // convertFromAPIPort converts client API port into internal API port.
 func convertFromAPIPort(port api.Port) ports.Port {
 	return ports.Port{
+		Alias:       port.Alias,
 		City:        port.City,
+		Code:        port.Code,
 		Coordinates: port.Coordinates,
 		Country:     port.Country,
 		Name:        port.Name,
 		Province:    port.Province,
+		Regions:     port.Regions,
+		Timezone:    port.Timezone,
+		Unlocs:      port.Unlocs,
 	}
 }
 
-// ParseRequestPort validates port from a caller.
+// ParseRequestPort parses a port from a caller. Unknown fields are rejected, and an error names a JSON path
+// of an offending field. A port is not read beyond DefaultMaxBodyBytes.
 func ParseRequestPort(r io.Reader) (api.Port, error) {
 	var apiPort api.Port
+	err := decodeJSON(http.MaxBytesReader(nil, io.NopCloser(r), DefaultMaxBodyBytes), true, &apiPort)
 
-	body, err := io.ReadAll(r)
-	if err != nil {
-		return apiPort, err
-	}
-
-	if err := json.Unmarshal(body, &apiPort); err != nil {
-		return apiPort, err
-	}
-
-	return apiPort, nil
+	return apiPort, err
 }
@@ -1,20 +1,32 @@
 package router
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/ratelimit"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/audit"
 	"github.com/informalict/ports/pkg/services/ports/memory"
+	"github.com/informalict/ports/pkg/services/ports/webhook"
 )
 
 var apiPorts = "/api/v1/ports"
@@ -23,10 +35,29 @@ func getEndpoint(server *httptest.Server, portID string) string {
 	return server.URL + apiPorts + "/" + portID
 }
 
+// readProblem returns a problem from a response.
+func readProblem(t *testing.T, resp *http.Response) api.Problem {
+	require.Equal(t, api.ProblemContentType, resp.Header.Get("Content-Type"))
+
+	var p api.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+	require.Equal(t, resp.StatusCode, p.Status)
+
+	return p
+}
+
+// readPort decodes a port from a response.
+func readPort(t *testing.T, resp *http.Response) api.Port {
+	var port api.Port
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&port))
+
+	return port
+}
+
 // TestGetPort tests for getting port.
 func TestGetPort(t *testing.T) {
 	stub := memory.NewPortMemory()
-	router := NewPortRouter(stub)
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -53,7 +84,7 @@ func TestGetPort(t *testing.T) {
 		validPort := api.Port{
 			Name:        "name",
 			City:        "city",
-			Country:     "country",
+			Country:     "Poland",
 			Coordinates: []float64{1.0, 1.0},
 		}
 		b, err := json.Marshal(&validPort)
@@ -67,8 +98,36 @@ func TestGetPort(t *testing.T) {
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusOK, resp.StatusCode)
-		svcPort, err := ParseRequestPort(resp.Body)
+		svcPort := readPort(t, resp)
+		assert.Equal(t, validPort, svcPort)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("create and get port with all properties", func(t *testing.T) {
+		validPort := api.Port{
+			Alias:       []string{"alias"},
+			City:        "city",
+			Code:        "52000",
+			Coordinates: []float64{1.0, 1.0},
+			Country:     "Poland",
+			Name:        "name",
+			Province:    "province",
+			Regions:     []string{"region"},
+			Timezone:    "Asia/Dubai",
+			Unlocs:      []string{"AEAJM"},
+		}
+		b, err := json.Marshal(&validPort)
+		require.NoError(t, err)
+		resp, err := client.Post(getEndpoint(server, "AEAJM"), "application/json", bytes.NewReader(b)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = client.Get(getEndpoint(server, "AEAJM")) // nolint: noctx
 		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		svcPort := readPort(t, resp)
 		assert.Equal(t, validPort, svcPort)
 	})
 	require.True(t, passed)
@@ -77,7 +136,7 @@ func TestGetPort(t *testing.T) {
 // TestCreatePort tests for port creation.
 func TestCreatePort(t *testing.T) { // nolint: funlen
 	stub := memory.NewPortMemory()
-	router := NewPortRouter(stub)
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -93,16 +152,15 @@ func TestCreatePort(t *testing.T) { // nolint: funlen
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-		errorMsg, err := io.ReadAll(resp.Body)
-		require.NoError(t, err)
-		expectedError := errors.New(strings.TrimSuffix(string(errorMsg), "\n"))
-		require.EqualError(t, expectedError, "failed to parse input port's data")
+		require.Equal(t, "body must be a JSON object", readProblem(t, resp).Detail)
 	})
 	require.True(t, passed)
 
-	passed = t.Run("port's name can not be empty", func(t *testing.T) {
+	passed = t.Run("every violation is returned", func(t *testing.T) {
 		validPort := api.Port{
-			Name: "",
+			Name:        "",
+			Coordinates: []float64{181, 1},
+			Country:     "Narnia",
 		}
 		b, err := json.Marshal(&validPort)
 		require.NoError(t, err)
@@ -111,17 +169,26 @@ func TestCreatePort(t *testing.T) { // nolint: funlen
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-		errorMsg, err := io.ReadAll(resp.Body)
-		require.NoError(t, err)
-		expectedError := errors.New(strings.TrimSuffix(string(errorMsg), "\n"))
-		require.EqualError(t, expectedError, "port's name can not be empty")
+		require.Equal(t, api.Problem{
+			Type:   api.ValidationProblemType,
+			Title:  "Request is not valid",
+			Status: http.StatusBadRequest,
+			Detail: "port's name can not be empty; port's longitude 181 is not between -180 and 180; " +
+				"port's country \"Narnia\" is not an ISO 3166 country name or code",
+			Instance: apiPorts + "/" + portID,
+			Errors: []api.FieldError{
+				{Field: "$.name", Message: "port's name can not be empty"},
+				{Field: "$.coordinates[0]", Message: "port's longitude 181 is not between -180 and 180"},
+				{Field: "$.country", Message: "port's country \"Narnia\" is not an ISO 3166 country name or code"},
+			},
+		}, readProblem(t, resp))
 	})
 	require.True(t, passed)
 
 	validPort := api.Port{
 		Name:        "name",
 		City:        "city",
-		Country:     "country",
+		Country:     "Poland",
 		Coordinates: []float64{1.0, 1.0},
 	}
 
@@ -132,6 +199,8 @@ func TestCreatePort(t *testing.T) { // nolint: funlen
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.Equal(t, apiPorts+"/"+portID, resp.Header.Get("Location"))
+		require.Empty(t, resp.Header.Get("Content-Type"), "response without a body must not have a content type")
 	})
 	require.True(t, passed)
 
@@ -149,7 +218,7 @@ func TestCreatePort(t *testing.T) { // nolint: funlen
 // TestUpdatePort tests for port update.
 func TestUpdatePort(t *testing.T) { // nolint: funlen
 	stub := memory.NewPortMemory()
-	router := NewPortRouter(stub)
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -168,16 +237,15 @@ func TestUpdatePort(t *testing.T) { // nolint: funlen
 		resp, err := client.Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
-		errorMsg, err := io.ReadAll(resp.Body)
-		require.NoError(t, err)
-		expectedError := errors.New(strings.TrimSuffix(string(errorMsg), "\n"))
-		require.EqualError(t, expectedError, "failed to parse input port's data")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.Equal(t, "body must be a JSON object", readProblem(t, resp).Detail)
 	})
 	require.True(t, passed)
 
 	passed = t.Run("coordinates' can not be empty", func(t *testing.T) {
 		validPort := api.Port{
-			Name: "test",
+			Name:    "test",
+			Country: "PL",
 		}
 		b, err := json.Marshal(&validPort)
 		require.NoError(t, err)
@@ -186,17 +254,14 @@ func TestUpdatePort(t *testing.T) { // nolint: funlen
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-		errorMsg, err := io.ReadAll(resp.Body)
-		require.NoError(t, err)
-		expectedError := errors.New(strings.TrimSuffix(string(errorMsg), "\n"))
-		require.EqualError(t, expectedError, "port's coordinates can not be empty")
+		require.Equal(t, "port's coordinates can not be empty", readProblem(t, resp).Detail)
 	})
 	require.True(t, passed)
 
 	validPort := api.Port{
 		Name:        "name",
 		City:        "city",
-		Country:     "country",
+		Country:     "Poland",
 		Coordinates: []float64{1.0, 1.0},
 	}
 
@@ -221,7 +286,1545 @@ func TestUpdatePort(t *testing.T) { // nolint: funlen
 		resp, err := client.Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
-		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Content-Type"), "response without a body must not have a content type")
+	})
+	require.True(t, passed)
+}
+
+// TestRequestBodies tests for limits, content types and strict decoding of JSON bodies.
+func TestRequestBodies(t *testing.T) { // nolint: funlen
+	send := func(t *testing.T, server *httptest.Server, method, path, contentType, body string) (int, api.Problem) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body)) // nolint: noctx
+		require.NoError(t, err)
+		if len(contentType) > 0 {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode < http.StatusBadRequest {
+			return resp.StatusCode, api.Problem{}
+		}
+
+		return resp.StatusCode, readProblem(t, resp)
+	}
+
+	stub := memory.NewPortMemory()
+	require.NoError(t, stub.Create(context.Background(), "existing", ports.Port{
+		Name: "name", Country: "Poland", Coordinates: []float64{1, 1},
+	}))
+	options := Options{MaxBodyBytes: 128, StrictJSON: true}
+	server := httptest.NewServer(NewPortRouter(stub, options, logging.Discard()))
+	defer server.Close()
+
+	validPort := `{"name": "name", "country": "Poland", "coordinates": [1, 1]}`
+	passed := t.Run("invalid bodies", func(t *testing.T) {
+		testCases := []struct {
+			name, method, contentType, body string
+			status                          int
+			message                         string
+		}{
+			{"without content type", http.MethodPost, "", validPort, http.StatusUnsupportedMediaType,
+				`content type "" is not supported, use "application/json"`},
+			{"other content type", http.MethodPut, "text/plain", validPort, http.StatusUnsupportedMediaType,
+				`content type "text/plain" is not supported, use "application/json"`},
+			{"too large", http.MethodPost, "application/json", `{"name": "` + strings.Repeat("n", 128) + `"}`,
+				http.StatusRequestEntityTooLarge, "body is larger than 128 bytes"},
+			{"unknown field", http.MethodPost, "application/json", `{"name": "name", "contry": "Poland"}`,
+				http.StatusBadRequest, "$.contry: unknown field"},
+			{"wrong type", http.MethodPut, "application/json", `{"name": 1, "coordinates": [1, 1]}`,
+				http.StatusBadRequest, "$.name: number can not be decoded into a string"},
+			{"empty", http.MethodPost, "application/json", "", http.StatusBadRequest, "body must be a JSON object"},
+			{"incomplete", http.MethodPost, "application/json", `{"name": "name"`, http.StatusBadRequest,
+				"body is not a complete JSON object"},
+			{"malformed", http.MethodPost, "application/json", `{"name" "name"}`, http.StatusBadRequest,
+				"malformed JSON at offset 9: invalid character '\"' after object key"},
+			{"many objects", http.MethodPost, "application/json", validPort + validPort, http.StatusBadRequest,
+				"body must contain a single JSON object"},
+		}
+
+		for _, testCase := range testCases {
+			status, problem := send(t, server, testCase.method, apiV1Prefix+"ports/existing", testCase.contentType,
+				testCase.body)
+			require.Equal(t, testCase.status, status, testCase.name)
+			require.Equal(t, testCase.message, problem.Detail, testCase.name)
+		}
+
+		_, problem := send(t, server, http.MethodPost, apiV1Prefix+"ports/existing", "application/json",
+			`{"name": "name", "contry": "Poland"}`)
+		require.Equal(t, api.ValidationProblemType, problem.Type)
+		require.Equal(t, []api.FieldError{{Field: "$.contry", Message: "unknown field"}}, problem.Errors)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("nested unknown fields", func(t *testing.T) {
+		var nested struct {
+			Port  api.Port   `json:"port"`
+			Ports []api.Port `json:"ports"`
+		}
+		err := decodeJSON(strings.NewReader(`{"port": {"Name": "name", "contry": ""}}`), true, &nested)
+		require.EqualError(t, err, "$.port.contry: unknown field")
+
+		err = decodeJSON(strings.NewReader(`{"ports": [{"name": "name"}, {"contry": ""}]}`), true, &nested)
+		require.EqualError(t, err, "$.ports[1].contry: unknown field")
+
+		_, err = ParseRequestPort(strings.NewReader(`{"name": "name", "contry": ""}`))
+		require.EqualError(t, err, "$.contry: unknown field")
+
+		err = decodeJSON(strings.NewReader(`{"port": {"name": 1, "contry": ""}}`), true, &nested)
+		require.EqualError(t, err, "$.port.name: number can not be decoded into a string")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("strict bodies are limited", func(t *testing.T) {
+		unlimited := httptest.NewServer(NewPortRouter(stub, Options{StrictJSON: true}, logging.Discard()))
+		defer unlimited.Close()
+
+		body := `{"name": "` + strings.Repeat("n", DefaultMaxBodyBytes) + `"}`
+		status, problem := send(t, unlimited, http.MethodPut, apiV1Prefix+"ports/existing", "application/json", body)
+		require.Equal(t, http.StatusRequestEntityTooLarge, status)
+		require.Equal(t, fmt.Sprintf("body is larger than %d bytes", DefaultMaxBodyBytes), problem.Detail)
+
+		_, err := ParseRequestPort(strings.NewReader(body))
+		require.EqualError(t, err, fmt.Sprintf("body is larger than %d bytes", DefaultMaxBodyBytes))
+	})
+	require.True(t, passed)
+
+	passed = t.Run("valid bodies", func(t *testing.T) {
+		status, _ := send(t, server, http.MethodPost, apiV1Prefix+"ports/new", "application/json; charset=utf-8",
+			validPort+"\n")
+		require.Equal(t, http.StatusCreated, status)
+
+		status, _ = send(t, server, http.MethodPut, apiV1Prefix+"ports/new", "application/json", validPort)
+		require.Equal(t, http.StatusNoContent, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("patches", func(t *testing.T) {
+		status, problem := send(t, server, http.MethodPatch, apiV1Prefix+"ports/existing", mergePatchContentType,
+			`{"contry": "Poland"}`)
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, "patched port is not valid: $.contry: unknown field", problem.Detail)
+		require.Equal(t, []api.FieldError{{Field: "$.contry", Message: "unknown field"}}, problem.Errors)
+
+		status, _ = send(t, server, http.MethodPatch, apiV1Prefix+"ports/existing", mergePatchContentType,
+			`{"name": "`+strings.Repeat("n", 128)+`"}`)
+		require.Equal(t, http.StatusRequestEntityTooLarge, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("lenient decoding", func(t *testing.T) {
+		lenient := httptest.NewServer(NewPortRouter(stub, Options{}, logging.Discard()))
+		defer lenient.Close()
+
+		body := `{"name": "name", "country": "Poland", "contry": "", "coordinates": [1, 1], "alias": ["` +
+			strings.Repeat("a", 128) + `"]}`
+		status, _ := send(t, lenient, http.MethodPut, apiV1Prefix+"ports/existing", "application/json", body)
+		require.Equal(t, http.StatusNoContent, status, "unknown fields and large bodies must be accepted")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid bodies are not logged as errors", func(t *testing.T) {
+		var logs bytes.Buffer
+		router := NewPortRouter(stub, options, logging.New(&logs, logging.FormatText, slog.LevelWarn))
+		bodies := map[string]string{
+			http.MethodPost:  `{"name": "name", "contry": "Poland"}`,
+			http.MethodPut:   `{"name": "name"}`,
+			http.MethodPatch: `[{"op": "replace", "path": "/contry", "value": "Poland"}]`,
+		}
+		for method, body := range bodies {
+			req := httptest.NewRequest(method, apiV1Prefix+"ports/existing", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if method == http.MethodPatch {
+				req.Header.Set("Content-Type", jsonPatchContentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusBadRequest, w.Code, method)
+		}
+		require.Empty(t, logs.String())
+	})
+	require.True(t, passed)
+}
+
+// TestDeletePort tests for port deletion.
+func TestDeletePort(t *testing.T) {
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+	portID := "test"
+
+	deletePort := func(t *testing.T) *http.Response {
+		req, err := http.NewRequest(http.MethodDelete, getEndpoint(server, portID), nil) // nolint: noctx
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	passed := t.Run("port does not exist", func(t *testing.T) {
+		resp := deletePort(t)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("create and delete port", func(t *testing.T) {
+		validPort := api.Port{
+			Name:        "name",
+			Country:     "Poland",
+			Coordinates: []float64{1.0, 1.0},
+		}
+		b, err := json.Marshal(&validPort)
+		require.NoError(t, err)
+		resp, err := client.Post(getEndpoint(server, portID), "application/json", bytes.NewReader(b)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp = deletePort(t)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, err = client.Get(getEndpoint(server, portID)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	require.True(t, passed)
+}
+
+// TestListPorts tests for listing ports.
+func TestListPorts(t *testing.T) { // nolint: funlen
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+
+	for _, id := range []string{"PLGDN", "PLGDY", "DEHAM"} {
+		validPort := api.Port{
+			Name:        id,
+			Country:     id[:2],
+			Coordinates: []float64{1.0, 1.0},
+		}
+		b, err := json.Marshal(&validPort)
+		require.NoError(t, err)
+		resp, err := client.Post(getEndpoint(server, id), "application/json", bytes.NewReader(b)) // nolint: noctx
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	list := func(t *testing.T, query string) (int, api.PortList) {
+		resp, err := client.Get(server.URL + apiPorts + "?" + query) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var portList api.PortList
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&portList))
+		}
+
+		return resp.StatusCode, portList
+	}
+
+	passed := t.Run("paginate filtered ports", func(t *testing.T) {
+		status, portList := list(t, "country=PL&sort=-id&limit=1")
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, portList.Ports, 1)
+		require.Equal(t, "PLGDY", portList.Ports[0].ID)
+		require.Equal(t, "PLGDY", portList.Ports[0].Name)
+		require.NotEmpty(t, portList.NextCursor)
+
+		status, portList = list(t, "country=PL&sort=-id&limit=1&cursor="+portList.NextCursor)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, portList.Ports, 1)
+		require.Equal(t, "PLGDN", portList.Ports[0].ID)
+		require.Empty(t, portList.NextCursor)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("no ports", func(t *testing.T) {
+		status, portList := list(t, "name=unknown")
+		require.Equal(t, http.StatusOK, status)
+		require.NotNil(t, portList.Ports)
+		require.Empty(t, portList.Ports)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"sort=coordinates", "limit=0", "limit=test", "cursor=test"} {
+			status, _ := list(t, query)
+			require.Equal(t, http.StatusBadRequest, status, query)
+		}
+	})
+	require.True(t, passed)
+}
+
+// TestSearchPortsByCoordinates tests for searching nearest ports and ports within an area.
+func TestSearchPortsByCoordinates(t *testing.T) { // nolint: funlen
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+
+	locations := map[string][]float64{
+		"PLGDN": {18.6466, 54.352},
+		"PLGDY": {18.5305, 54.5189},
+		"DEHAM": {9.9937, 53.5511},
+	}
+	for id, coordinates := range locations {
+		validPort := api.Port{
+			Name:        id,
+			Country:     id[:2],
+			Coordinates: coordinates,
+		}
+		b, err := json.Marshal(&validPort)
+		require.NoError(t, err)
+		resp, err := client.Post(getEndpoint(server, id), "application/json", bytes.NewReader(b)) // nolint: noctx
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	search := func(t *testing.T, path string) (int, []string) {
+		resp, err := client.Get(server.URL + apiPorts + "/" + path) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+
+		var nearby api.NearbyPorts
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&nearby))
+		ids := make([]string, 0, len(nearby.Ports))
+		for _, port := range nearby.Ports {
+			require.Equal(t, locations[port.ID], port.Coordinates)
+			require.Greater(t, port.Distance, 0.0)
+			ids = append(ids, port.ID)
+		}
+
+		return resp.StatusCode, ids
+	}
+
+	passed := t.Run("nearest ports", func(t *testing.T) {
+		status, ids := search(t, "nearest?lat=54.4418&lon=18.5601&k=2")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"PLGDY", "PLGDN"}, ids)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("ports within radius", func(t *testing.T) {
+		status, ids := search(t, "within?lat=54.4418&lon=18.5601&radius=500")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"PLGDY", "PLGDN"}, ids)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("ports within bounding box", func(t *testing.T) {
+		status, ids := search(t, "within?bbox=5,50,18.6,55")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"DEHAM", "PLGDY"}, ids)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid parameters", func(t *testing.T) {
+		for _, path := range []string{
+			"nearest?lat=91&lon=0", "nearest?lat=0", "nearest?lat=0&lon=0&k=0",
+			"within?lat=0&lon=0", "within?lat=0&lon=0&radius=-1", "within?bbox=1,2,3", "within?bbox=0,10,1,5",
+		} {
+			status, _ := search(t, path)
+			require.Equal(t, http.StatusBadRequest, status, path)
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("reserved ID can not be created", func(t *testing.T) {
+		b, err := json.Marshal(&api.Port{Name: "name", Country: "Poland", Coordinates: []float64{1, 1}})
+		require.NoError(t, err)
+		resp, err := client.Post(getEndpoint(server, "nearest"), "application/json", bytes.NewReader(b)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	require.True(t, passed)
+}
+
+// TestPatchPort tests for partial port update.
+func TestPatchPort(t *testing.T) { // nolint: funlen
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+	portID := "test"
+
+	patchPort := func(t *testing.T, contentType, patch string) (int, api.Port) {
+		req, err := http.NewRequest(http.MethodPatch, getEndpoint(server, portID), strings.NewReader(patch)) // nolint: noctx
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var port api.Port
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&port))
+		}
+
+		return resp.StatusCode, port
+	}
+
+	passed := t.Run("port does not exist", func(t *testing.T) {
+		status, _ := patchPort(t, mergePatchContentType, `{"name": "new_name"}`)
+		require.Equal(t, http.StatusNotFound, status)
+	})
+	require.True(t, passed)
+
+	validPort := api.Port{
+		Name:        "name",
+		City:        "city",
+		Country:     "Poland",
+		Coordinates: []float64{1.0, 1.0},
+		Alias:       []string{"alias"},
+	}
+	b, err := json.Marshal(&validPort)
+	require.NoError(t, err)
+	resp, err := client.Post(getEndpoint(server, portID), "application/json", bytes.NewReader(b)) // nolint: noctx
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	passed = t.Run("merge patch", func(t *testing.T) {
+		status, port := patchPort(t, mergePatchContentType, `{"name": "new_name", "city": null}`)
+		require.Equal(t, http.StatusOK, status)
+		expectedPort := validPort
+		expectedPort.Name = "new_name"
+		expectedPort.City = ""
+		require.Equal(t, expectedPort, port)
+
+		resp, err := client.Get(getEndpoint(server, portID)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		svcPort := readPort(t, resp)
+		require.Equal(t, expectedPort, svcPort)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("json patch", func(t *testing.T) {
+		status, port := patchPort(t, jsonPatchContentType+"; charset=utf-8", `[
+			{"op": "test", "path": "/name", "value": "new_name"},
+			{"op": "add", "path": "/alias/-", "value": "other_alias"},
+			{"op": "replace", "path": "/coordinates/0", "value": 2.5}
+		]`)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"alias", "other_alias"}, port.Alias)
+		require.Equal(t, []float64{2.5, 1.0}, port.Coordinates)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("failed json patch test", func(t *testing.T) {
+		status, _ := patchPort(t, jsonPatchContentType, `[
+			{"op": "test", "path": "/name", "value": "name"},
+			{"op": "replace", "path": "/name", "value": "other"}
+		]`)
+		require.Equal(t, http.StatusConflict, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("json patch of empty fields", func(t *testing.T) {
+		status, port := patchPort(t, jsonPatchContentType, `[
+			{"op": "test", "path": "/province", "value": ""},
+			{"op": "replace", "path": "/province", "value": "province"},
+			{"op": "add", "path": "/regions/-", "value": "region"}
+		]`)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "province", port.Province)
+		require.Equal(t, []string{"region"}, port.Regions)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("json patch can not be applied", func(t *testing.T) {
+		patches := []string{
+			`[{"op": "replace", "path": "/contry", "value": "Poland"}]`,
+			`[{"op": "remove", "path": "/alias/9"}]`,
+			`[{"op": "rename", "path": "/name", "value": "name"}]`,
+			`[{"op": "replace", "value": "name"}]`,
+		}
+		for _, patch := range patches {
+			status, _ := patchPort(t, jsonPatchContentType, patch)
+			require.Equal(t, http.StatusBadRequest, status, patch)
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("patched port is not valid", func(t *testing.T) {
+		status, _ := patchPort(t, mergePatchContentType, `{"coordinates": null}`)
+		require.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = patchPort(t, mergePatchContentType, `{"coordinates": "invalid"}`)
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid patch", func(t *testing.T) {
+		status, _ := patchPort(t, mergePatchContentType, `[]`)
+		require.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = patchPort(t, jsonPatchContentType, `{}`)
+		require.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = patchPort(t, "application/json", `{"name": "new_name"}`)
+		require.Equal(t, http.StatusUnsupportedMediaType, status)
 	})
 	require.True(t, passed)
 }
+
+// TestConditionalRequests tests for ETag, If-Match and If-None-Match headers.
+func TestConditionalRequests(t *testing.T) { // nolint: funlen
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+	portID := "test"
+
+	do := func(t *testing.T, method, header, etag string, port *api.Port) *http.Response {
+		var body io.Reader
+		if port != nil {
+			b, err := json.Marshal(port)
+			require.NoError(t, err)
+			body = bytes.NewReader(b)
+		}
+
+		req, err := http.NewRequest(method, getEndpoint(server, portID), body) // nolint: noctx
+		require.NoError(t, err)
+		if len(header) > 0 {
+			req.Header.Set(header, etag)
+		}
+		if method == http.MethodPatch {
+			req.Header.Set("Content-Type", mergePatchContentType)
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			resp.Body.Close()
+		})
+
+		return resp
+	}
+
+	validPort := api.Port{
+		Name:        "name",
+		City:        "city",
+		Country:     "Poland",
+		Coordinates: []float64{1.0, 1.0},
+	}
+
+	passed := t.Run("port does not exist", func(t *testing.T) {
+		resp := do(t, http.MethodPut, "If-Match", "*", &validPort)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp = do(t, http.MethodPut, "If-Match", `"1"`, &validPort)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	resp := do(t, http.MethodPost, "", "", &validPort)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var etag string
+	passed = t.Run("get returns etag", func(t *testing.T) {
+		resp := do(t, http.MethodGet, "", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag = resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		resp = do(t, http.MethodGet, "If-None-Match", etag, nil)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+		require.Equal(t, etag, resp.Header.Get("ETag"))
+
+		resp = do(t, http.MethodGet, "If-None-Match", `"0", W/`+etag, nil)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		resp = do(t, http.MethodGet, "If-None-Match", `"0"`, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("update with matching etag", func(t *testing.T) {
+		updated := validPort
+		updated.Name = "updated"
+		resp := do(t, http.MethodPut, "If-Match", etag, &updated)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		// The second client still has the old ETag, so it must not overwrite changes.
+		resp = do(t, http.MethodPut, "If-Match", etag, &validPort)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp = do(t, http.MethodGet, "If-None-Match", etag, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NotEqual(t, etag, resp.Header.Get("ETag"))
+		port := readPort(t, resp)
+		require.Equal(t, updated, port)
+		etag = resp.Header.Get("ETag")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("update with any etag", func(t *testing.T) {
+		resp := do(t, http.MethodPut, "If-Match", `"0", `+etag, &validPort)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp = do(t, http.MethodPut, "If-Match", "*", &validPort)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp = do(t, http.MethodPut, "If-Match", "W/"+etag, &validPort)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, "weak etag must not match")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("patch with etag", func(t *testing.T) {
+		patch := &api.Port{Name: "patched"}
+		resp := do(t, http.MethodPatch, "If-Match", etag, patch)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp = do(t, http.MethodGet, "", "", nil)
+		etag = resp.Header.Get("ETag")
+		resp = do(t, http.MethodPatch, "If-Match", etag, patch)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NotEqual(t, etag, resp.Header.Get("ETag"))
+	})
+	require.True(t, passed)
+}
+
+// TestImportPorts tests for importing ports.
+func TestImportPorts(t *testing.T) {
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+	importEndpoint := server.URL + apiPorts + ":import"
+
+	importPorts := func(t *testing.T, mode, data string) (int, api.ImportReport) {
+		resp, err := client.Post(importEndpoint+"?mode="+mode, "application/json", strings.NewReader(data)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var report api.ImportReport
+		if resp.StatusCode != http.StatusBadRequest || mode != "invalid" {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		}
+
+		return resp.StatusCode, report
+	}
+
+	data := `{
+		"PLGDN": { "name": "Gdansk", "country": "Poland", "coordinates": [18.6466, 54.352] },
+		"PLGDY": { "name": "Gdynia", "country": "Poland", "coordinates": [18.5305, 54.5189] },
+		"nearest": { "name": "Reserved", "country": "Poland", "coordinates": [1, 1] },
+		"INVALID": { "name": "Invalid", "country": "Poland" }
+	}`
+
+	passed := t.Run("create ports", func(t *testing.T) {
+		status, report := importPorts(t, "create", data)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"PLGDN", "PLGDY"}, report.Created)
+		require.Len(t, report.Failed, 2)
+		require.Equal(t, "nearest", report.Failed[0].ID)
+		require.Equal(t, "INVALID", report.Failed[1].ID)
+
+		resp, err := client.Get(getEndpoint(server, "PLGDY")) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("replace all ports", func(t *testing.T) {
+		// A name is decomposed and it has a trailing space, so it is normalized like a port created through API.
+		status, report := importPorts(t, "replace",
+			`{ "PLGDN": { "name": "Gdan\u0301sk ", "country": "Poland", "coordinates": [18.6466, 54.352] } }`)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"PLGDN"}, report.Updated)
+		require.Equal(t, []string{"PLGDY"}, report.Deleted)
+		require.Empty(t, report.Created)
+		require.Empty(t, report.Failed)
+
+		port, err := stub.Get(context.Background(), "PLGDN")
+		require.NoError(t, err)
+		require.Equal(t, "Gdańsk", port.Name)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("unchanged ports are skipped", func(t *testing.T) {
+		status, report := importPorts(t, "upsert",
+			`{ "PLGDN": { "name": "Gdańsk", "country": "Poland", "coordinates": [18.6466, 54.352], "alias": [] } }`)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, []string{"PLGDN"}, report.Skipped)
+		require.Empty(t, report.Updated)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("malformed data", func(t *testing.T) {
+		status, report := importPorts(t, "upsert", `{ "PLSZZ": { "name": "Szczecin", "country": "Poland", "coordinates": [1, 1] }, 1`)
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Equal(t, []string{"PLSZZ"}, report.Created)
+		require.NotEmpty(t, report.Error)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid mode", func(t *testing.T) {
+		status, _ := importPorts(t, "invalid", `{}`)
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("method not allowed", func(t *testing.T) {
+		resp, err := client.Get(importEndpoint) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+		require.Equal(t, http.MethodPost, resp.Header.Get("Allow"))
+	})
+	require.True(t, passed)
+}
+
+// TestExportPorts tests for exporting ports in all formats.
+func TestExportPorts(t *testing.T) { // nolint: funlen
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+	exportEndpoint := server.URL + apiPorts + ":export"
+
+	export := func(t *testing.T, query, accept string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, exportEndpoint+query, nil) // nolint: noctx
+		require.NoError(t, err)
+		if len(accept) > 0 {
+			req.Header.Set("Accept", accept)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, string(b)
+	}
+
+	// More ports than on a single page of a list.
+	const count = ports.MaxListLimit + 1
+	for i := 0; i < count; i++ {
+		port := ports.Port{Name: fmt.Sprintf("port %d", i), Country: "Poland", Coordinates: []float64{1, 2}}
+		require.NoError(t, stub.Create(context.Background(), fmt.Sprintf("ID%04d", i), port))
+	}
+	require.NoError(t, stub.Create(context.Background(), "NOCOORDS", ports.Port{
+		Name:  "no coordinates",
+		Alias: []string{"a", "b"},
+	}))
+
+	passed := t.Run("json can be read again", func(t *testing.T) {
+		resp, body := export(t, "", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		channel := make(chan ports.PortWithID, count+1)
+		require.NoError(t, ports.ReadPorts(context.Background(), strings.NewReader(body), channel))
+		close(channel)
+		require.Len(t, channel, count+1)
+		first := <-channel
+		require.Equal(t, "ID0000", first.ID)
+		require.Equal(t, "port 0", first.Name)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("ndjson", func(t *testing.T) {
+		resp, body := export(t, "", "application/x-ndjson")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		require.Len(t, lines, count+1)
+		var port api.PortWithID
+		require.NoError(t, json.Unmarshal([]byte(lines[count]), &port))
+		require.Equal(t, "NOCOORDS", port.ID)
+		require.Equal(t, []string{"a", "b"}, port.Alias)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("csv", func(t *testing.T) {
+		resp, body := export(t, "?format=csv", "application/json")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		require.Len(t, lines, count+2)
+		require.Equal(t, "id,name,city,province,country,code,timezone,longitude,latitude,alias,regions,unlocs", lines[0])
+		require.Equal(t, "ID0000,port 0,,,Poland,,,1,2,,,", lines[1])
+		require.Equal(t, "NOCOORDS,no coordinates,,,,,,,,a;b,,", lines[count+1])
+	})
+	require.True(t, passed)
+
+	passed = t.Run("geojson", func(t *testing.T) {
+		resp, body := export(t, "", "text/html;q=0.9, application/geo+json")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/geo+json", resp.Header.Get("Content-Type"))
+
+		var collection struct {
+			Type     string           `json:"type"`
+			Features []geoJSONFeature `json:"features"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &collection))
+		require.Equal(t, "FeatureCollection", collection.Type)
+		require.Len(t, collection.Features, count+1)
+		require.Equal(t, &geoJSONPoint{Type: "Point", Coordinates: []float64{1, 2}}, collection.Features[0].Geometry)
+		require.Nil(t, collection.Features[0].Properties.Coordinates)
+		require.Nil(t, collection.Features[count].Geometry)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("negotiation", func(t *testing.T) {
+		resp, _ := export(t, "", "text/*")
+		require.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+
+		resp, _ = export(t, "", "application/json;q=0.5, application/x-ndjson")
+		require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		resp, _ = export(t, "", "text/html")
+		require.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+		resp, _ = export(t, "?format=xml", "")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	require.True(t, passed)
+}
+
+// reloaderStub returns a given report and error.
+type reloaderStub struct {
+	report ports.ImportReport
+	err    error
+}
+
+func (r reloaderStub) Reload(_ context.Context) (ports.ImportReport, error) {
+	return r.report, r.err
+}
+
+// TestAdminReload tests for reloading a seed file.
+func TestAdminReload(t *testing.T) {
+	reload := func(t *testing.T, reloader Reloader) (*http.Response, api.ImportReport) {
+		server := httptest.NewServer(NewAdminRouter(reloader, logging.Discard()))
+		defer server.Close()
+
+		resp, err := server.Client().Post(server.URL+"/admin/reload", "application/json", nil) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var report api.ImportReport
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+
+		return resp, report
+	}
+
+	passed := t.Run("reloaded", func(t *testing.T) {
+		resp, report := reload(t, reloaderStub{report: ports.ImportReport{
+			Created: []string{"NEW"},
+			Deleted: []string{"REMOVED"},
+		}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, []string{"NEW"}, report.Created)
+		require.Equal(t, []string{"REMOVED"}, report.Deleted)
+		require.Empty(t, report.Error)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid seed file", func(t *testing.T) {
+		err := fmt.Errorf("failed to read seed file: %w", &ports.ReadError{ID: "INVALID", Err: errors.New("invalid port")})
+		resp, report := reload(t, reloaderStub{err: err})
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		require.Contains(t, report.Error, "INVALID")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("seed file is not available", func(t *testing.T) {
+		resp, report := reload(t, reloaderStub{err: errors.New("file does not exist")})
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		require.Equal(t, "file does not exist", report.Error)
+	})
+	require.True(t, passed)
+}
+
+// TestPortHistory tests for listing changes of ports.
+func TestPortHistory(t *testing.T) { // nolint: funlen
+	svc := audit.NewPortService(memory.NewPortMemory(), audit.NewMemorySink(), logging.Discard())
+	server := httptest.NewServer(audit.Middleware(true, NewPortRouter(svc, DefaultOptions(), logging.Discard())))
+	defer server.Close()
+
+	client := server.Client()
+	portID := "test"
+
+	send := func(t *testing.T, method, url, contentType, body string) {
+		req, err := http.NewRequest(method, url, strings.NewReader(body)) // nolint: noctx
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(audit.ActorHeader, "alice")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Less(t, resp.StatusCode, http.StatusBadRequest)
+	}
+	listEvents := func(t *testing.T, url string) (*http.Response, api.AuditEventList) {
+		resp, err := client.Get(url) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var list api.AuditEventList
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		}
+
+		return resp, list
+	}
+
+	send(t, http.MethodPost, getEndpoint(server, portID), "application/json",
+		`{"name": "name", "country": "Poland", "coordinates": [1, 2]}`)
+	send(t, http.MethodPost, getEndpoint(server, "other"), "application/json",
+		`{"name": "other", "country": "Poland", "coordinates": [1, 2]}`)
+	send(t, http.MethodPatch, getEndpoint(server, portID), "application/merge-patch+json",
+		`{"name": "new name", "city": "city"}`)
+	send(t, http.MethodDelete, getEndpoint(server, portID), "", "")
+
+	passed := t.Run("history of a port", func(t *testing.T) {
+		resp, list := listEvents(t, getEndpoint(server, portID)+"/history")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, list.Events, 3)
+		require.Empty(t, list.NextCursor)
+
+		created, updated, deleted := list.Events[0], list.Events[1], list.Events[2]
+		require.Equal(t, "create", created.Action)
+		require.Nil(t, created.Before)
+		require.Equal(t, "name", created.After.Name)
+		require.Equal(t, "update", updated.Action)
+		require.Equal(t, []api.AuditChange{
+			{Field: "name", Before: "name", After: "new name"},
+			{Field: "city", Before: nil, After: "city"},
+		}, updated.Changes)
+		require.Equal(t, "delete", deleted.Action)
+		require.Equal(t, "new name", deleted.Before.Name)
+		require.Nil(t, deleted.After)
+
+		for _, event := range list.Events {
+			require.Equal(t, portID, event.PortID)
+			require.Equal(t, "alice", event.Actor)
+			require.False(t, event.Time.IsZero())
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("audit log is paginated", func(t *testing.T) {
+		resp, first := listEvents(t, server.URL+"/api/v1/audit?limit=3")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, first.Events, 3)
+		require.Equal(t, "other", first.Events[1].PortID)
+		require.NotEmpty(t, first.NextCursor)
+
+		resp, second := listEvents(t, server.URL+"/api/v1/audit?limit=3&cursor="+first.NextCursor)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, second.Events, 1)
+		require.Equal(t, "delete", second.Events[0].Action)
+		require.Empty(t, second.NextCursor)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid page", func(t *testing.T) {
+		resp, _ := listEvents(t, server.URL+"/api/v1/audit?cursor=invalid")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, _ = listEvents(t, server.URL+"/api/v1/audit?limit=0")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("service does not record history", func(t *testing.T) {
+		server := httptest.NewServer(NewPortRouter(memory.NewPortMemory(), DefaultOptions(), logging.Discard()))
+		defer server.Close()
+
+		resp, _ := listEvents(t, server.URL+"/api/v1/audit")
+		require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+	require.True(t, passed)
+}
+
+// racingCreate is a port's service whose port is created by another writer right before the first Create.
+type racingCreate struct {
+	ports.PortService
+	ports.HistoryService
+	other func()
+}
+
+func (s *racingCreate) Create(ctx context.Context, ID string, port ports.Port) error {
+	if s.other != nil {
+		s.other()
+		s.other = nil
+	}
+
+	return s.PortService.Create(ctx, ID, port)
+}
+
+// TestPreviousRevisions tests for getting and reverting previous revisions of a port.
+func TestPreviousRevisions(t *testing.T) { // nolint: funlen
+	storage := memory.NewPortMemory()
+	svc := audit.NewPortService(storage, audit.NewMemorySink(), logging.Discard())
+	server := httptest.NewServer(NewPortRouter(svc, DefaultOptions(), logging.Discard()))
+	defer server.Close()
+
+	client := server.Client()
+	portID := "test"
+	ctx := context.Background()
+
+	getPort := func(t *testing.T, query string) (*http.Response, api.Port) {
+		resp, err := client.Get(getEndpoint(server, portID) + "?" + query) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var port api.Port
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&port))
+		}
+
+		return resp, port
+	}
+	revert := func(t *testing.T, body, ifMatch string) (*http.Response, api.Port) {
+		req, err := http.NewRequest(http.MethodPost, getEndpoint(server, portID)+"/revert", // nolint: noctx
+			strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if len(ifMatch) > 0 {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var port api.Port
+		if resp.StatusCode < http.StatusBadRequest {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&port))
+		}
+
+		return resp, port
+	}
+
+	require.NoError(t, svc.Create(ctx, portID, ports.Port{Name: "first", Country: "Poland", Coordinates: []float64{1, 1}}))
+	first, err := svc.Get(ctx, portID)
+	require.NoError(t, err)
+	require.NoError(t, svc.Update(ctx, portID, ports.Port{Name: "second", Country: "Poland", Coordinates: []float64{1, 1}}))
+
+	passed := t.Run("previous revision", func(t *testing.T) {
+		resp, port := getPort(t, fmt.Sprintf("revision=%d", first.Revision))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, formatETag(first.Revision), resp.Header.Get("ETag"))
+		require.Equal(t, "first", port.Name)
+
+		resp, _ = getPort(t, "revision=1000")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("port as of time", func(t *testing.T) {
+		resp, port := getPort(t, "asOf=2999-01-01T00:00:00Z")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "second", port.Name)
+
+		resp, _ = getPort(t, "asOf=2000-01-01T00:00:00Z")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, "port has not existed yet")
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid query", func(t *testing.T) {
+		for _, query := range []string{
+			"revision=0", "revision=first", "asOf=yesterday", "revision=1&asOf=2999-01-01T00:00:00Z",
+		} {
+			resp, _ := getPort(t, query)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("revert", func(t *testing.T) {
+		resp, _ := revert(t, fmt.Sprintf(`{"revision": %d}`, first.Revision), formatETag(first.Revision))
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+		resp, port := revert(t, fmt.Sprintf(`{"revision": %d}`, first.Revision), "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "first", port.Name)
+
+		reverted, err := svc.Get(ctx, portID)
+		require.NoError(t, err)
+		require.Equal(t, "first", reverted.Name)
+		require.Greater(t, reverted.Revision, first.Revision, "a revert is a new revision")
+		require.Equal(t, formatETag(reverted.Revision), resp.Header.Get("ETag"))
+	})
+	require.True(t, passed)
+
+	passed = t.Run("revert deleted port", func(t *testing.T) {
+		require.NoError(t, svc.Delete(ctx, portID))
+		resp, _ := getPort(t, "asOf=2999-01-01T00:00:00Z")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode, "port has been deleted")
+
+		resp, port := revert(t, fmt.Sprintf(`{"revision": %d}`, first.Revision), "")
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.Equal(t, "first", port.Name)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("revert races with creation", func(t *testing.T) {
+		require.NoError(t, svc.Delete(ctx, portID))
+		racing := httptest.NewServer(NewPortRouter(&racingCreate{
+			PortService:    svc,
+			HistoryService: svc.(ports.HistoryService),
+			other: func() {
+				require.NoError(t, svc.Create(ctx, portID, ports.Port{Name: "other", Country: "Poland", Coordinates: []float64{1, 1}}))
+			},
+		}, DefaultOptions(), logging.Discard()))
+		defer racing.Close()
+
+		resp, err := racing.Client().Post(getEndpoint(racing, portID)+"/revert", "application/json", // nolint: noctx
+			strings.NewReader(fmt.Sprintf(`{"revision": %d}`, first.Revision)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, "port created in the meantime must be modified")
+		require.Equal(t, "first", readPort(t, resp).Name)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("revert port which is not valid any more", func(t *testing.T) {
+		// A port has been stored by a service which does not validate ports, e.g. under older rules.
+		require.NoError(t, svc.Update(ctx, portID, ports.Port{Name: "loose", Country: "Poland"}))
+		loose, err := svc.Get(ctx, portID)
+		require.NoError(t, err)
+		require.NoError(t, svc.Update(ctx, portID, ports.Port{Name: "strict", Country: "Poland",
+			Coordinates: []float64{1, 1}}))
+
+		resp, _ := revert(t, fmt.Sprintf(`{"revision": %d}`, loose.Revision), "")
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+		current, err := svc.Get(ctx, portID)
+		require.NoError(t, err)
+		require.Equal(t, "strict", current.Name)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid revert", func(t *testing.T) {
+		resp, _ := revert(t, `{"revision": 1000}`, "")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, _ = revert(t, `{}`, "")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("incomplete history", func(t *testing.T) {
+		// A port has been stored before its history is kept, e.g. by a persistent storage before a restart.
+		portID = "incomplete"
+		require.NoError(t, storage.Create(ctx, portID, ports.Port{Name: "first", Country: "Poland", Coordinates: []float64{1, 1}}))
+		unrecorded, err := storage.Get(ctx, portID)
+		require.NoError(t, err)
+		require.NoError(t, svc.Update(ctx, portID, ports.Port{Name: "second", Country: "Poland", Coordinates: []float64{1, 1}}))
+
+		resp, _ := getPort(t, fmt.Sprintf("revision=%d", unrecorded.Revision))
+		require.Equal(t, http.StatusConflict, resp.StatusCode, "revision may be missing in history")
+		resp, _ = getPort(t, "asOf=2000-01-01T00:00:00Z")
+		require.Equal(t, http.StatusConflict, resp.StatusCode, "port may have existed")
+		resp, _ = revert(t, fmt.Sprintf(`{"revision": %d}`, unrecorded.Revision), "")
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		resp, port := getPort(t, "asOf=2999-01-01T00:00:00Z")
+		require.Equal(t, http.StatusOK, resp.StatusCode, "recorded changes are complete")
+		require.Equal(t, "second", port.Name)
+	})
+	require.True(t, passed)
+}
+
+// TestWatchPorts tests for streaming changes of ports.
+func TestWatchPorts(t *testing.T) { // nolint: funlen
+	stub := memory.NewPortMemory()
+	router := NewPortRouter(stub, DefaultOptions(), logging.Discard())
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := server.Client()
+	ctx := context.Background()
+
+	// watch starts a stream, and returns a function which reads a next event from it.
+	watch := func(t *testing.T, query, lastEventID string) (*http.Response, func() (string, api.WatchEvent)) {
+		ctx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+apiPorts+":watch?"+query, nil)
+		require.NoError(t, err)
+		if len(lastEventID) > 0 {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		reader := bufio.NewReader(resp.Body)
+
+		return resp, func() (string, api.WatchEvent) {
+			var id string
+			var event api.WatchEvent
+			for {
+				line, err := reader.ReadString('\n')
+				require.NoError(t, err)
+				line = strings.TrimSuffix(line, "\n")
+				switch {
+				case len(line) == 0:
+					return id, event
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+				}
+			}
+		}
+	}
+
+	passed := t.Run("changes are streamed", func(t *testing.T) {
+		resp, next := watch(t, "", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		require.NoError(t, stub.Create(ctx, "PLGDN", ports.Port{Name: "Gdansk", Country: "Poland"}))
+		require.NoError(t, stub.Delete(ctx, "PLGDN"))
+
+		id, event := next()
+		require.Equal(t, "1", id)
+		require.Equal(t, api.WatchEvent{
+			ID: "PLGDN", Action: "create", Revision: 1, Port: &api.Port{Name: "Gdansk", Country: "Poland"},
+		}, event)
+
+		id, event = next()
+		require.Equal(t, "2", id)
+		require.Equal(t, "delete", event.Action)
+		require.Equal(t, "Gdansk", event.Port.Name)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("resume with filters", func(t *testing.T) {
+		require.NoError(t, stub.Create(ctx, "PLGDY", ports.Port{Name: "Gdynia", Country: "Poland"}))
+		require.NoError(t, stub.Create(ctx, "DEHAM", ports.Port{Name: "Hamburg", Country: "Germany"}))
+		require.NoError(t, stub.Create(ctx, "PLSZZ", ports.Port{Name: "Szczecin", Country: "Poland"}))
+
+		_, next := watch(t, "country=poland", "2")
+		_, event := next()
+		require.Equal(t, "PLGDY", event.ID)
+		_, event = next()
+		require.Equal(t, "PLSZZ", event.ID)
+
+		_, next = watch(t, "idPrefix=DE&fromRevision=1", "")
+		_, event = next()
+		require.Equal(t, "DEHAM", event.ID)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid revision", func(t *testing.T) {
+		resp, _ := watch(t, "", "first")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("service does not support watching", func(t *testing.T) {
+		server := httptest.NewServer(NewPortRouter(struct{ ports.PortService }{stub}, DefaultOptions(), logging.Discard()))
+		defer server.Close()
+
+		resp, err := server.Client().Get(server.URL + apiPorts + ":watch") // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+	require.True(t, passed)
+}
+
+// TestWebhooks tests for managing subscriptions of webhooks.
+func TestWebhooks(t *testing.T) { // nolint: funlen
+	dispatcher := webhook.NewDispatcher(memory.NewPortMemory(), webhook.DefaultOptions(EncodeWatchEvent),
+		logging.Discard())
+	defer dispatcher.Close()
+	server := httptest.NewServer(NewWebhookRouter(dispatcher, DefaultOptions(), logging.Discard()))
+	defer server.Close()
+
+	client := server.Client()
+	endpoint := server.URL + "/api/v1/webhooks"
+
+	// get sends GET request, and it decodes a response with a given status.
+	get := func(t *testing.T, url string, status int, v interface{}) {
+		resp, err := client.Get(url) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode)
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+	}
+
+	var created api.Webhook
+	passed := t.Run("create webhook", func(t *testing.T) {
+		body := `{"url": "http://localhost:8081/ports", "country": "Poland", "idPrefix": "PL"}`
+		resp, err := client.Post(endpoint, "application/json", strings.NewReader(body)) // nolint: noctx
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		require.NotEmpty(t, created.ID)
+		require.NotEmpty(t, created.Secret, "secret is returned when a webhook is created")
+		require.Equal(t, "http://localhost:8081/ports", created.URL)
+		require.Equal(t, "Poland", created.Country)
+		require.Equal(t, "PL", created.IDPrefix)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("invalid webhook", func(t *testing.T) {
+		for _, body := range []string{`{"url": "localhost"}`, `{"url": "ftp://localhost"}`, `{`} {
+			resp, err := client.Post(endpoint, "application/json", strings.NewReader(body)) // nolint: noctx
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("get and list webhooks", func(t *testing.T) {
+		expected := created
+		expected.Secret = ""
+
+		var found api.Webhook
+		get(t, endpoint+"/"+created.ID, http.StatusOK, &found)
+		require.Equal(t, expected, found)
+
+		var list api.WebhookList
+		get(t, endpoint, http.StatusOK, &list)
+		require.Equal(t, []api.Webhook{expected}, list.Webhooks)
+
+		var deadLetters api.DeadLetterList
+		get(t, endpoint+"/"+created.ID+"/deadLetters", http.StatusOK, &deadLetters)
+		require.Empty(t, deadLetters.DeadLetters)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("delete webhook", func(t *testing.T) {
+		del := func() int {
+			req, err := http.NewRequest(http.MethodDelete, endpoint+"/"+created.ID, nil) // nolint: noctx
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		require.Equal(t, http.StatusNoContent, del())
+		require.Equal(t, http.StatusNotFound, del())
+
+		get(t, endpoint+"/"+created.ID, http.StatusNotFound, nil)
+		get(t, endpoint+"/"+created.ID+"/deadLetters", http.StatusNotFound, nil)
+
+		var list api.WebhookList
+		get(t, endpoint, http.StatusOK, &list)
+		require.Empty(t, list.Webhooks)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("watch not supported", func(t *testing.T) {
+		server := httptest.NewServer(NewWebhookRouter(nil, DefaultOptions(), logging.Discard()))
+		defer server.Close()
+
+		resp, err := server.Client().Post(server.URL+"/api/v1/webhooks", "application/json", // nolint: noctx
+			strings.NewReader(`{"url": "http://localhost/hook"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+		require.Equal(t, ports.ErrWatchNotSupported.Error(), readProblem(t, resp).Detail)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("failed webhooks", func(t *testing.T) {
+		server := httptest.NewServer(NewWebhookRouter(failingWebhooks{}, DefaultOptions(), logging.Discard()))
+		defer server.Close()
+
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			req, err := http.NewRequest(method, server.URL+"/api/v1/webhooks/id", nil) // nolint: noctx
+			require.NoError(t, err)
+			resp, err := server.Client().Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusInternalServerError, resp.StatusCode, method)
+		}
+
+		resp, err := server.Client().Get(server.URL + "/api/v1/webhooks/id/deadLetters") // nolint: noctx
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	})
+	require.True(t, passed)
+}
+
+// failingWebhooks fails to read and remove every subscription.
+type failingWebhooks struct {
+	Webhooks
+}
+
+func (failingWebhooks) Unsubscribe(string) error {
+	return errors.New("webhooks are not available")
+}
+
+func (failingWebhooks) Subscription(string) (webhook.Subscription, error) {
+	return webhook.Subscription{}, errors.New("webhooks are not available")
+}
+
+func (failingWebhooks) DeadLetters(string) ([]webhook.DeadLetter, error) {
+	return nil, errors.New("webhooks are not available")
+}
+
+// TestRequiredRole tests for roles which are required by endpoints.
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method, path string
+		role         auth.Role
+	}{
+		{http.MethodGet, "/healthz", auth.RoleNone},
+		{http.MethodGet, "/metrics", auth.RoleNone},
+		{http.MethodGet, "/api/v1/ports", auth.RoleReader},
+		{http.MethodGet, "/api/v1/ports/PLGDN/history", auth.RoleReader},
+		{http.MethodGet, "/api/v1/ports:export", auth.RoleReader},
+		{http.MethodGet, "/api/v1/ports:watch", auth.RoleReader},
+		{http.MethodGet, "/api/v1/audit", auth.RoleReader},
+		{http.MethodPost, "/api/v1/ports/PLGDN", auth.RoleEditor},
+		{http.MethodPut, "/api/v1/ports/PLGDN", auth.RoleEditor},
+		{http.MethodPatch, "/api/v1/ports/PLGDN", auth.RoleEditor},
+		{http.MethodPost, "/api/v1/ports/PLGDN/revert", auth.RoleEditor},
+		{http.MethodDelete, "/api/v1/ports/PLGDN", auth.RoleAdmin},
+		{http.MethodPost, "/api/v1/ports:import", auth.RoleAdmin},
+		{http.MethodGet, "/api/v1/webhooks", auth.RoleAdmin},
+		{http.MethodGet, "/api/v1/webhooks/1/deadLetters", auth.RoleAdmin},
+		{http.MethodPost, "/admin/reload", auth.RoleAdmin},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		assert.Equal(t, test.role, RequiredRole(r), "%s %s", test.method, test.path)
+	}
+}
+
+// TestRateLimitBudget tests for budgets of rate limits of endpoints.
+func TestRateLimitBudget(t *testing.T) {
+	tests := []struct {
+		method, path string
+		budget       ratelimit.Budget
+	}{
+		{http.MethodGet, "/healthz", ratelimit.Unlimited},
+		{http.MethodGet, "/metrics", ratelimit.Unlimited},
+		{http.MethodGet, "/api/v1/ports/PLGDN", ratelimit.Read},
+		{http.MethodGet, "/api/v1/webhooks", ratelimit.Read},
+		{http.MethodPost, "/api/v1/ports/PLGDN", ratelimit.Write},
+		{http.MethodDelete, "/api/v1/ports/PLGDN", ratelimit.Write},
+		{http.MethodPost, "/admin/reload", ratelimit.Write},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		assert.Equal(t, test.budget, RateLimitBudget(r), "%s %s", test.method, test.path)
+	}
+}
+
+// TestStreamedBody tests for endpoints whose bodies are streamed.
+func TestStreamedBody(t *testing.T) {
+	require.True(t, StreamedBody(httptest.NewRequest(http.MethodPost, "/api/v1/ports:import", nil)))
+	require.False(t, StreamedBody(httptest.NewRequest(http.MethodPost, "/api/v1/ports/PLGDN", nil)))
+	require.False(t, StreamedBody(httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", nil)))
+}
+
+// TestSignedImport tests for imports which are signed with HMAC.
+func TestSignedImport(t *testing.T) {
+	stub := memory.NewPortMemory()
+	hmacKeys, err := auth.NewHMAC([]auth.HMACKey{{ID: "importer", Secret: "secret", Subject: "importer",
+		Role: auth.RoleAdmin}}, auth.HMACOptions{Streamed: StreamedBody})
+	require.NoError(t, err)
+	server := httptest.NewServer(auth.Middleware(auth.Options{
+		Authenticator: hmacKeys,
+		Required:      RequiredRole,
+		Logger:        logging.Discard(),
+	}, NewPortRouter(stub, DefaultOptions(), logging.Discard())))
+	defer server.Close()
+
+	// importPorts signs data, and sends other data when it is given.
+	importPorts := func(t *testing.T, data, other string) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+apiPorts+":import", // nolint: noctx
+			strings.NewReader(data))
+		require.NoError(t, err)
+		require.NoError(t, auth.SignRequest(req, "importer", "secret", time.Now()))
+		if len(other) > 0 {
+			req.Body = io.NopCloser(strings.NewReader(other))
+			req.ContentLength = int64(len(other))
+		}
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	signed := `{"PLGDN": { "name": "Gdansk", "country": "Poland", "coordinates": [18.6466, 54.352] }}`
+	tampered := `{"PLGDY": { "name": "Gdynia", "country": "Poland", "coordinates": [18.5305, 54.5189] }}`
+	require.Equal(t, http.StatusUnauthorized, importPorts(t, signed, tampered))
+	_, err = stub.Get(context.Background(), "PLGDY")
+	require.ErrorIs(t, err, ports.ErrPortNotFound, "port of a tampered import must not be stored")
+
+	require.Equal(t, http.StatusOK, importPorts(t, signed, ""))
+	_, err = stub.Get(context.Background(), "PLGDN")
+	require.NoError(t, err)
+}
+
+// TestBundledSeedFile tests that every port of the bundled seed file is valid, so none is skipped at startup.
+func TestBundledSeedFile(t *testing.T) {
+	file, err := os.Open("../../../../assets/ports.json")
+	require.NoError(t, err)
+	defer file.Close()
+
+	channel := make(chan ports.PortWithID)
+	go func() {
+		for range channel {
+		}
+	}()
+	defer close(channel)
+
+	summary, err := ports.ReadPortsWithOptions(context.Background(), file, channel, ports.ReadOptions{
+		Mode:      ports.ReadStrict,
+		Normalize: NormalizePort,
+		Validate:  ValidatePort,
+	})
+	require.NoError(t, err)
+	require.Empty(t, summary.Rejected)
+	require.Greater(t, summary.Read, 1000)
+}
@@ -0,0 +1,112 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/problem"
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// ImportPorts is an HTTP handler which imports ports from a body in the same format as `ports.json` file.
+// A body is streamed into a port's service, so it is never kept in memory as a whole.
+// Query parameter `mode` is `create` (default), `upsert` or `replace`, and a response is a report for every port.
+// Query parameter `validation` is `lenient` (default), or `strict` which stops an import at the first failed port.
+func (pr *portRouter) ImportPorts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	mode := ports.ImportMode(query.Get("mode"))
+	if len(mode) > 0 && !mode.Valid() {
+		problem.Error(w, r, fmt.Sprintf("import mode \"%s\" is not supported", mode), http.StatusBadRequest)
+		return
+	}
+
+	readMode := ports.ReadMode(query.Get("validation"))
+	if len(readMode) > 0 && !readMode.Valid() {
+		problem.Error(w, r, fmt.Sprintf("validation mode \"%s\" is not supported", readMode), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	report, err := ports.Import(r.Context(), pr.svc, r.Body, ports.ImportOptions{
+		Mode:      mode,
+		Normalize: NormalizePort,
+		Validate:  ValidatePort,
+		ReadMode:  readMode,
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			// A client is gone, so a response is not needed.
+			return
+		}
+
+		pr.logger.WarnContext(r.Context(), "failed to import ports", "error", err)
+		status = http.StatusBadRequest
+	}
+
+	b, err := json.Marshal(convertToAPIImportReport(report, err))
+	if err != nil {
+		pr.logger.ErrorContext(r.Context(), "failed to marshal import report", "error", err)
+		problem.Error(w, r, "failed to serialize import report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		pr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// NormalizePort normalizes texts of a port the same way as texts of a port which is created through API.
+func NormalizePort(port ports.Port) ports.Port {
+	return convertFromAPIPort(ConvertToAPIPort(port).Normalize())
+}
+
+// ValidatePort checks a port with its ID the same way as a port which is created through API.
+// A port must be normalized by NormalizePort first.
+func ValidatePort(port ports.PortWithID) error {
+	if len(port.ID) == 0 {
+		return errors.New("id of a port must be provided")
+	}
+
+	if _, ok := reservedIDs[port.ID]; ok {
+		return fmt.Errorf("id \"%s\" of a port is reserved", port.ID)
+	}
+
+	return ConvertToAPIPort(port.Port).Validate()
+}
+
+// convertToAPIImportReport converts internal import report to client API structure.
+// An import error is added to a report, because ports which are reported so far have been imported anyway.
+func convertToAPIImportReport(report ports.ImportReport, importErr error) api.ImportReport {
+	apiReport := api.ImportReport{
+		Created: emptyIfNil(report.Created),
+		Updated: emptyIfNil(report.Updated),
+		Skipped: emptyIfNil(report.Skipped),
+		Deleted: emptyIfNil(report.Deleted),
+		Failed:  make([]api.ImportFailure, 0, len(report.Failed)),
+	}
+	for _, failure := range report.Failed {
+		apiReport.Failed = append(apiReport.Failed, api.ImportFailure{ID: failure.ID, Error: failure.Err.Error()})
+	}
+
+	if importErr != nil {
+		apiReport.Error = importErr.Error()
+	}
+
+	return apiReport
+}
+
+// emptyIfNil returns an empty list for nil, so a client always gets a JSON array.
+func emptyIfNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
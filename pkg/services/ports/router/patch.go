@@ -0,0 +1,164 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+const (
+	// mergePatchContentType is a content type of JSON Merge Patch (RFC 7396).
+	mergePatchContentType = "application/merge-patch+json"
+	// jsonPatchContentType is a content type of JSON Patch (RFC 6902).
+	jsonPatchContentType = "application/json-patch+json"
+)
+
+// unsupportedMediaTypeError is returned when a patch's content type is not supported.
+type unsupportedMediaTypeError struct {
+	contentType string
+}
+
+func (e unsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("content type \"%s\" is not supported, use \"%s\" or \"%s\"",
+		e.contentType, mergePatchContentType, jsonPatchContentType)
+}
+
+// invalidPatchError is returned when a patch can not be applied to a port, or a patched port is not valid.
+type invalidPatchError struct {
+	err error
+	// conflict is true when `test` operation of a patch fails for a current state of a port. Other operations
+	// which can not be applied are invalid.
+	conflict bool
+}
+
+func (e invalidPatchError) Error() string {
+	return e.err.Error()
+}
+
+func (e invalidPatchError) Unwrap() error {
+	return e.err
+}
+
+// portPatch is a parsed patch of one of the supported types.
+type portPatch struct {
+	// merge is JSON Merge Patch document.
+	merge []byte
+	// operations is JSON Patch document.
+	operations jsonpatch.Patch
+}
+
+// parsePatch parses a patch according to request's content type. A body is not read beyond maxBytes,
+// unless it is zero.
+func parsePatch(r *http.Request, maxBytes int64) (portPatch, error) {
+	var patch portPatch
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != mergePatchContentType && contentType != jsonPatchContentType) {
+		return patch, unsupportedMediaTypeError{contentType: r.Header.Get("Content-Type")}
+	}
+
+	reader := r.Body
+	if maxBytes > 0 {
+		reader = http.MaxBytesReader(nil, r.Body, maxBytes)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return patch, err
+	}
+
+	if contentType == jsonPatchContentType {
+		patch.operations, err = jsonpatch.DecodePatch(body)
+		return patch, err
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return patch, errors.New("merge patch must be a JSON object")
+	}
+	patch.merge = body
+
+	return patch, nil
+}
+
+// patchDocument is a port which is patched. Unlike api.Port, it has empty fields as well, so JSON Patch can
+// replace or test a field which a port does not have, and add to its empty lists.
+type patchDocument struct {
+	Alias       []string  `json:"alias"`
+	City        string    `json:"city"`
+	Code        string    `json:"code"`
+	Coordinates []float64 `json:"coordinates"`
+	Country     string    `json:"country"`
+	Name        string    `json:"name"`
+	Province    string    `json:"province"`
+	Regions     []string  `json:"regions"`
+	Timezone    string    `json:"timezone"`
+	Unlocs      []string  `json:"unlocs"`
+}
+
+// newPatchDocument returns a document of a port with empty lists instead of null ones.
+func newPatchDocument(port ports.Port) patchDocument {
+	document := patchDocument(ConvertToAPIPort(port))
+	for _, list := range []*[]string{&document.Alias, &document.Regions, &document.Unlocs} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	if document.Coordinates == nil {
+		document.Coordinates = []float64{}
+	}
+
+	return document
+}
+
+// applyOperations applies operations of JSON Patch one by one, so only a failed `test` operation is
+// a conflict.
+func applyOperations(document []byte, operations jsonpatch.Patch) ([]byte, error) {
+	for _, operation := range operations {
+		var err error
+		if document, err = (jsonpatch.Patch{operation}).Apply(document); err != nil {
+			return nil, invalidPatchError{err: err, conflict: operation.Kind() == "test"}
+		}
+	}
+
+	return document, nil
+}
+
+// applyPatch applies a patch to a port, and validates the result. When it is strict, a patched port must not
+// have unknown fields, so a mistyped field is not dropped silently.
+func applyPatch(port ports.Port, patch portPatch, strict bool) (ports.Port, error) {
+	original, err := json.Marshal(newPatchDocument(port))
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	var patched []byte
+	if patch.operations != nil {
+		if patched, err = applyOperations(original, patch.operations); err != nil {
+			return ports.Port{}, err
+		}
+	} else if patched, err = jsonpatch.MergePatch(original, patch.merge); err != nil {
+		return ports.Port{}, invalidPatchError{err: err}
+	}
+
+	var apiPort api.Port
+	if err := decodeJSON(bytes.NewReader(patched), strict, &apiPort); err != nil {
+		return ports.Port{}, invalidPatchError{err: fmt.Errorf("patched port is not valid: %w", err)}
+	}
+
+	apiPort = apiPort.Normalize()
+	if err := apiPort.Validate(); err != nil {
+		return ports.Port{}, invalidPatchError{err: err}
+	}
+
+	return convertFromAPIPort(apiPort), nil
+}
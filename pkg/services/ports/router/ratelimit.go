@@ -0,0 +1,24 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/informalict/ports/pkg/auth"
+	"github.com/informalict/ports/pkg/ratelimit"
+)
+
+// RateLimitBudget returns a budget of a request to the ports server. Endpoints which are public according to
+// RequiredRole, such as probes and metrics, are not limited. Reads have their own budget, so a client which floods
+// writes can still read.
+func RateLimitBudget(r *http.Request) ratelimit.Budget {
+	if RequiredRole(r) == auth.RoleNone {
+		return ratelimit.Unlimited
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ratelimit.Read
+	default:
+		return ratelimit.Write
+	}
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/problem"
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// watchKeepAlive is how often a comment is sent over an idle stream, so proxies do not close it.
+const watchKeepAlive = 15 * time.Second
+
+// WatchPorts is an HTTP handler which streams changes of ports as Server-Sent Events. Every event has a revision
+// of a change as its ID and an action as its type. A stream resumes after a revision from `Last-Event-ID` header,
+// or from `fromRevision` query parameter, and 410 is returned when changes after it are not kept anymore.
+// Changes are filtered by `country` and `idPrefix` query parameters. A stream is closed when a client does not
+// receive changes fast enough, and the client should reconnect then.
+func (pr *portRouter) WatchPorts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	watcher, ok := pr.svc.(ports.Watcher)
+	if !ok {
+		problem.Error(w, r, ports.ErrWatchNotSupported.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	from := query.Get("fromRevision")
+	if lastEventID := r.Header.Get("Last-Event-ID"); len(lastEventID) > 0 {
+		from = lastEventID
+	}
+	var fromRevision uint64
+	if len(from) > 0 {
+		var err error
+		if fromRevision, err = strconv.ParseUint(from, 10, 64); err != nil {
+			problem.Error(w, r, "revision to watch from must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	filter := ports.WatchFilter{Country: query.Get("country"), IDPrefix: query.Get("idPrefix")}
+
+	events, err := watcher.Watch(r.Context(), fromRevision)
+	if err != nil {
+		switch {
+		case errors.Is(err, ports.ErrRevisionCompacted):
+			problem.Error(w, r, err.Error(), http.StatusGone)
+		case errors.Is(err, ports.ErrWatchNotSupported):
+			problem.Error(w, r, err.Error(), http.StatusNotImplemented)
+		default:
+			pr.logger.ErrorContext(r.Context(), "failed to watch ports", "error", err)
+			problem.Error(w, r, "failed to watch ports", http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.Match(event) {
+				continue
+			}
+			err = writeWatchEvent(w, event)
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		}
+
+		if err != nil {
+			pr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+			return
+		}
+		flush(w)
+	}
+}
+
+// EncodeWatchEvent returns JSON of a change of a port, which is sent to watchers and webhooks.
+func EncodeWatchEvent(event ports.WatchEvent) ([]byte, error) {
+	return json.Marshal(convertToAPIWatchEvent(event))
+}
+
+// convertToAPIWatchEvent converts internal change structure to client api structure.
+func convertToAPIWatchEvent(event ports.WatchEvent) api.WatchEvent {
+	port := ConvertToAPIPort(event.Port)
+
+	return api.WatchEvent{
+		ID:       event.PortID,
+		Action:   string(event.Action),
+		Revision: event.Revision,
+		Port:     &port,
+	}
+}
+
+// writeWatchEvent writes a change of a port as a single Server-Sent Event.
+func writeWatchEvent(w http.ResponseWriter, event ports.WatchEvent) error {
+	b, err := EncodeWatchEvent(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Revision, event.Action, b)
+
+	return err
+}
+
+// flush sends buffered data to a client when a response writer supports it.
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
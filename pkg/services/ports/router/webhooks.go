@@ -0,0 +1,188 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	api "github.com/informalict/ports/api/v1"
+	"github.com/informalict/ports/pkg/problem"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/webhook"
+)
+
+// Webhooks manages subscriptions of webhooks.
+type Webhooks interface {
+	// Subscribe creates a subscription, and it returns the subscription with its ID and secret.
+	Subscribe(subscription webhook.Subscription) (webhook.Subscription, error)
+	// Unsubscribe removes a subscription.
+	Unsubscribe(ID string) error
+	// Subscription returns a subscription with a given ID.
+	Subscription(ID string) (webhook.Subscription, error)
+	// Subscriptions returns all subscriptions.
+	Subscriptions() []webhook.Subscription
+	// DeadLetters returns changes which have not been delivered to a subscription.
+	DeadLetters(ID string) ([]webhook.DeadLetter, error)
+}
+
+// webhookRouter describes HTTP router for subscriptions of webhooks.
+type webhookRouter struct {
+	webhooks Webhooks
+	options  Options
+	logger   *slog.Logger
+}
+
+// NewWebhookRouter returns a new router for subscriptions of webhooks. Webhooks are nil when a port's service
+// can not be watched, and then every request is rejected with 501, so nobody subscribes to changes which are
+// never sent.
+func NewWebhookRouter(webhooks Webhooks, options Options, logger *slog.Logger) http.Handler {
+	wr := &webhookRouter{
+		webhooks: webhooks,
+		options:  options,
+		logger:   logger,
+	}
+
+	router := newRouter()
+	router.RedirectTrailingSlash = false
+	handleWebhooks := func(method, path string, handler httprouter.Handle) {
+		if webhooks == nil {
+			handler = watchNotSupported
+		}
+		handle(router, method, apiV1Prefix+path, handler)
+	}
+	handleWebhooks(http.MethodGet, "webhooks", wr.ListWebhooks)
+	handleWebhooks(http.MethodPost, "webhooks", wr.CreateWebhook)
+	handleWebhooks(http.MethodGet, "webhooks/:id", wr.GetWebhook)
+	handleWebhooks(http.MethodDelete, "webhooks/:id", wr.DeleteWebhook)
+	handleWebhooks(http.MethodGet, "webhooks/:id/deadLetters", wr.ListDeadLetters)
+
+	return router
+}
+
+// watchNotSupported is an HTTP handler which rejects requests, because changes of ports can not be watched.
+func watchNotSupported(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	problem.Error(w, r, ports.ErrWatchNotSupported.Error(), http.StatusNotImplemented)
+}
+
+// CreateWebhook is an HTTP handler which creates a subscription. The response is the only one with its secret.
+func (wr *webhookRouter) CreateWebhook(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request api.Webhook
+	if err := decodeJSONBody(r, wr.options, &request); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	subscription, err := wr.webhooks.Subscribe(webhook.Subscription{
+		URL:    request.URL,
+		Secret: request.Secret,
+		Filter: ports.WatchFilter{Country: request.Country, IDPrefix: request.IDPrefix},
+	})
+	if err != nil {
+		if errors.Is(err, webhook.ErrInvalidSubscription) {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		wr.logger.ErrorContext(r.Context(), "failed to create webhook", "error", err)
+		problem.Error(w, r, "failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	created := convertToAPIWebhook(subscription)
+	created.Secret = subscription.Secret
+	wr.write(w, r, http.StatusCreated, created)
+}
+
+// ListWebhooks is an HTTP handler which returns all subscriptions without their secrets.
+func (wr *webhookRouter) ListWebhooks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	subscriptions := wr.webhooks.Subscriptions()
+	list := api.WebhookList{Webhooks: make([]api.Webhook, 0, len(subscriptions))}
+	for _, subscription := range subscriptions {
+		list.Webhooks = append(list.Webhooks, convertToAPIWebhook(subscription))
+	}
+
+	wr.write(w, r, http.StatusOK, list)
+}
+
+// GetWebhook is an HTTP handler which returns a subscription without its secret.
+func (wr *webhookRouter) GetWebhook(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	subscription, err := wr.webhooks.Subscription(p.ByName("id"))
+	if err != nil {
+		wr.writeSubscriptionError(w, r, err, "failed to get webhook")
+		return
+	}
+
+	wr.write(w, r, http.StatusOK, convertToAPIWebhook(subscription))
+}
+
+// DeleteWebhook is an HTTP handler which removes a subscription. Its queued changes are not delivered.
+func (wr *webhookRouter) DeleteWebhook(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if err := wr.webhooks.Unsubscribe(p.ByName("id")); err != nil {
+		wr.writeSubscriptionError(w, r, err, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeadLetters is an HTTP handler which returns changes which have not been delivered to a subscription.
+func (wr *webhookRouter) ListDeadLetters(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	deadLetters, err := wr.webhooks.DeadLetters(p.ByName("id"))
+	if err != nil {
+		wr.writeSubscriptionError(w, r, err, "failed to list dead letters")
+		return
+	}
+
+	list := api.DeadLetterList{DeadLetters: make([]api.DeadLetter, 0, len(deadLetters))}
+	for _, letter := range deadLetters {
+		list.DeadLetters = append(list.DeadLetters, api.DeadLetter{
+			Event:    convertToAPIWatchEvent(letter.Event),
+			Attempts: letter.Attempts,
+			Error:    letter.Error,
+			FailedAt: letter.FailedAt,
+		})
+	}
+
+	wr.write(w, r, http.StatusOK, list)
+}
+
+// writeSubscriptionError sends 404 when a subscription does not exist, or logs an error and sends 500.
+func (wr *webhookRouter) writeSubscriptionError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, webhook.ErrSubscriptionNotFound) {
+		problem.Error(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	wr.logger.ErrorContext(r.Context(), message, "error", err)
+	problem.Error(w, r, message, http.StatusInternalServerError)
+}
+
+// write sends a JSON response.
+func (wr *webhookRouter) write(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		wr.logger.ErrorContext(r.Context(), "failed to marshal response", "error", err)
+		problem.Error(w, r, "failed to serialize response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		wr.logger.DebugContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+// convertToAPIWebhook converts a subscription to client api structure without its secret.
+func convertToAPIWebhook(subscription webhook.Subscription) api.Webhook {
+	return api.Webhook{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Country:   subscription.Filter.Country,
+		IDPrefix:  subscription.Filter.IDPrefix,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
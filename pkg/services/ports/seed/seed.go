@@ -0,0 +1,251 @@
+// Package seed loads ports from a seed file into a port's service, and it reloads them when the file is changed.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// readBuffer describes how many ports are read ahead of a port's service.
+const readBuffer = 10
+
+// RemovePolicy describes what happens with ports which are removed from a seed file.
+type RemovePolicy string
+
+const (
+	// RemoveKeep keeps removed ports in a port's service.
+	RemoveKeep RemovePolicy = "keep"
+	// RemoveDelete deletes removed ports from a port's service.
+	RemoveDelete RemovePolicy = "delete"
+)
+
+// Valid checks whether a remove policy is supported.
+func (p RemovePolicy) Valid() bool {
+	return p == RemoveKeep || p == RemoveDelete
+}
+
+// Options describes how ports are loaded from a seed file.
+type Options struct {
+	// File is a path to a file in the same format as `assets/ports.json`.
+	File string
+	// LoadMode describes what happens with invalid ports: they are skipped in ports.ReadLenient mode, and
+	// in ports.ReadStrict mode they stop loading, or a reload does not change anything.
+	LoadMode ports.ReadMode
+	// Normalize is applied to every port from a file before it is validated.
+	Normalize func(port ports.Port) ports.Port
+	// Validate checks every port from a file.
+	Validate func(port ports.PortWithID) error
+	// Removed describes what happens with ports which are removed from a file. RemoveKeep is used when it is empty.
+	Removed RemovePolicy
+	// OnPort is called for every port from a file when it is applied, with an error when a port is invalid,
+	// or when it has not been stored. It is optional, and it is called concurrently.
+	OnPort func(ID string, err error)
+}
+
+// Seed loads ports from a seed file, and it remembers them, so a reload changes only ports which have been changed
+// in the file. Ports which have been changed through API, but not in the file, are not overwritten by a reload.
+type Seed struct {
+	svc     ports.PortService
+	options Options
+
+	// mutex allows only one load at a time.
+	mutex sync.Mutex
+	// loaded contains fingerprints of ports from the last loaded file by their IDs.
+	loaded map[string]uint64
+}
+
+// New creates a seed of a port's service.
+func New(svc ports.PortService, options Options) *Seed {
+	if len(options.Removed) == 0 {
+		options.Removed = RemoveKeep
+	}
+
+	return &Seed{
+		svc:     svc,
+		options: options,
+		loaded:  make(map[string]uint64),
+	}
+}
+
+// Load creates ports from a seed file. Ports which already exist are skipped, because a persistent storage may have
+// them changed through API. Invalid ports are skipped in ports.ReadLenient mode, and they stop loading
+// in ports.ReadStrict mode.
+func (s *Seed) Load(ctx context.Context) (ports.ImportReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.options.File)
+	if err != nil {
+		return ports.ImportReport{}, err
+	}
+	defer file.Close()
+
+	loaded := make(map[string]uint64)
+	create := func(port ports.PortWithID, report *ports.ImportReport) error {
+		loaded[port.ID] = fingerprint(port.Port)
+		err := s.svc.Create(ctx, port.ID, port.Port)
+		if errors.Is(err, ports.ErrPortAlreadyExist) {
+			report.Skipped = append(report.Skipped, port.ID)
+			return nil
+		}
+		if err == nil {
+			report.Created = append(report.Created, port.ID)
+		}
+
+		return err
+	}
+	report, err := s.apply(ctx, file, s.options.LoadMode, true, create)
+	s.loaded = loaded
+
+	return report, err
+}
+
+// Reload applies changes of a seed file since it has been loaded last time: new ports are created, changed ports
+// are updated, and removed ports are handled by a remove policy. Ports which have not been changed in the file
+// are skipped. Nothing is changed when a file is malformed, or when it contains any invalid port
+// in ports.ReadStrict mode. Invalid ports are skipped in ports.ReadLenient mode, and they are not deleted.
+// Ports are changed one by one, so a port's service serves requests during a reload.
+func (s *Seed) Reload(ctx context.Context) (ports.ImportReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.options.File)
+	if err != nil {
+		return ports.ImportReport{}, err
+	}
+	defer file.Close()
+
+	// The first pass only validates a file. A file is read through the same descriptor twice, so it is not changed
+	// between passes when it is replaced by a new file.
+	loaded := make(map[string]uint64)
+	_, err = s.apply(ctx, file, s.options.LoadMode, false, func(port ports.PortWithID, _ *ports.ImportReport) error {
+		loaded[port.ID] = fingerprint(port.Port)
+		return nil
+	})
+	if err != nil {
+		return ports.ImportReport{}, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return ports.ImportReport{}, err
+	}
+
+	upsert := func(port ports.PortWithID, report *ports.ImportReport) error {
+		if previous, ok := s.loaded[port.ID]; ok && previous == loaded[port.ID] {
+			report.Skipped = append(report.Skipped, port.ID)
+			return nil
+		}
+
+		result, err := ports.Upsert(ctx, s.svc, port.ID, port.Port)
+		if err != nil {
+			return err
+		}
+		report.Add(port.ID, result)
+
+		return nil
+	}
+	report, err := s.apply(ctx, file, s.options.LoadMode, true, upsert)
+	if err != nil {
+		return report, err
+	}
+
+	// Failed and invalid ports are remembered in their previous versions, so they are applied again by a next reload,
+	// and they are not deleted.
+	for _, failure := range report.Failed {
+		if previous, ok := s.loaded[failure.ID]; ok {
+			loaded[failure.ID] = previous
+		} else {
+			delete(loaded, failure.ID)
+		}
+	}
+
+	if s.options.Removed == RemoveDelete {
+		for ID := range s.loaded {
+			if _, ok := loaded[ID]; ok {
+				continue
+			}
+
+			err := s.svc.Delete(ctx, ID)
+			switch {
+			case errors.Is(err, ports.ErrPortNotFound):
+				// A port has been already deleted through API.
+			case err != nil:
+				report.Failed = append(report.Failed, ports.ImportFailure{ID: ID, Err: err})
+			default:
+				report.Deleted = append(report.Deleted, ID)
+			}
+		}
+	}
+	s.loaded = loaded
+
+	return report, nil
+}
+
+// apply reads ports from a reader, and calls a function for every valid port.
+// A port is reported as failed when a function returns an error. Options.OnPort is called when progress is reported.
+func (s *Seed) apply(
+	ctx context.Context, reader io.Reader, mode ports.ReadMode, progress bool,
+	f func(port ports.PortWithID, report *ports.ImportReport) error,
+) (ports.ImportReport, error) {
+	onPort := s.options.OnPort
+	if !progress || onPort == nil {
+		onPort = func(string, error) {}
+	}
+
+	var report ports.ImportReport
+
+	type readResult struct {
+		summary ports.ReadSummary
+		err     error
+	}
+	channel := make(chan ports.PortWithID, readBuffer)
+	read := make(chan readResult, 1)
+	go func() {
+		summary, err := ports.ReadPortsWithOptions(ctx, reader, channel, ports.ReadOptions{
+			Mode:      mode,
+			Normalize: s.options.Normalize,
+			Validate:  s.options.Validate,
+			OnError: func(err *ports.ReadError) {
+				onPort(err.ID, err)
+			},
+		})
+		read <- readResult{summary: summary, err: err}
+		close(channel)
+	}()
+
+	for port := range channel {
+		err := f(port, &report)
+		if err != nil {
+			report.Failed = append(report.Failed, ports.ImportFailure{ID: port.ID, Err: err})
+		}
+		onPort(port.ID, err)
+	}
+
+	result := <-read
+	for _, rejected := range result.summary.Rejected {
+		report.Failed = append(report.Failed, ports.ImportFailure{ID: rejected.ID, Err: rejected})
+	}
+
+	if result.err != nil {
+		return report, fmt.Errorf("failed to read seed file: %w", result.err)
+	}
+
+	return report, nil
+}
+
+// fingerprint returns a hash of a port, so ports from a file are remembered without keeping them in memory.
+func fingerprint(port ports.Port) uint64 {
+	b, _ := json.Marshal(port) // nolint: errchkjson
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+
+	return h.Sum64()
+}
@@ -0,0 +1,173 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/memory"
+)
+
+func TestSeed(t *testing.T) { // nolint: funlen
+	ctx := context.Background()
+	validate := func(port ports.PortWithID) error {
+		if len(port.Name) == 0 {
+			return errors.New("name can not be empty")
+		}
+		return nil
+	}
+
+	// newSeed loads a seed file with ports which are changed by the test.
+	newSeed := func(t *testing.T, mode ports.ReadMode, removed RemovePolicy) (*Seed, ports.PortService, string) {
+		path := filepath.Join(t.TempDir(), "ports.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"API": { "name": "api" },
+			"CHANGED": { "name": "changed" },
+			"REMOVED": { "name": "removed" },
+			"SAME": { "name": "same" }
+		}`), 0o600))
+
+		svc := memory.NewPortMemory()
+		// A port which exists before the first load is not overwritten.
+		require.NoError(t, svc.Create(ctx, "SAME", ports.Port{Name: "existing"}))
+
+		s := New(svc, Options{File: path, LoadMode: mode, Validate: validate, Removed: removed})
+		report, err := s.Load(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"API", "CHANGED", "REMOVED"}, report.Created)
+		require.Equal(t, []string{"SAME"}, report.Skipped)
+
+		// A port which is changed through API.
+		require.NoError(t, svc.Update(ctx, "API", ports.Port{Name: "changed through api"}))
+
+		return s, svc, path
+	}
+
+	requireName := func(t *testing.T, svc ports.PortService, ID, name string) {
+		port, err := svc.Get(ctx, ID)
+		require.NoError(t, err)
+		require.Equal(t, name, port.Name)
+	}
+
+	newFile := []byte(`{
+		"API": { "name": "api" },
+		"CHANGED": { "name": "changed in file" },
+		"SAME": { "name": "same" },
+		"NEW": { "name": "new" }
+	}`)
+
+	t.Run("reload keeps removed ports", func(t *testing.T) {
+		s, svc, path := newSeed(t, ports.ReadLenient, "")
+		require.NoError(t, os.WriteFile(path, newFile, 0o600))
+
+		report, err := s.Reload(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"NEW"}, report.Created)
+		require.Equal(t, []string{"CHANGED"}, report.Updated)
+		require.Equal(t, []string{"API", "SAME"}, report.Skipped)
+		require.Empty(t, report.Deleted)
+
+		requireName(t, svc, "API", "changed through api")
+		requireName(t, svc, "CHANGED", "changed in file")
+		requireName(t, svc, "SAME", "existing")
+		requireName(t, svc, "NEW", "new")
+		requireName(t, svc, "REMOVED", "removed")
+
+		// Nothing is changed when a file is the same.
+		report, err = s.Reload(ctx)
+		require.NoError(t, err)
+		require.Empty(t, report.Created)
+		require.Empty(t, report.Updated)
+		require.Len(t, report.Skipped, 4)
+	})
+
+	t.Run("reload deletes removed ports", func(t *testing.T) {
+		s, svc, path := newSeed(t, ports.ReadStrict, RemoveDelete)
+		require.NoError(t, os.WriteFile(path, newFile, 0o600))
+
+		report, err := s.Reload(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"REMOVED"}, report.Deleted)
+		_, err = svc.Get(ctx, "REMOVED")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+	})
+
+	t.Run("invalid file is not applied", func(t *testing.T) {
+		s, svc, path := newSeed(t, ports.ReadStrict, RemoveDelete)
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"CHANGED": { "name": "changed in file" },
+			"NEW": { "name": "new" },
+			"INVALID": { "name": "" }
+		}`), 0o600))
+
+		_, err := s.Reload(ctx)
+		var readErr *ports.ReadError
+		require.ErrorAs(t, err, &readErr)
+		require.Equal(t, "INVALID", readErr.ID)
+
+		requireName(t, svc, "CHANGED", "changed")
+		requireName(t, svc, "REMOVED", "removed")
+		_, err = svc.Get(ctx, "NEW")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+
+		// The previous file is still remembered, so a valid file is applied as a diff against it.
+		require.NoError(t, os.WriteFile(path, newFile, 0o600))
+		report, err := s.Reload(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []string{"CHANGED"}, report.Updated)
+		require.Equal(t, []string{"REMOVED"}, report.Deleted)
+	})
+
+	t.Run("invalid ports are skipped in lenient mode", func(t *testing.T) {
+		s, svc, path := newSeed(t, ports.ReadLenient, RemoveDelete)
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"CHANGED": { "name": "" },
+			"NEW": { "name": "new" }
+		}`), 0o600))
+
+		// Progress is reported only when ports are applied, and not when a file is validated.
+		var mutex sync.Mutex
+		progress := make(map[string]bool)
+		s.options.OnPort = func(ID string, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			require.NotContains(t, progress, ID)
+			progress[ID] = err == nil
+		}
+
+		report, err := s.Reload(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[string]bool{"CHANGED": false, "NEW": true}, progress)
+		require.Equal(t, []string{"NEW"}, report.Created)
+		require.Equal(t, []string{"API", "REMOVED", "SAME"}, sortedDeleted(report))
+		require.Len(t, report.Failed, 1)
+		require.Equal(t, "CHANGED", report.Failed[0].ID)
+		requireName(t, svc, "CHANGED", "changed")
+	})
+
+	t.Run("malformed file is not applied", func(t *testing.T) {
+		s, svc, path := newSeed(t, ports.ReadLenient, RemoveDelete)
+		require.NoError(t, os.WriteFile(path, []byte(`{ "NEW": { "name": "new" }, `), 0o600))
+
+		_, err := s.Reload(ctx)
+		require.Error(t, err)
+		_, err = svc.Get(ctx, "NEW")
+		require.ErrorIs(t, err, ports.ErrPortNotFound)
+		requireName(t, svc, "REMOVED", "removed")
+	})
+}
+
+// sortedDeleted returns deleted ports from a report in order, because they are deleted in random order.
+func sortedDeleted(report ports.ImportReport) []string {
+	deleted := append([]string(nil), report.Deleted...)
+	sort.Strings(deleted)
+
+	return deleted
+}
@@ -0,0 +1,94 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations are applied in order of their file names which start with a version number, e.g. `0001_create_ports.sql`.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate applies all migrations which have not been applied to a database yet.
+// Every migration is applied in a separate transaction together with its version.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	row := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	if err := row.Scan(&current); err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		version, err := migrationVersion(name)
+		if err != nil {
+			return err
+		}
+		if version <= current {
+			continue
+		}
+
+		query, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		if err := applyMigration(ctx, db, version, string(query)); err != nil {
+			return fmt.Errorf("failed to apply migration \"%s\": %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration executes a migration and stores its version.
+func applyMigration(ctx context.Context, db *sql.DB, version int, query string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrationVersion returns version from a migration's file name.
+func migrationVersion(name string) (int, error) {
+	base := strings.TrimPrefix(name, "migrations/")
+	prefix, _, found := strings.Cut(base, "_")
+	if !found {
+		return 0, fmt.Errorf("migration \"%s\" must start with a version", name)
+	}
+
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("migration \"%s\" must start with a version: %w", name, err)
+	}
+
+	return version, nil
+}
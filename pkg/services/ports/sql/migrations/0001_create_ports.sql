@@ -0,0 +1,14 @@
+-- Lists and coordinates are stored as JSON arrays, so they are read back exactly as they have been written.
+CREATE TABLE ports (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    city        TEXT NOT NULL DEFAULT '',
+    country     TEXT NOT NULL DEFAULT '',
+    province    TEXT NOT NULL DEFAULT '',
+    timezone    TEXT NOT NULL DEFAULT '',
+    code        TEXT NOT NULL DEFAULT '',
+    coordinates TEXT NOT NULL DEFAULT '[]',
+    alias       TEXT NOT NULL DEFAULT '[]',
+    regions     TEXT NOT NULL DEFAULT '[]',
+    unlocs      TEXT NOT NULL DEFAULT '[]'
+);
@@ -0,0 +1,8 @@
+-- Revisions grow across all ports, so the last one is kept in a table with a single row.
+CREATE TABLE port_revision (
+    id       INTEGER PRIMARY KEY CHECK (id = 1),
+    revision BIGINT NOT NULL
+);
+INSERT INTO port_revision (id, revision) VALUES (1, 1);
+
+ALTER TABLE ports ADD COLUMN revision BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,492 @@
+// Package sql provides port's storage in a SQL database.
+//
+// Queries are written in SQL which is understood by both PostgreSQL and SQLite,
+// so the same storage works with any of them. A database driver must be registered by a caller.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+const (
+	// pgUniqueViolation is PostgreSQL error code for a violation of a unique constraint.
+	pgUniqueViolation = "23505"
+	// sqlitePrimaryKeyViolation is SQLite extended error code for a violation of a primary key constraint.
+	sqlitePrimaryKeyViolation = 1555
+	// sqliteUniqueViolation is SQLite extended error code for a violation of a unique constraint.
+	sqliteUniqueViolation = 2067
+)
+
+// NewPortSQL opens a database with a given driver, and it applies migrations.
+func NewPortSQL(ctx context.Context, driverName, dataSourceName string) (*portSQL, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &portSQL{
+		db: db,
+	}, nil
+}
+
+type portSQL struct {
+	// db is a pool of connections to a database.
+	db *sql.DB
+}
+
+// portColumns are columns of a port in the same order as in portRow.scan.
+const portColumns = `name, city, country, province, timezone, code, coordinates, alias, regions, unlocs, revision`
+
+// Create creates a port in a database with a given port ID.
+func (p *portSQL) Create(ctx context.Context, ID string, port ports.Port) error {
+	_, err := p.CreateReturning(ctx, ID, port)
+
+	return err
+}
+
+// CreateReturning creates a port in a database with a given port ID, and it returns the stored port.
+func (p *portSQL) CreateReturning(ctx context.Context, ID string, port ports.Port) (ports.Port, error) {
+	row, err := newPortRow(port)
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	err = p.withRevision(ctx, func(tx *sql.Tx, revision uint64) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO ports (id, `+portColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			ID, row.name, row.city, row.country, row.province, row.timezone, row.code,
+			row.coordinates, row.alias, row.regions, row.unlocs, revision)
+		if err != nil {
+			return err
+		}
+		port.Revision = revision
+
+		return nil
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ports.Port{}, ports.ErrPortAlreadyExist
+		}
+
+		return ports.Port{}, fmt.Errorf("failed to insert port: %w", err)
+	}
+
+	return port, nil
+}
+
+// Get returns port for a given port's ID.
+func (p *portSQL) Get(ctx context.Context, ID string) (ports.Port, error) {
+	var row portRow
+	err := row.scan(p.db.QueryRowContext(ctx, `SELECT `+portColumns+` FROM ports WHERE id = $1`, ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ports.Port{}, ports.ErrPortNotFound
+		}
+
+		return ports.Port{}, fmt.Errorf("failed to select port: %w", err)
+	}
+
+	return row.port()
+}
+
+// Update updates an existing port.
+// When port does not exist then error is returned.
+func (p *portSQL) Update(ctx context.Context, ID string, port ports.Port) error {
+	_, err := p.update(ctx, ID, nil, port)
+
+	return err
+}
+
+// UpdateIfRevision updates an existing port only when it has a given revision.
+func (p *portSQL) UpdateIfRevision(ctx context.Context, ID string, revision uint64, port ports.Port) error {
+	_, err := p.update(ctx, ID, &revision, port)
+
+	return err
+}
+
+// Modify reads an existing port, modifies it and stores the result atomically.
+// A row is not locked. Instead, it is updated only when its revision has not been changed since it was read,
+// and otherwise it is read and modified again. It works the same in all databases.
+// When port does not exist then error is returned.
+func (p *portSQL) Modify(ctx context.Context, ID string, modify ports.ModifyFunc) (ports.Port, error) {
+	for {
+		previous, err := p.Get(ctx, ID)
+		if err != nil {
+			return ports.Port{}, err
+		}
+
+		port, err := modify(previous)
+		if err != nil {
+			return ports.Port{}, err
+		}
+
+		port, err = p.update(ctx, ID, &previous.Revision, port)
+		if !errors.Is(err, ports.ErrRevisionMismatch) {
+			return port, err
+		}
+		// A port has been changed by someone else in the meantime, so it is read again.
+	}
+}
+
+// Delete deletes an existing port.
+// When port does not exist then error is returned.
+func (p *portSQL) Delete(ctx context.Context, ID string) error {
+	_, err := p.DeleteReturning(ctx, ID)
+
+	return err
+}
+
+// DeleteReturning deletes an existing port, and it returns the deleted port.
+// When port does not exist then error is returned.
+func (p *portSQL) DeleteReturning(ctx context.Context, ID string) (ports.Port, error) {
+	var row portRow
+	err := p.withRevision(ctx, func(tx *sql.Tx, _ uint64) error {
+		err := row.scan(tx.QueryRowContext(ctx, `DELETE FROM ports WHERE id = $1 RETURNING `+portColumns, ID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ports.ErrPortNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to delete port: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	return row.port()
+}
+
+// update updates an existing port with a next revision, and returns it.
+// When an expected revision is provided, then a port is updated only when it has this revision.
+func (p *portSQL) update(ctx context.Context, ID string, expected *uint64, port ports.Port) (ports.Port, error) {
+	row, err := newPortRow(port)
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	err = p.withRevision(ctx, func(tx *sql.Tx, revision uint64) error {
+		query := `UPDATE ports SET name = $2, city = $3, country = $4, province = $5, timezone = $6, code = $7,
+			coordinates = $8, alias = $9, regions = $10, unlocs = $11, revision = $12
+			WHERE id = $1`
+		args := []any{ID, row.name, row.city, row.country, row.province, row.timezone, row.code,
+			row.coordinates, row.alias, row.regions, row.unlocs, revision}
+		if expected != nil {
+			query += ` AND revision = $13`
+			args = append(args, *expected)
+		}
+
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to update port: %w", err)
+		}
+
+		if err := requireRow(result, ports.ErrPortNotFound); err != nil {
+			if expected == nil {
+				return err
+			}
+
+			// A port exists, but it has a different revision.
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ports WHERE id = $1)`, ID).
+				Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				return ports.ErrRevisionMismatch
+			}
+
+			return ports.ErrPortNotFound
+		}
+
+		port.Revision = revision
+
+		return nil
+	})
+	if err != nil {
+		return ports.Port{}, err
+	}
+
+	return port, nil
+}
+
+// withRevision calls a function in a transaction with a next revision.
+// The revision is used only when the function succeeds, and the transaction is committed.
+func (p *portSQL) withRevision(ctx context.Context, f func(tx *sql.Tx, revision uint64) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	var revision uint64
+	if err := tx.QueryRowContext(ctx,
+		`UPDATE port_revision SET revision = revision + 1 WHERE id = 1 RETURNING revision`).Scan(&revision); err != nil {
+		return fmt.Errorf("failed to get next revision: %w", err)
+	}
+
+	if err := f(tx, revision); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// requireRow returns a given error when no row has been changed.
+func requireRow(result sql.Result, err error) error {
+	changed, resultErr := result.RowsAffected()
+	if resultErr != nil {
+		return resultErr
+	}
+
+	if changed == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// Count returns a number of ports in a database.
+func (p *portSQL) Count(ctx context.Context) (int, error) {
+	var count int
+	if err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ports`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count ports: %w", err)
+	}
+
+	return count, nil
+}
+
+// sortColumns maps sort fields to columns.
+var sortColumns = map[ports.SortField]string{
+	ports.SortByID:       "id",
+	ports.SortByName:     "name",
+	ports.SortByCountry:  "country",
+	ports.SortByProvince: "province",
+	ports.SortByCity:     "city",
+}
+
+// List returns a page of ports which match given options.
+// Ports are paginated by a key of the last port, so a database can use an index instead of skipping rows.
+func (p *portSQL) List(ctx context.Context, options ports.ListOptions) (ports.PortList, error) {
+	options = options.Normalize()
+	column, ok := sortColumns[options.SortBy]
+	if !ok {
+		return ports.PortList{}, ports.ErrInvalidSortField
+	}
+
+	var conditions []string
+	var args []any
+	addCondition := func(condition string, arg ...any) {
+		for _, a := range arg {
+			args = append(args, a)
+			condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	filter := options.Filter
+	if len(filter.Country) > 0 {
+		addCondition("LOWER(country) = LOWER(?)", filter.Country)
+	}
+	if len(filter.Province) > 0 {
+		addCondition("LOWER(province) = LOWER(?)", filter.Province)
+	}
+	if len(filter.City) > 0 {
+		addCondition("LOWER(city) = LOWER(?)", filter.City)
+	}
+	if len(filter.NamePrefix) > 0 {
+		addCondition(`LOWER(name) LIKE ? ESCAPE '\'`, escapeLike(strings.ToLower(filter.NamePrefix))+"%")
+	}
+	if len(filter.NameContains) > 0 {
+		addCondition(`LOWER(name) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.NameContains))+"%")
+	}
+
+	order := "ASC"
+	if options.Descending {
+		order = "DESC"
+	}
+
+	if len(options.Cursor) > 0 {
+		cursor, err := ports.ParseCursor(options)
+		if err != nil {
+			return ports.PortList{}, err
+		}
+
+		operator := ">"
+		if options.Descending {
+			operator = "<"
+		}
+		addCondition(fmt.Sprintf("(%s, id) %s (?, ?)", column, operator), cursor.Key, cursor.ID)
+	}
+
+	query := `SELECT id, ` + portColumns + ` FROM ports`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// One more port is fetched to check whether there is a next page.
+	args = append(args, options.Limit+1)
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", column, order, order, len(args))
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ports.PortList{}, fmt.Errorf("failed to select ports: %w", err)
+	}
+	defer rows.Close()
+
+	var list ports.PortList
+	for rows.Next() {
+		var ID string
+		var row portRow
+		if err := row.scan(rows, &ID); err != nil {
+			return ports.PortList{}, fmt.Errorf("failed to scan port: %w", err)
+		}
+
+		if len(list.Ports) == options.Limit {
+			last := list.Ports[len(list.Ports)-1]
+			list.NextCursor = ports.NewCursor(options, last.ID, last.Port).String()
+			break
+		}
+
+		port, err := row.port()
+		if err != nil {
+			return ports.PortList{}, err
+		}
+		list.Ports = append(list.Ports, ports.PortWithID{Port: port, ID: ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return ports.PortList{}, fmt.Errorf("failed to select ports: %w", err)
+	}
+
+	return list, nil
+}
+
+// Ping checks whether the database is available.
+func (p *portSQL) Ping(ctx context.Context) error {
+	if err := p.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database is not available: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the database.
+func (p *portSQL) Close() error {
+	return p.db.Close()
+}
+
+// portRow describes port's columns in a database.
+type portRow struct {
+	name, city, country, province, timezone, code string
+	// coordinates, alias, regions and unlocs are JSON arrays.
+	coordinates, alias, regions, unlocs string
+	revision                            uint64
+}
+
+// scan scans portColumns which are selected after given columns.
+func (r *portRow) scan(row interface{ Scan(dest ...any) error }, columns ...any) error {
+	return row.Scan(append(columns, &r.name, &r.city, &r.country, &r.province, &r.timezone, &r.code,
+		&r.coordinates, &r.alias, &r.regions, &r.unlocs, &r.revision)...)
+}
+
+// newPortRow converts a port into database's columns.
+func newPortRow(port ports.Port) (portRow, error) {
+	row := portRow{
+		name:     port.Name,
+		city:     port.City,
+		country:  port.Country,
+		province: port.Province,
+		timezone: port.Timezone,
+		code:     port.Code,
+	}
+
+	columns := []struct {
+		column *string
+		value  any
+	}{
+		{&row.coordinates, port.Coordinates},
+		{&row.alias, port.Alias},
+		{&row.regions, port.Regions},
+		{&row.unlocs, port.Unlocs},
+	}
+	for _, c := range columns {
+		b, err := json.Marshal(c.value)
+		if err != nil {
+			return row, err
+		}
+		*c.column = string(b)
+	}
+
+	return row, nil
+}
+
+// port converts database's columns into a port.
+func (r portRow) port() (ports.Port, error) {
+	port := ports.Port{
+		Name:     r.name,
+		City:     r.city,
+		Country:  r.country,
+		Province: r.province,
+		Timezone: r.timezone,
+		Code:     r.code,
+		Revision: r.revision,
+	}
+
+	columns := []struct {
+		column string
+		value  any
+	}{
+		{r.coordinates, &port.Coordinates},
+		{r.alias, &port.Alias},
+		{r.regions, &port.Regions},
+		{r.unlocs, &port.Unlocs},
+	}
+	for _, c := range columns {
+		if err := json.Unmarshal([]byte(c.column), c.value); err != nil {
+			return ports.Port{}, fmt.Errorf("failed to decode port's column: %w", err)
+		}
+	}
+
+	return port, nil
+}
+
+// escapeLike escapes special characters of LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// isUniqueViolation checks whether an error is caused by a violation of a unique constraint.
+// Errors are checked by their methods, so drivers do not have to be imported here.
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == pgUniqueViolation
+	}
+
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return code == sqlitePrimaryKeyViolation || code == sqliteUniqueViolation
+	}
+
+	return false
+}
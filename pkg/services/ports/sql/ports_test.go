@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/portstest"
+)
+
+// newSQLiteDSN returns data source name of a new SQLite database in a temporary directory.
+func newSQLiteDSN(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "ports.db") + "?_pragma=busy_timeout(5000)"
+}
+
+func TestPortSQL(t *testing.T) {
+	portstest.TestPortService(t, func(t *testing.T) ports.PortService {
+		svc, err := NewPortSQL(context.Background(), "sqlite", newSQLiteDSN(t))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, svc.Close())
+		})
+
+		return svc
+	})
+}
+
+// TestMigrate tests whether migrations can be applied many times.
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	dsn := newSQLiteDSN(t)
+
+	svc, err := NewPortSQL(ctx, "sqlite", dsn)
+	require.NoError(t, err)
+	require.NoError(t, svc.Create(ctx, "test", portstest.ValidPort("test")))
+	require.NoError(t, Migrate(ctx, svc.db))
+	require.NoError(t, svc.Close())
+
+	svc, err = NewPortSQL(ctx, "sqlite", dsn)
+	require.NoError(t, err)
+	defer svc.Close()
+
+	port, err := svc.Get(ctx, "test")
+	require.NoError(t, err)
+	portstest.RequireEqualPort(t, portstest.ValidPort("test"), port)
+
+	var versions int
+	require.NoError(t, svc.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&versions))
+	require.Equal(t, 2, versions)
+}
+
+// TestPortSQL_Ping tests whether an unavailable database is reported.
+func TestPortSQL_Ping(t *testing.T) {
+	ctx := context.Background()
+	svc, err := NewPortSQL(ctx, "sqlite", newSQLiteDSN(t))
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Ping(ctx))
+	require.NoError(t, svc.Close())
+	require.Error(t, svc.Ping(ctx))
+}
+
+// TestPortSQL_Context tests whether a canceled context stops queries.
+func TestPortSQL_Context(t *testing.T) {
+	svc, err := NewPortSQL(context.Background(), "sqlite", newSQLiteDSN(t))
+	require.NoError(t, err)
+	defer svc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = svc.Get(ctx, "test")
+	require.ErrorIs(t, err, context.Canceled)
+	err = svc.Create(ctx, "test", portstest.ValidPort("test"))
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,54 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrRevisionCompacted is returned by Watcher.Watch when changes after a revision are not kept anymore,
+	// so a watcher has to read all ports again.
+	ErrRevisionCompacted = errors.New("changes after revision are not available anymore")
+	// ErrWatchNotSupported is returned by Watcher.Watch of a wrapped port's service which can not be watched.
+	ErrWatchNotSupported = errors.New("port's service does not support watching changes")
+)
+
+// WatchEvent describes a single change of a port which is sent to watchers.
+type WatchEvent struct {
+	// Revision is a revision of a change. A deletion has its own revision as well.
+	Revision uint64
+	// Action describes how a port has been changed.
+	Action Action
+	// PortID is an ID of a changed port.
+	PortID string
+	// Port is a port after a change, or a deleted port.
+	Port Port
+}
+
+// Watcher is implemented by port's services which send their changes to watchers.
+type Watcher interface {
+	// Watch returns a channel with changes whose revisions are greater than fromRevision, in order of revisions.
+	// Only new changes are sent when fromRevision is zero. ErrRevisionCompacted is returned when changes after
+	// fromRevision are not kept anymore. The channel is closed when a context is canceled, or when a watcher
+	// does not receive changes fast enough, because writers never wait for watchers. A watcher which has been
+	// closed can watch again from the revision of the last received change.
+	Watch(ctx context.Context, fromRevision uint64) (<-chan WatchEvent, error)
+}
+
+// WatchFilter describes which changes are sent to a watcher. Empty properties are not taken into account.
+type WatchFilter struct {
+	// Country must be equal to port's country, and it is compared case-insensitively.
+	Country string
+	// IDPrefix must be a prefix of port's ID.
+	IDPrefix string
+}
+
+// Match checks whether a change matches a filter. A deleted port is matched by its last properties.
+func (f WatchFilter) Match(event WatchEvent) bool {
+	if len(f.Country) > 0 && !strings.EqualFold(event.Port.Country, f.Country) {
+		return false
+	}
+
+	return strings.HasPrefix(event.PortID, f.IDPrefix)
+}
@@ -0,0 +1,147 @@
+// Package watch provides a hub which sends changes of ports to watchers without blocking writers.
+package watch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+// DefaultCapacity is a number of the last changes which are kept, so watchers can resume from them.
+const DefaultCapacity = 1024
+
+// NewHub returns a hub which keeps a given positive number of the last changes. A watcher is closed when it has
+// the same number of changes pending.
+// Changes up to a given revision have been made before the hub is created, so nobody can watch from them.
+func NewHub(capacity int, revision uint64) *Hub {
+	return &Hub{
+		events:      make([]ports.WatchEvent, 0, capacity),
+		capacity:    capacity,
+		compacted:   revision,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Hub sends changes of ports to watchers.
+type Hub struct {
+	// mutex locks this structure when changes are published or watched.
+	mutex sync.Mutex
+	// events is a ring buffer of the last changes in order of their revisions, which starts at start.
+	events []ports.WatchEvent
+	start  int
+	// capacity is a maximum number of kept changes.
+	capacity int
+	// compacted is the last revision which is not kept.
+	compacted uint64
+	// subscribers receive published changes.
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is a single watcher. Changes are queued for it, so a publisher never waits for a watcher.
+type subscriber struct {
+	// mutex locks pending changes and closed flag.
+	mutex   sync.Mutex
+	pending []ports.WatchEvent
+	// closed is true when a watcher has fallen behind, and it gets only pending changes.
+	closed bool
+	// notify wakes up a goroutine which sends pending changes to a watcher.
+	notify chan struct{}
+}
+
+// Publish sends a change to all watchers, and keeps it for watchers which resume later.
+// Changes must be published in order of their revisions. A watcher which has too many pending changes
+// is closed instead of waiting for it.
+func (h *Hub) Publish(event ports.WatchEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.events) < h.capacity {
+		h.events = append(h.events, event)
+	} else {
+		h.compacted = h.events[h.start].Revision
+		h.events[h.start] = event
+		h.start = (h.start + 1) % h.capacity
+	}
+
+	for s := range h.subscribers {
+		s.mutex.Lock()
+		if len(s.pending) >= h.capacity {
+			s.closed = true
+			delete(h.subscribers, s)
+		} else {
+			s.pending = append(s.pending, event)
+		}
+		s.mutex.Unlock()
+
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Watch returns a channel with changes after a given revision. It implements ports.Watcher.
+func (h *Hub) Watch(ctx context.Context, fromRevision uint64) (<-chan ports.WatchEvent, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := &subscriber{notify: make(chan struct{}, 1)}
+	if fromRevision > 0 {
+		if fromRevision < h.compacted {
+			return nil, ports.ErrRevisionCompacted
+		}
+
+		for i := range h.events {
+			if event := h.events[(h.start+i)%len(h.events)]; event.Revision > fromRevision {
+				s.pending = append(s.pending, event)
+			}
+		}
+		s.notify <- struct{}{}
+	}
+	h.subscribers[s] = struct{}{}
+
+	events := make(chan ports.WatchEvent)
+	go h.send(ctx, s, events)
+
+	return events, nil
+}
+
+// send sends pending changes of a subscriber to a channel, until a context is canceled or a subscriber is closed.
+func (h *Hub) send(ctx context.Context, s *subscriber, events chan<- ports.WatchEvent) {
+	defer close(events)
+	defer h.unsubscribe(s)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		}
+
+		s.mutex.Lock()
+		pending, closed := s.pending, s.closed
+		s.pending = nil
+		s.mutex.Unlock()
+
+		for _, event := range pending {
+			select {
+			case <-ctx.Done():
+				return
+			case events <- event:
+			}
+		}
+
+		if closed {
+			return
+		}
+	}
+}
+
+// unsubscribe stops publishing changes to a subscriber.
+func (h *Hub) unsubscribe(s *subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.subscribers, s)
+}
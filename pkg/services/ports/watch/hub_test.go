@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+func TestHub(t *testing.T) { // nolint: funlen
+	ctx := context.Background()
+
+	// publish publishes changes with given revisions.
+	publish := func(hub *Hub, revisions ...uint64) {
+		for _, revision := range revisions {
+			hub.Publish(ports.WatchEvent{Revision: revision, Action: ports.ActionUpdate, PortID: "A"})
+		}
+	}
+	// receive returns revisions of all changes until a channel is closed or nothing is received for a while.
+	receive := func(events <-chan ports.WatchEvent) ([]uint64, bool) {
+		var revisions []uint64
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return revisions, true
+				}
+				revisions = append(revisions, event.Revision)
+			case <-time.After(100 * time.Millisecond):
+				return revisions, false
+			}
+		}
+	}
+
+	passed := t.Run("resume from kept changes", func(t *testing.T) {
+		hub := NewHub(3, 10)
+		_, err := hub.Watch(ctx, 5)
+		require.ErrorIs(t, err, ports.ErrRevisionCompacted, "changes before the hub has been created are not kept")
+
+		publish(hub, 11, 12, 13)
+		events, err := hub.Watch(ctx, 11)
+		require.NoError(t, err)
+		revisions, closed := receive(events)
+		require.Equal(t, []uint64{12, 13}, revisions)
+		require.False(t, closed)
+
+		publish(hub, 14)
+		revisions, _ = receive(events)
+		require.Equal(t, []uint64{14}, revisions)
+
+		_, err = hub.Watch(ctx, 10)
+		require.ErrorIs(t, err, ports.ErrRevisionCompacted)
+		events, err = hub.Watch(ctx, 11)
+		require.NoError(t, err, "changes after 11 are still kept")
+		revisions, _ = receive(events)
+		require.Equal(t, []uint64{12, 13, 14}, revisions)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("only new changes", func(t *testing.T) {
+		hub := NewHub(3, 0)
+		publish(hub, 1, 2)
+
+		events, err := hub.Watch(ctx, 0)
+		require.NoError(t, err)
+		publish(hub, 3)
+		revisions, _ := receive(events)
+		require.Equal(t, []uint64{3}, revisions)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("slow watcher does not block publisher", func(t *testing.T) {
+		hub := NewHub(3, 0)
+		slow, err := hub.Watch(ctx, 0)
+		require.NoError(t, err)
+
+		published := make(chan struct{})
+		go func() {
+			publish(hub, 1, 2, 3, 4, 5, 6, 7, 8)
+			close(published)
+		}()
+		select {
+		case <-published:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "publisher waits for a watcher")
+		}
+
+		revisions, closed := receive(slow)
+		require.True(t, closed, "slow watcher must be closed")
+		require.NotEmpty(t, revisions)
+		for i, revision := range revisions {
+			require.Equal(t, uint64(i+1), revision, "received changes must not have gaps")
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("canceled watcher", func(t *testing.T) {
+		hub := NewHub(3, 0)
+		ctx, cancel := context.WithCancel(ctx)
+		events, err := hub.Watch(ctx, 0)
+		require.NoError(t, err)
+
+		cancel()
+		_, closed := receive(events)
+		require.True(t, closed)
+		require.Eventually(t, func() bool {
+			hub.mutex.Lock()
+			defer hub.mutex.Unlock()
+			return len(hub.subscribers) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+	require.True(t, passed)
+}
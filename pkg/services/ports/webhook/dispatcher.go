@@ -0,0 +1,391 @@
+// Package webhook sends changes of ports to subscribed URLs.
+//
+// Changes are taken from ports.Watcher, and every subscription has its own queue, so a slow receiver does not delay
+// others. A delivery is retried with exponential backoff, and it is moved to a subscription's dead letters when all
+// attempts fail. Subscriptions are kept in memory.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/informalict/ports/pkg/services/ports"
+)
+
+var (
+	// ErrSubscriptionNotFound is returned when a subscription does not exist.
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	// ErrInvalidSubscription is returned when a subscription can not be created.
+	ErrInvalidSubscription = errors.New("invalid webhook subscription")
+)
+
+// Subscription describes where changes of ports are sent.
+type Subscription struct {
+	// ID is set when a subscription is created.
+	ID string
+	// URL receives POST requests with changes.
+	URL string
+	// Secret signs deliveries. A random one is generated when it is empty.
+	Secret string
+	// Filter describes which changes are sent.
+	Filter ports.WatchFilter
+	// CreatedAt is set when a subscription is created.
+	CreatedAt time.Time
+}
+
+// DeadLetter is a change which has not been delivered.
+type DeadLetter struct {
+	// Event is a change of a port.
+	Event ports.WatchEvent
+	// Attempts is a number of failed attempts.
+	Attempts int
+	// Error is a reason of the last failure.
+	Error string
+	// FailedAt is time of the last failure.
+	FailedAt time.Time
+}
+
+// Options describes how changes are delivered.
+type Options struct {
+	// Encode returns a body of a delivery.
+	Encode func(event ports.WatchEvent) ([]byte, error)
+	// Client sends deliveries, and its timeout limits a single attempt.
+	Client *http.Client
+	// MaxAttempts is a number of attempts before a change is moved to dead letters.
+	MaxAttempts int
+	// InitialBackoff is time before the second attempt, and it doubles with every next one.
+	InitialBackoff time.Duration
+	// MaxBackoff limits time between attempts.
+	MaxBackoff time.Duration
+	// QueueSize is a number of changes which wait for delivery to a subscription. A change which does not fit
+	// is moved to dead letters at once.
+	QueueSize int
+	// MaxDeadLetters is a number of the last dead letters which are kept for a subscription.
+	MaxDeadLetters int
+}
+
+// DefaultOptions returns options which are used by the server, with a given encoder.
+func DefaultOptions(encode func(event ports.WatchEvent) ([]byte, error)) Options {
+	return Options{
+		Encode:         encode,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts:    6,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		QueueSize:      1000,
+		MaxDeadLetters: 1000,
+	}
+}
+
+// subscriber delivers changes to a single subscription.
+type subscriber struct {
+	subscription Subscription
+	queue        chan ports.WatchEvent
+	// cancel stops delivering changes when a subscription is removed.
+	cancel context.CancelFunc
+	// mutex locks dead letters.
+	mutex       sync.Mutex
+	deadLetters []DeadLetter
+}
+
+// Dispatcher sends changes of ports to subscriptions.
+type Dispatcher struct {
+	watcher ports.Watcher
+	options Options
+	logger  *slog.Logger
+	// ctx is canceled when a dispatcher is closed, and it stops all deliveries.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// workers waits for goroutines which deliver changes.
+	workers sync.WaitGroup
+	// mutex locks subscribers.
+	mutex       sync.RWMutex
+	subscribers map[string]*subscriber
+}
+
+// NewDispatcher returns a dispatcher which sends changes from a watcher, once it is run.
+func NewDispatcher(watcher ports.Watcher, options Options, logger *slog.Logger) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Dispatcher{
+		watcher:     watcher,
+		options:     options,
+		logger:      logger,
+		ctx:         ctx,
+		cancel:      cancel,
+		subscribers: make(map[string]*subscriber),
+	}
+}
+
+// Run watches changes of ports and queues them for subscriptions, until a context is canceled.
+// Changes which are made before Run is called are not sent.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var last uint64
+	for {
+		events, err := d.watcher.Watch(ctx, last)
+		if errors.Is(err, ports.ErrRevisionCompacted) {
+			d.logger.Error("changes of ports have been lost, and they are not sent to webhooks", "after_revision", last)
+			last = 0
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for event := range events {
+			last = event.Revision
+			d.dispatch(event)
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		// A watcher has been closed, because queueing has fallen behind, so it resumes from the last change.
+	}
+}
+
+// dispatch queues a change for all subscriptions which match it, without waiting for any of them.
+func (d *Dispatcher) dispatch(event ports.WatchEvent) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for _, s := range d.subscribers {
+		if !s.subscription.Filter.Match(event) {
+			continue
+		}
+
+		select {
+		case s.queue <- event:
+		default:
+			d.deadLetter(s, DeadLetter{Event: event, Error: "delivery queue is full", FailedAt: time.Now().UTC()})
+		}
+	}
+}
+
+// Close stops delivering changes, and it waits until attempts in progress are finished.
+// Queued changes are not delivered.
+func (d *Dispatcher) Close() error {
+	d.cancel()
+	d.workers.Wait()
+
+	return nil
+}
+
+// Subscribe creates a subscription, and it returns the subscription with its ID and secret.
+func (d *Dispatcher) Subscribe(subscription Subscription) (Subscription, error) {
+	u, err := url.Parse(subscription.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return Subscription{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+
+	if subscription.ID, err = randomHex(8); err != nil {
+		return Subscription{}, err
+	}
+	if len(subscription.Secret) == 0 {
+		if subscription.Secret, err = randomHex(32); err != nil {
+			return Subscription{}, err
+		}
+	}
+	subscription.CreatedAt = time.Now().UTC()
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	s := &subscriber{
+		subscription: subscription,
+		queue:        make(chan ports.WatchEvent, d.options.QueueSize),
+		cancel:       cancel,
+	}
+
+	d.mutex.Lock()
+	d.subscribers[subscription.ID] = s
+	d.mutex.Unlock()
+
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		d.deliverAll(ctx, s)
+	}()
+
+	return subscription, nil
+}
+
+// Unsubscribe removes a subscription, and its queued changes are not delivered.
+func (d *Dispatcher) Unsubscribe(ID string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	s, ok := d.subscribers[ID]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+	s.cancel()
+	delete(d.subscribers, ID)
+
+	return nil
+}
+
+// Subscription returns a subscription with a given ID.
+func (d *Dispatcher) Subscription(ID string) (Subscription, error) {
+	s, err := d.subscriber(ID)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	return s.subscription, nil
+}
+
+// Subscriptions returns all subscriptions in order of their creation.
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	subscriptions := make([]Subscription, 0, len(d.subscribers))
+	for _, s := range d.subscribers {
+		subscriptions = append(subscriptions, s.subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].ID < subscriptions[j].ID
+		}
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+
+	return subscriptions
+}
+
+// DeadLetters returns changes which have not been delivered to a subscription, from the oldest one.
+func (d *Dispatcher) DeadLetters(ID string) ([]DeadLetter, error) {
+	s, err := d.subscriber(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]DeadLetter(nil), s.deadLetters...), nil
+}
+
+// subscriber returns a subscriber of a subscription with a given ID.
+func (d *Dispatcher) subscriber(ID string) (*subscriber, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	s, ok := d.subscribers[ID]
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return s, nil
+}
+
+// deadLetter keeps a change which has not been delivered, and it drops the oldest one when there are too many.
+func (d *Dispatcher) deadLetter(s *subscriber, letter DeadLetter) {
+	d.logger.Warn("webhook delivery has failed", "webhook_id", s.subscription.ID, "port_id", letter.Event.PortID,
+		"revision", letter.Event.Revision, "attempts", letter.Attempts, "error", letter.Error)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deadLetters = append(s.deadLetters, letter)
+	if len(s.deadLetters) > d.options.MaxDeadLetters {
+		s.deadLetters = s.deadLetters[len(s.deadLetters)-d.options.MaxDeadLetters:]
+	}
+}
+
+// deliverAll delivers queued changes to a subscription one by one, so a receiver gets them in order.
+func (d *Dispatcher) deliverAll(ctx context.Context, s *subscriber) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			d.deliver(ctx, s, event)
+		}
+	}
+}
+
+// deliver sends a change to a subscription, and retries with exponential backoff until it is accepted
+// or all attempts fail.
+func (d *Dispatcher) deliver(ctx context.Context, s *subscriber, event ports.WatchEvent) {
+	body, err := d.options.Encode(event)
+	if err != nil {
+		d.deadLetter(s, DeadLetter{Event: event, Error: err.Error(), FailedAt: time.Now().UTC()})
+		return
+	}
+
+	backoff := d.options.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.send(ctx, s.subscription, event, body)
+		if err == nil {
+			return
+		}
+
+		if ctx.Err() != nil {
+			// A subscription has been removed, or the server is shutting down.
+			return
+		}
+
+		if attempt >= d.options.MaxAttempts {
+			d.deadLetter(s, DeadLetter{Event: event, Attempts: attempt, Error: err.Error(), FailedAt: time.Now().UTC()})
+			return
+		}
+
+		d.logger.Debug("webhook delivery is retried", "webhook_id", s.subscription.ID, "revision", event.Revision,
+			"attempt", attempt, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, d.options.MaxBackoff)
+	}
+}
+
+// send makes a single attempt to deliver a change. Any status other than 2xx is a failure.
+func (d *Dispatcher) send(ctx context.Context, subscription Subscription, event ports.WatchEvent, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SubscriptionHeader, subscription.ID)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(event.Revision, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := d.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("receiver has responded with %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// randomHex returns a random hex-encoded value of a given number of bytes.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/informalict/ports/pkg/logging"
+	"github.com/informalict/ports/pkg/services/ports"
+	"github.com/informalict/ports/pkg/services/ports/memory"
+)
+
+// delivery is a request which has been received by a receiver.
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver records deliveries, and it responds with statuses from a function.
+type receiver struct {
+	mutex      sync.Mutex
+	deliveries []delivery
+	attempts   atomic.Int32
+	status     func(attempt int) int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	attempt := int(rc.attempts.Add(1))
+	body, _ := io.ReadAll(r.Body)
+	status := rc.status(attempt)
+	if status == http.StatusOK {
+		rc.mutex.Lock()
+		rc.deliveries = append(rc.deliveries, delivery{header: r.Header.Clone(), body: body})
+		rc.mutex.Unlock()
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) delivered() []delivery {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return append([]delivery(nil), rc.deliveries...)
+}
+
+// encode encodes only an ID and a revision of a change.
+func encode(event ports.WatchEvent) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"id": event.PortID, "revision": event.Revision})
+}
+
+func TestDispatcher(t *testing.T) { // nolint: funlen
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc := memory.NewPortMemory()
+	options := DefaultOptions(encode)
+	options.MaxAttempts = 3
+	options.InitialBackoff = time.Millisecond
+	dispatcher := NewDispatcher(svc, options, logging.Discard())
+	defer dispatcher.Close()
+	go func() {
+		_ = dispatcher.Run(ctx)
+	}()
+
+	// subscribe creates a subscription for a receiver which responds with statuses from a function.
+	subscribe := func(t *testing.T, filter ports.WatchFilter, status func(attempt int) int) (*receiver, Subscription) {
+		rc := &receiver{status: status}
+		server := httptest.NewServer(rc)
+		t.Cleanup(server.Close)
+
+		subscription, err := dispatcher.Subscribe(Subscription{URL: server.URL, Filter: filter})
+		require.NoError(t, err)
+		require.NotEmpty(t, subscription.ID)
+		require.NotEmpty(t, subscription.Secret)
+
+		return rc, subscription
+	}
+	ok := func(int) int { return http.StatusOK }
+
+	// Changes made before Run watches are not sent, so a probe waits until it receives one.
+	probe, probeSubscription := subscribe(t, ports.WatchFilter{IDPrefix: "PROBE"}, ok)
+	probes := 0
+	require.Eventually(t, func() bool {
+		probes++
+		require.NoError(t, svc.Create(ctx, "PROBE"+strconv.Itoa(probes), ports.Port{Name: "probe"}))
+		return len(probe.delivered()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, dispatcher.Unsubscribe(probeSubscription.ID))
+
+	passed := t.Run("signed deliveries of matching changes", func(t *testing.T) {
+		rc, subscription := subscribe(t, ports.WatchFilter{Country: "poland", IDPrefix: "PL"}, ok)
+
+		require.NoError(t, svc.Create(ctx, "DEHAM", ports.Port{Name: "Hamburg", Country: "Germany"}))
+		require.NoError(t, svc.Create(ctx, "PLGDN", ports.Port{Name: "Gdansk", Country: "Poland"}))
+		require.NoError(t, svc.Delete(ctx, "PLGDN"))
+
+		require.Eventually(t, func() bool { return len(rc.delivered()) == 2 }, 5*time.Second, 10*time.Millisecond)
+		for _, d := range rc.delivered() {
+			require.Equal(t, subscription.ID, d.header.Get(SubscriptionHeader))
+			timestamp, err := strconv.ParseInt(d.header.Get(TimestampHeader), 10, 64)
+			require.NoError(t, err)
+			require.True(t, Verify(subscription.Secret, timestamp, d.body, d.header.Get(SignatureHeader)))
+			require.False(t, Verify("other secret", timestamp, d.body, d.header.Get(SignatureHeader)))
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(d.body, &body))
+			require.Equal(t, "PLGDN", body["id"])
+			require.Equal(t, d.header.Get(DeliveryHeader), strconv.FormatFloat(body["revision"].(float64), 'f', -1, 64))
+		}
+	})
+	require.True(t, passed)
+
+	passed = t.Run("failed delivery is retried", func(t *testing.T) {
+		rc, subscription := subscribe(t, ports.WatchFilter{IDPrefix: "RETRY"}, func(attempt int) int {
+			if attempt < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		})
+
+		require.NoError(t, svc.Create(ctx, "RETRY", ports.Port{Name: "retry"}))
+		require.Eventually(t, func() bool { return len(rc.delivered()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, int32(3), rc.attempts.Load())
+
+		deadLetters, err := dispatcher.DeadLetters(subscription.ID)
+		require.NoError(t, err)
+		require.Empty(t, deadLetters)
+	})
+	require.True(t, passed)
+
+	passed = t.Run("undelivered change is a dead letter", func(t *testing.T) {
+		rc, subscription := subscribe(t, ports.WatchFilter{IDPrefix: "DEAD"}, func(int) int {
+			return http.StatusInternalServerError
+		})
+
+		require.NoError(t, svc.Create(ctx, "DEAD", ports.Port{Name: "dead"}))
+		var deadLetters []DeadLetter
+		require.Eventually(t, func() bool {
+			var err error
+			deadLetters, err = dispatcher.DeadLetters(subscription.ID)
+			require.NoError(t, err)
+			return len(deadLetters) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.Equal(t, "DEAD", deadLetters[0].Event.PortID)
+		require.Equal(t, ports.ActionCreate, deadLetters[0].Event.Action)
+		require.Equal(t, 3, deadLetters[0].Attempts)
+		require.Contains(t, deadLetters[0].Error, "500")
+		require.Equal(t, int32(3), rc.attempts.Load())
+	})
+	require.True(t, passed)
+
+	passed = t.Run("subscriptions", func(t *testing.T) {
+		_, err := dispatcher.Subscribe(Subscription{URL: "ftp://example.com"})
+		require.ErrorIs(t, err, ErrInvalidSubscription)
+		_, err = dispatcher.Subscribe(Subscription{URL: "/relative"})
+		require.ErrorIs(t, err, ErrInvalidSubscription)
+
+		subscription, err := dispatcher.Subscribe(Subscription{URL: "http://example.com", Secret: "secret"})
+		require.NoError(t, err)
+		require.Equal(t, "secret", subscription.Secret)
+		found, err := dispatcher.Subscription(subscription.ID)
+		require.NoError(t, err)
+		require.Equal(t, subscription, found)
+		require.Len(t, dispatcher.Subscriptions(), 4)
+		require.Equal(t, subscription, dispatcher.Subscriptions()[3], "subscriptions are in order of creation")
+
+		require.NoError(t, dispatcher.Unsubscribe(subscription.ID))
+		require.ErrorIs(t, dispatcher.Unsubscribe(subscription.ID), ErrSubscriptionNotFound)
+		_, err = dispatcher.Subscription(subscription.ID)
+		require.ErrorIs(t, err, ErrSubscriptionNotFound)
+		_, err = dispatcher.DeadLetters(subscription.ID)
+		require.ErrorIs(t, err, ErrSubscriptionNotFound)
+	})
+	require.True(t, passed)
+}
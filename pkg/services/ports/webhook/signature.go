@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers of a delivery.
+const (
+	// SubscriptionHeader is an ID of a subscription.
+	SubscriptionHeader = "X-Webhook-ID"
+	// DeliveryHeader is a revision of a change, which is the same for every attempt, so a receiver can skip
+	// changes which it has already handled.
+	DeliveryHeader = "X-Webhook-Delivery"
+	// TimestampHeader is Unix time of an attempt in seconds, which is signed, so old deliveries can not be replayed.
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureHeader is a signature of a delivery made by Sign.
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// signaturePrefix describes an algorithm of a signature.
+const signaturePrefix = "sha256="
+
+// Sign returns a signature of a delivery's body at a given Unix time: `sha256=` and a hex-encoded HMAC-SHA256
+// of the time, a dot and the body, with a subscription's secret as a key.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks whether a signature of a delivery is valid. Receivers should also check that the time is recent.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -14,7 +14,7 @@ import (
 )
 
 // TestCreatePort creates a new port.
-// This test may not be idempotent, because it can not be cleaned up.
+// This test is idempotent, because a created port is deleted at the end.
 func TestCreatePort(t *testing.T) {
 	portID := "TestCreatePort_" + randString(6)
 
@@ -34,7 +34,7 @@ func TestCreatePort(t *testing.T) {
 		validPort := api.Port{
 			Name:        "name",
 			City:        "city",
-			Country:     "country",
+			Country:     "Poland",
 			Coordinates: []float64{1.0, 1.0},
 		}
 		b, err := json.Marshal(&validPort)
@@ -54,4 +54,5 @@ func TestCreatePort(t *testing.T) {
 		assert.Equal(t, validPort, svcPort)
 	})
 	require.True(t, passed)
+	deletePort(t, portID)
 }
@@ -2,6 +2,8 @@ package test
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"os"
 	"testing"
@@ -13,7 +15,7 @@ import (
 	"github.com/informalict/ports/pkg/services/ports/router"
 )
 
-// TestCheckInitFile check whether all entries from file exist in the service.
+// TestCheckInitFile check whether all valid entries from file exist in the service, and invalid ones do not exist.
 // This test is idempotent and can be launched many times.
 func TestCheckInitFile(t *testing.T) {
 	channel := make(chan ports.PortWithID)
@@ -33,15 +35,28 @@ func TestCheckInitFile(t *testing.T) {
 				resp, err := http.Get(portsService + "/" + filePort.ID) // nolint: noctx
 				require.NoError(t, err)
 
-				svcPort, err := router.ParseRequestPort(resp.Body)
+				svcPort, err := io.ReadAll(resp.Body)
 				resp.Body.Close()
 				require.NoError(t, err)
 
-				assert.Equal(t, router.ConvertToAPIPort(filePort.Port), svcPort)
+				// Empty lists are omitted in JSON, so ports are compared as JSON.
+				expectedPort, err := json.Marshal(router.ConvertToAPIPort(filePort.Port))
+				require.NoError(t, err)
+				assert.JSONEq(t, string(expectedPort), string(svcPort))
 			}
 		}
 	}()
 
-	err = ports.ReadPorts(context.Background(), file, channel)
+	summary, err := ports.ReadPortsWithOptions(context.Background(), file, channel, ports.ReadOptions{
+		Normalize: router.NormalizePort,
+		Validate:  router.ValidatePort,
+	})
 	require.NoError(t, err)
+
+	for _, rejected := range summary.Rejected {
+		resp, err := http.Get(portsService + "/" + rejected.ID) // nolint: noctx
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "invalid port \"%s\" must not be loaded", rejected.ID)
+	}
 }
@@ -14,7 +14,7 @@ import (
 )
 
 // TestUpdatePort updates a new port.
-// This test may not be idempotent, because it can not be cleaned up.
+// This test is idempotent, because a created port is deleted at the end.
 func TestUpdatePort(t *testing.T) {
 	portID := "TestUpdatePort_" + randString(6)
 
@@ -30,7 +30,7 @@ func TestUpdatePort(t *testing.T) {
 		validPort := api.Port{
 			Name:        "name",
 			City:        "city",
-			Country:     "country",
+			Country:     "Poland",
 			Coordinates: []float64{1.0, 1.0},
 		}
 		b, err := json.Marshal(&validPort)
@@ -42,12 +42,13 @@ func TestUpdatePort(t *testing.T) {
 		require.Equal(t, http.StatusCreated, resp.StatusCode)
 	})
 	require.True(t, passed)
+	deletePort(t, portID)
 
 	passed = t.Run("update a port", func(t *testing.T) {
 		validPort := api.Port{
 			Name:        "name_new",
 			City:        "city_new",
-			Country:     "country_new",
+			Country:     "Germany",
 			Coordinates: []float64{2.0, 2.0},
 		}
 		b, err := json.Marshal(&validPort)
@@ -61,7 +62,7 @@ func TestUpdatePort(t *testing.T) {
 		resp, err := client.Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
-		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
 
 		resp, err = http.Get(portsService + "/" + portID) // nolint: noctx
 		require.NoError(t, err)
@@ -3,7 +3,11 @@ package test
 import (
 	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -30,3 +34,16 @@ func randString(n int) string {
 	}
 	return string(b)
 }
+
+// deletePort deletes a port when a test is finished, so a test can be launched many times.
+func deletePort(t *testing.T, portID string) {
+	t.Cleanup(func() {
+		req, err := http.NewRequest(http.MethodDelete, portsService+"/"+portID, nil) // nolint: noctx
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+}